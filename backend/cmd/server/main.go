@@ -11,6 +11,7 @@ import (
 	"backend/internal/auth"
 	"backend/internal/config"
 	"backend/internal/database"
+	"backend/internal/logdecode"
 	"backend/internal/server"
 	"backend/internal/store"
 
@@ -29,6 +30,14 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Initialize log frame decoder, shared by everything that decodes logs
+	logDecoder, err := logdecode.NewDecoder()
+	if err != nil {
+		log.Fatalf("Failed to initialize log decoder: %v", err)
+	}
+	// Closed last, once the server and databases no longer decode logs
+	defer logDecoder.Close()
+
 	// Initialize TimescaleDB
 	tsdb, err := database.New(
 		config.DatabaseConfig{
@@ -38,6 +47,7 @@ func main() {
 			Password: cfg.Database.Password,
 			DBName:   cfg.Database.DBName,
 		},
+		logDecoder,
 	)
 
 	if err != nil {
@@ -65,7 +75,7 @@ func main() {
 	userStore := store.NewUserStore(userDB)
 
 	// Initialize server with both databases and JWT service
-	srv, err := server.New(cfg, tsdb, userDB, jwtService, userStore)
+	srv, err := server.New(cfg, tsdb, userDB, jwtService, userStore, logDecoder)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
@@ -1,34 +1,52 @@
 package auth
 
 import (
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
+// tokenTTL is how long a token is valid for
+const tokenTTL = 24 * time.Hour
+
 type Claims struct {
 	UserID string `json:"user_id"`
 	Type   string `json:"type"`
+	// IssuedAtNano is when the token was issued in Unix nanoseconds, as iat
+	// only has second precision
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
 	jwt.StandardClaims
 }
 
 type JWTService struct {
 	secretKey []byte
+
+	mu              sync.Mutex
+	revoked         map[string]int64 // token ID to expiry
+	revokedUsers    map[string]int64 // user ID to the Unix nanosecond their tokens were revoked
+	revokeListeners []func(r Revocation)
 }
 
 func NewJWTService(secretKey string) *JWTService {
 	return &JWTService{
-		secretKey: []byte(secretKey),
+		secretKey:    []byte(secretKey),
+		revoked:      make(map[string]int64),
+		revokedUsers: make(map[string]int64),
 	}
 }
 
 func (s *JWTService) GenerateToken(userID, userType string) (string, error) {
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Type:   userType,
+		UserID:       userID,
+		Type:         userType,
+		IssuedAtNano: now.UnixNano(),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-			IssuedAt:  time.Now().Unix(),
+			Id:        uuid.New().String(),
+			ExpiresAt: now.Add(tokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
 		},
 	}
 
@@ -46,6 +64,9 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if s.isRevoked(claims) {
+			return nil, ErrTokenRevoked
+		}
 		return claims, nil
 	}
 
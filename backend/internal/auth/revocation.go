@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTokenRevoked is returned when validating a token that was revoked
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Revocation tells listeners which tokens were revoked: a single token, or
+// every token of a user issued so far
+type Revocation struct {
+	TokenID string
+	UserID  string
+}
+
+// Revoke rejects a token until it expires and tells the revocation
+// listeners. Revocations are kept in memory, so they do not survive a
+// restart of the server.
+func (s *JWTService) Revoke(claims *Claims) {
+	if claims.Id == "" {
+		// Tokens issued before they carried an ID cannot be told apart
+		return
+	}
+
+	s.mu.Lock()
+	s.pruneRevocations()
+	s.revoked[claims.Id] = claims.ExpiresAt
+	s.mu.Unlock()
+
+	s.notifyRevoked(Revocation{TokenID: claims.Id})
+}
+
+// RevokeUser rejects every token of a user issued up to now, such as after
+// the password changed or the account was deleted. Tokens issued right
+// after, even in the same second, stay valid.
+func (s *JWTService) RevokeUser(userID string) {
+	s.mu.Lock()
+	s.pruneRevocations()
+	s.revokedUsers[userID] = time.Now().UnixNano()
+	s.mu.Unlock()
+
+	s.notifyRevoked(Revocation{UserID: userID})
+}
+
+// OnRevoke registers a listener called for every revocation
+func (s *JWTService) OnRevoke(listener func(r Revocation)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeListeners = append(s.revokeListeners, listener)
+}
+
+// Verify checks that the claims of an earlier validated token still hold:
+// the token has neither expired nor been revoked
+func (s *JWTService) Verify(claims *Claims) error {
+	if err := claims.Valid(); err != nil {
+		return err
+	}
+	if s.isRevoked(claims) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func (s *JWTService) notifyRevoked(r Revocation) {
+	s.mu.Lock()
+	listeners := s.revokeListeners
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(r)
+	}
+}
+
+func (s *JWTService) isRevoked(claims *Claims) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revoked[claims.Id]; ok && claims.Id != "" {
+		return true
+	}
+	revokedAt, ok := s.revokedUsers[claims.UserID]
+	if !ok {
+		return false
+	}
+	if claims.IssuedAtNano == 0 {
+		// Tokens issued before they carried nanoseconds are rejected if
+		// they may predate the revocation
+		return claims.IssuedAt <= revokedAt/int64(time.Second)
+	}
+	return claims.IssuedAtNano < revokedAt
+}
+
+// pruneRevocations forgets revocations of tokens that have expired anyway.
+// The caller holds mu.
+func (s *JWTService) pruneRevocations() {
+	now := time.Now().Unix()
+	for id, expiresAt := range s.revoked {
+		if expiresAt < now {
+			delete(s.revoked, id)
+		}
+	}
+	for userID, revokedAt := range s.revokedUsers {
+		if revokedAt/int64(time.Second)+int64(tokenTTL/time.Second) < now {
+			delete(s.revokedUsers, userID)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTicket is returned for tickets that are unknown, expired or
+// already redeemed
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// Tickets are short-lived, single-use stand-ins for a token, for clients
+// such as browsers that cannot set headers on a WebSocket upgrade
+type Tickets struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+type ticket struct {
+	claims    *Claims
+	expiresAt time.Time
+}
+
+// NewTickets creates a ticket store whose tickets can be redeemed for ttl
+func NewTickets(ttl time.Duration) *Tickets {
+	return &Tickets{
+		ttl:     ttl,
+		tickets: make(map[string]ticket),
+	}
+}
+
+// Issue creates a ticket for the holder of a validated token
+func (t *Tickets) Issue(claims *Claims) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("generating ticket: %w", err)
+	}
+	id := hex.EncodeToString(b)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for id, tk := range t.tickets {
+		if now.After(tk.expiresAt) {
+			delete(t.tickets, id)
+		}
+	}
+
+	expiresAt := now.Add(t.ttl)
+	t.tickets[id] = ticket{claims: claims, expiresAt: expiresAt}
+	return id, expiresAt, nil
+}
+
+// Redeem returns the claims of the token a ticket was issued for. A ticket
+// can be redeemed once.
+func (t *Tickets) Redeem(id string) (*Claims, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tk, ok := t.tickets[id]
+	if !ok {
+		return nil, ErrInvalidTicket
+	}
+	delete(t.tickets, id)
+	if time.Now().After(tk.expiresAt) {
+		return nil, ErrInvalidTicket
+	}
+	return tk.claims, nil
+}
@@ -52,44 +52,3 @@ func (lb *LogBuffer) GetLogs(clientID string) []types.LogRecord {
 
 	return logs
 }
-
-func (lb *LogBuffer) PopLogs(clientID string) []types.LogRecord {
-	lb.mu.Lock()
-	defer lb.mu.Unlock()
-
-	buffer, exists := lb.buffers[clientID]
-	if !exists || buffer == nil {
-		return nil
-	}
-
-	var logs []types.LogRecord
-	buffer.Do(func(x interface{}) {
-		if x != nil {
-			logs = append(logs, x.(types.LogRecord))
-		}
-	})
-
-	// Clear the buffer
-	lb.buffers[clientID] = ring.New(lb.size)
-
-	return logs
-}
-
-func (lb *LogBuffer) HasLogs(clientID string) bool {
-	lb.mu.RLock()
-	defer lb.mu.RUnlock()
-
-	buffer, exists := lb.buffers[clientID]
-	if !exists || buffer == nil {
-		return false
-	}
-
-	hasValue := false
-	buffer.Do(func(x interface{}) {
-		if x != nil {
-			hasValue = true
-		}
-	})
-
-	return hasValue
-}
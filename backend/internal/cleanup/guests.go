@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/database"
+	"backend/internal/store"
+)
+
+// Defaults for guest cleanup
+const (
+	defaultGuestMaxAge     = 48 * time.Hour
+	defaultCleanupInterval = time.Hour
+)
+
+// guestBatchSize is the number of guests deleted per query
+const guestBatchSize = 100
+
+// GuestCleanup periodically deletes guests older than the max age together
+// with their runs, run events, logs and queued jobs. Guests with queued or
+// running runs are kept until the runs end.
+type GuestCleanup struct {
+	users    *store.UserStore
+	db       *database.Client
+	maxAge   time.Duration
+	interval time.Duration
+}
+
+// NewGuestCleanup creates the guest cleanup job from the guest config
+func NewGuestCleanup(users *store.UserStore, db *database.Client, cfg config.GuestConfig) *GuestCleanup {
+	maxAge := defaultGuestMaxAge
+	if cfg.MaxAge > 0 {
+		maxAge = time.Duration(cfg.MaxAge) * time.Millisecond
+	}
+	interval := defaultCleanupInterval
+	if cfg.CleanupInterval > 0 {
+		interval = time.Duration(cfg.CleanupInterval) * time.Millisecond
+	}
+
+	return &GuestCleanup{
+		users:    users,
+		db:       db,
+		maxAge:   maxAge,
+		interval: interval,
+	}
+}
+
+// Start runs the cleanup now and then every interval until ctx is done
+func (g *GuestCleanup) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(g.interval)
+		defer ticker.Stop()
+
+		for {
+			g.Run(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run deletes the guests that are stale now and returns how many were
+// deleted
+func (g *GuestCleanup) Run(ctx context.Context) int {
+	cutoff := time.Now().Add(-g.maxAge)
+	deleted := 0
+	// Guests that cannot be deleted yet are skipped on later pages
+	skipped := make(map[string]bool)
+
+	for ctx.Err() == nil {
+		ids, err := g.users.ListStaleGuests(ctx, cutoff, guestBatchSize+len(skipped))
+		if err != nil {
+			log.Printf("Error listing stale guests: %v", err)
+			break
+		}
+
+		progress := false
+		for _, id := range ids {
+			if skipped[id] {
+				continue
+			}
+			if err := g.deleteGuest(ctx, id); err != nil {
+				if !errors.Is(err, database.ErrClientActive) {
+					log.Printf("Error deleting guest %s: %v", id, err)
+				}
+				skipped[id] = true
+				continue
+			}
+			deleted++
+			progress = true
+		}
+		if !progress {
+			break
+		}
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d stale guest accounts", deleted)
+	}
+	return deleted
+}
+
+// deleteGuest deletes a guest's data and then the guest. A guest whose
+// account could not be deleted is retried on the next run.
+func (g *GuestCleanup) deleteGuest(ctx context.Context, id string) error {
+	if _, err := g.db.DeleteClientData(ctx, id); err != nil {
+		return err
+	}
+	if err := g.users.Delete(ctx, id); err != nil && !errors.Is(err, store.ErrUserNotFound) {
+		return err
+	}
+	return nil
+}
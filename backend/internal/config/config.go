@@ -13,11 +13,22 @@ type Config struct {
 	GRPC         GRPCConfig         `yaml:"grpc"`
 	Kafka        KafkaConfig        `yaml:"kafka"`
 	LogStreaming LogStreamingConfig `yaml:"log_streaming"`
+	Orchestrator OrchestratorConfig `yaml:"orchestrator"`
+	Mail         MailConfig         `yaml:"mail"`
+	Guests       GuestConfig        `yaml:"guests"`
 }
 
 type ServerConfig struct {
 	Port int    `yaml:"port"`
 	Host string `yaml:"host"`
+
+	// Origins allowed to open WebSockets and make cross-origin requests.
+	// "*" allows any origin; without any only the server's own origin is
+	// allowed.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	// IDs of the users allowed to read internal metrics
+	Admins []string `yaml:"admins"`
 }
 
 type DatabaseConfig struct {
@@ -30,6 +41,34 @@ type DatabaseConfig struct {
 
 type GRPCConfig struct {
 	ServerAddress string `yaml:"server_address"`
+
+	// Pool of ML workers: a static list of addresses, or a host:port whose
+	// host resolves to one address per worker. Without either the server
+	// address is the only worker.
+	Workers        []string `yaml:"workers"`
+	WorkersDNS     string   `yaml:"workers_dns"`
+	HealthInterval int      `yaml:"health_interval_ms"`
+
+	// Deadlines of a single attempt of each RPC. The stop deadline is on
+	// top of the grace period given to the process.
+	StartTimeout int `yaml:"start_timeout_ms"`
+	StopTimeout  int `yaml:"stop_timeout_ms"`
+
+	// Retries of UNAVAILABLE and DEADLINE_EXCEEDED errors with exponential
+	// backoff. A negative max_retries disables retries.
+	MaxRetries      int `yaml:"max_retries"`
+	RetryBackoff    int `yaml:"retry_backoff_ms"`
+	MaxRetryBackoff int `yaml:"max_retry_backoff_ms"`
+
+	// The circuit breaker opens after breaker_threshold consecutive failed
+	// calls and fails fast until breaker_cooldown_ms has passed
+	BreakerThreshold int `yaml:"breaker_threshold"`
+	BreakerCooldown  int `yaml:"breaker_cooldown_ms"`
+
+	// Log streams reconnect after stream_backoff_ms, doubling up to
+	// max_stream_backoff_ms while the worker stays unreachable
+	StreamBackoff    int `yaml:"stream_backoff_ms"`
+	MaxStreamBackoff int `yaml:"max_stream_backoff_ms"`
 }
 
 func Load(path string) (*Config, error) {
@@ -0,0 +1,10 @@
+package config
+
+// GuestConfig holds configuration for guest accounts. Guests cannot sign in
+// again once their token expires, so after max_age_ms they are deleted
+// along with their runs and logs by a job running every
+// cleanup_interval_ms.
+type GuestConfig struct {
+	MaxAge          int `yaml:"max_age_ms"`
+	CleanupInterval int `yaml:"cleanup_interval_ms"`
+}
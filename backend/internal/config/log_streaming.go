@@ -6,4 +6,17 @@ type LogStreamingConfig struct {
 	Port          int    `yaml:"port"`
 	BufferSize    int    `yaml:"buffer_size"`
 	FlushInterval int    `yaml:"flush_interval_ms"`
+
+	// Persistence pipeline
+	QueueSize      int    `yaml:"queue_size"`
+	EnqueueTimeout int    `yaml:"enqueue_timeout_ms"`
+	SpoolDir       string `yaml:"spool_dir"`
+	SpoolMaxMB     int    `yaml:"spool_max_mb"`
+	ReplayInterval int    `yaml:"replay_interval_ms"`
+
+	// Fan-out to WebSocket viewers: logs queued per connection, and what
+	// happens when a connection falls behind (drop_oldest, disconnect or
+	// coalesce)
+	WSQueueSize        int    `yaml:"ws_queue_size"`
+	SlowConsumerPolicy string `yaml:"slow_consumer_policy"`
 }
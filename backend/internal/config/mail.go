@@ -0,0 +1,13 @@
+package config
+
+// MailConfig holds configuration for outgoing email
+type MailConfig struct {
+	// Driver is "log" or "file"
+	Driver string `yaml:"driver"`
+	Dir    string `yaml:"dir"`
+	From   string `yaml:"from"`
+
+	// ResetURL is the page that completes a password reset. The reset token
+	// is appended as the token query parameter.
+	ResetURL string `yaml:"reset_url"`
+}
@@ -0,0 +1,17 @@
+package config
+
+// OrchestratorConfig holds configuration for the job queue of the ML
+// orchestrator. Zero limits mean unlimited.
+type OrchestratorConfig struct {
+	MaxConcurrent    int `yaml:"max_concurrent"`
+	MaxPerUser       int `yaml:"max_per_user"`
+	DispatchInterval int `yaml:"dispatch_interval_ms"`
+
+	// The watchdog fails running runs that no worker has reported for
+	// lost_after_ms, that have not logged for hang_after_ms or that have
+	// run for max_runtime_ms. Zero hang and runtime limits disable them.
+	WatchdogInterval int `yaml:"watchdog_interval_ms"`
+	LostAfter        int `yaml:"lost_after_ms"`
+	HangAfter        int `yaml:"hang_after_ms"`
+	MaxRuntime       int `yaml:"max_runtime_ms"`
+}
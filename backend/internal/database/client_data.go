@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/internal/types"
+)
+
+// ErrClientActive is returned when deleting the data of a client that still
+// has queued or running runs
+var ErrClientActive = errors.New("client has active runs")
+
+// ClientDataDeletion counts what was deleted with a client's data
+type ClientDataDeletion struct {
+	Runs    int64
+	Logs    int64
+	Jobs    int64
+	Metrics int64
+	Models  int64
+}
+
+// DeleteClientData deletes the runs, their events and metrics, the model
+// versions, the logs and the queued jobs of a client in one transaction.
+// Clients with runs that have not ended, including pending runs still on
+// their way to the queue, are left alone.
+func (c *Client) DeleteClientData(ctx context.Context, clientID string) (*ClientDataDeletion, error) {
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var active bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM model_runs
+			WHERE client_id = $1 AND status <> ALL($2)
+		)
+	`, clientID, []string{types.StatusCompleted, types.StatusError, types.StatusCancelled}).Scan(&active)
+	if err != nil {
+		return nil, fmt.Errorf("checking active runs: %w", err)
+	}
+	if active {
+		return nil, ErrClientActive
+	}
+
+	var deleted ClientDataDeletion
+	tag, err := tx.Exec(ctx, `DELETE FROM job_queue WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting jobs: %w", err)
+	}
+	deleted.Jobs = tag.RowsAffected()
+
+	tag, err = tx.Exec(ctx, `DELETE FROM logs WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting logs: %w", err)
+	}
+	deleted.Logs = tag.RowsAffected()
+
+	tag, err = tx.Exec(ctx, `DELETE FROM run_metrics WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting metrics: %w", err)
+	}
+	deleted.Metrics = tag.RowsAffected()
+
+	// Version audit trails go with their versions
+	tag, err = tx.Exec(ctx, `DELETE FROM model_versions WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting model versions: %w", err)
+	}
+	deleted.Models = tag.RowsAffected()
+
+	// Run events go with their runs
+	tag, err = tx.Exec(ctx, `DELETE FROM model_runs WHERE client_id = $1`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("deleting runs: %w", err)
+	}
+	deleted.Runs = tag.RowsAffected()
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return &deleted, nil
+}
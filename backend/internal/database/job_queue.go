@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrJobNotQueued is returned when a job is not waiting in the queue
+var ErrJobNotQueued = errors.New("job not queued")
+
+// ErrJobPriorityRaised is returned when a job would be moved to a priority
+// class ahead of its current one
+var ErrJobPriorityRaised = errors.New("job priority cannot be raised")
+
+// Job states
+const (
+	JobQueued     = "queued"
+	JobDispatched = "dispatched"
+)
+
+// Job is an entry of the orchestrator job queue. Payload is the request
+// passed to StartProcess.
+type Job struct {
+	RunID        string     `json:"run_id"`
+	ClientID     string     `json:"client_id"`
+	ProcessType  string     `json:"process_type"`
+	Priority     int        `json:"priority"`
+	Payload      []byte     `json:"-"`
+	State        string     `json:"state"`
+	EnqueuedAt   time.Time  `json:"enqueued_at"`
+	DispatchedAt *time.Time `json:"dispatched_at,omitempty"`
+}
+
+// EnqueueJob adds a job to the queue. Enqueuing a run twice is a no-op.
+func (c *Client) EnqueueJob(ctx context.Context, job Job) error {
+	_, err := c.pool.Exec(ctx, `
+		INSERT INTO job_queue (run_id, client_id, process_type, priority, payload, state, enqueued_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (run_id) DO NOTHING
+	`, job.RunID, job.ClientID, job.ProcessType, job.Priority, job.Payload, JobQueued, job.EnqueuedAt)
+	if err != nil {
+		return fmt.Errorf("enqueuing job: %w", err)
+	}
+	return nil
+}
+
+// ListJobs returns the jobs in a state, queued jobs in dispatch order
+func (c *Client) ListJobs(ctx context.Context, state string) ([]Job, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT run_id, client_id, process_type, priority, payload, state, enqueued_at, dispatched_at
+		FROM job_queue
+		WHERE state = $1
+		ORDER BY priority, position
+	`, state)
+	if err != nil {
+		return nil, fmt.Errorf("querying jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(&job.RunID, &job.ClientID, &job.ProcessType, &job.Priority,
+			&job.Payload, &job.State, &job.EnqueuedAt, &job.DispatchedAt); err != nil {
+			return nil, fmt.Errorf("scanning job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ActiveJobCounts returns the number of dispatched jobs, in total and per
+// client
+func (c *Client) ActiveJobCounts(ctx context.Context) (int, map[string]int, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT client_id, COUNT(*)
+		FROM job_queue
+		WHERE state = $1
+		GROUP BY client_id
+	`, JobDispatched)
+	if err != nil {
+		return 0, nil, fmt.Errorf("counting active jobs: %w", err)
+	}
+	defer rows.Close()
+
+	total := 0
+	perClient := make(map[string]int)
+	for rows.Next() {
+		var clientID string
+		var count int
+		if err := rows.Scan(&clientID, &count); err != nil {
+			return 0, nil, fmt.Errorf("scanning active job count: %w", err)
+		}
+		perClient[clientID] = count
+		total += count
+	}
+
+	return total, perClient, rows.Err()
+}
+
+// ClaimJob marks a queued job as dispatched. It returns false if the job is
+// no longer queued.
+func (c *Client) ClaimJob(ctx context.Context, runID string) (bool, error) {
+	tag, err := c.pool.Exec(ctx, `
+		UPDATE job_queue
+		SET state = $2, dispatched_at = NOW()
+		WHERE run_id = $1 AND state = $3
+	`, runID, JobDispatched, JobQueued)
+	if err != nil {
+		return false, fmt.Errorf("claiming job: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RequeueJob puts a dispatched job that could not be started back in the
+// queue at its previous place
+func (c *Client) RequeueJob(ctx context.Context, runID string) error {
+	_, err := c.pool.Exec(ctx, `
+		UPDATE job_queue
+		SET state = $2, dispatched_at = NULL
+		WHERE run_id = $1 AND state = $3
+	`, runID, JobQueued, JobDispatched)
+	if err != nil {
+		return fmt.Errorf("requeueing job: %w", err)
+	}
+	return nil
+}
+
+// DeleteJob removes a job from the queue. If states are given the job is
+// only removed when it is in one of them. It returns whether a job was
+// removed.
+func (c *Client) DeleteJob(ctx context.Context, runID string, states ...string) (bool, error) {
+	query := `DELETE FROM job_queue WHERE run_id = $1`
+	args := []interface{}{runID}
+	if len(states) > 0 {
+		query += ` AND state = ANY($2)`
+		args = append(args, states)
+	}
+
+	tag, err := c.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("deleting job: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReleaseFinishedJobs removes dispatched jobs whose run has ended, such as
+// runs that finished while the orchestrator was down
+func (c *Client) ReleaseFinishedJobs(ctx context.Context) (int64, error) {
+	tag, err := c.pool.Exec(ctx, `
+		DELETE FROM job_queue j
+		USING model_runs r
+		WHERE j.run_id = r.run_id
+		AND j.state = $1
+		AND r.ended_at IS NOT NULL
+	`, JobDispatched)
+	if err != nil {
+		return 0, fmt.Errorf("releasing finished jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ReorderJob moves a queued job of a client among the client's own queued
+// jobs, so other clients' jobs keep their places. A new priority moves it to
+// that priority class, which may not be ahead of its current one; position
+// is its 1-based place among the client's jobs of the class, or 0 to put it
+// last. Jobs of other clients are reported as not queued.
+func (c *Client) ReorderJob(ctx context.Context, clientID, runID string, priority *int, position int) error {
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("starting reorder: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	var slot int64
+	err = tx.QueryRow(ctx, `
+		SELECT priority, position FROM job_queue WHERE run_id = $1 AND state = $2 AND client_id = $3 FOR UPDATE
+	`, runID, JobQueued, clientID).Scan(&current, &slot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrJobNotQueued
+	}
+	if err != nil {
+		return fmt.Errorf("querying job: %w", err)
+	}
+
+	target := current
+	if priority != nil {
+		target = *priority
+	}
+	if target < current {
+		return ErrJobPriorityRaised
+	}
+	if target != current {
+		// Join the new class behind every job already in it
+		err := tx.QueryRow(ctx, `SELECT nextval(pg_get_serial_sequence('job_queue', 'position'))`).Scan(&slot)
+		if err != nil {
+			return fmt.Errorf("allocating queue position: %w", err)
+		}
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT run_id, position FROM job_queue
+		WHERE state = $1 AND priority = $2 AND client_id = $3 AND run_id <> $4
+		ORDER BY position
+		FOR UPDATE
+	`, JobQueued, target, clientID, runID)
+	if err != nil {
+		return fmt.Errorf("querying queued jobs: %w", err)
+	}
+	var order []string
+	slots := []int64{slot}
+	for rows.Next() {
+		var id string
+		var position int64
+		if err := rows.Scan(&id, &position); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning queued job: %w", err)
+		}
+		order = append(order, id)
+		slots = append(slots, position)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reading queued jobs: %w", err)
+	}
+
+	index := len(order)
+	if position > 0 && position-1 < index {
+		index = position - 1
+	}
+	order = append(order[:index], append([]string{runID}, order[index:]...)...)
+	// The client's jobs swap the places they already held
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+
+	if _, err := tx.Exec(ctx, `UPDATE job_queue SET priority = $2 WHERE run_id = $1`, runID, target); err != nil {
+		return fmt.Errorf("updating job priority: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE job_queue j
+		SET position = o.position
+		FROM unnest($1::text[], $2::bigint[]) AS o(run_id, position)
+		WHERE j.run_id = o.run_id
+	`, order, slots); err != nil {
+		return fmt.Errorf("updating job positions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing reorder: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// logColumns are the columns written for every log row
+var logColumns = []string{"timestamp", "timestamp_ns", "seq", "client_id", "run_id", "message", "process_id", "level", "logger", "msg", "fields"}
+
+// CopyLogs writes a batch of logs using the COPY protocol. COPY aborts the
+// whole batch on a duplicate key, in which case the batch is retried with
+// conflicting rows skipped.
+func (c *Client) CopyLogs(ctx context.Context, logs []types.LogRecord) (int64, error) {
+	written, err := c.pool.CopyFrom(ctx, pgx.Identifier{"logs"}, logColumns,
+		pgx.CopyFromSlice(len(logs), func(i int) ([]interface{}, error) {
+			return logValues(logs[i]), nil
+		}),
+	)
+	if err == nil {
+		return written, nil
+	}
+
+	if !isUniqueViolation(err) {
+		return 0, fmt.Errorf("copying logs: %w", err)
+	}
+
+	if err := c.BatchInsertLogs(ctx, logs); err != nil {
+		return 0, fmt.Errorf("inserting logs after duplicate key: %w", err)
+	}
+	return int64(len(logs)), nil
+}
+
+// Ping checks that the database is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	return c.pool.Ping(ctx)
+}
+
+// logValues returns the column values of a log row in logColumns order
+func logValues(log types.LogRecord) []interface{} {
+	level, logger, msg := decodedColumns(log)
+	return []interface{}{
+		logTime(log.Timestamp),
+		logNanos(log.Timestamp),
+		log.Seq,
+		log.ClientID,
+		log.RunID,
+		log.Message,
+		processIDValue(log),
+		level,
+		logger,
+		msg,
+		decodedFields(log),
+	}
+}
+
+// Timestamps below this are in seconds, as sent by older log producers
+const minNanoTimestamp = 1e12
+
+// logNanos returns a record's timestamp in Unix nanoseconds
+func logNanos(ts int64) int64 {
+	if ts < minNanoTimestamp {
+		return ts * int64(time.Second)
+	}
+	return ts
+}
+
+// logTime converts a record's timestamp to a time
+func logTime(ts int64) time.Time {
+	return time.Unix(0, logNanos(ts)).UTC()
+}
+
+// processIDValue returns the numeric OS process ID of a log, preferring the
+// one reported in the decoded frame. It is NULL when unknown.
+func processIDValue(log types.LogRecord) *int32 {
+	if log.Decoded != nil && log.Decoded.Process != 0 {
+		pid := int32(log.Decoded.Process)
+		return &pid
+	}
+	if pid, err := strconv.ParseInt(log.ProcessID, 10, 32); err == nil {
+		pid32 := int32(pid)
+		return &pid32
+	}
+	return nil
+}
+
+// logSelectColumns are the columns read by scanLog
+const logSelectColumns = `timestamp_ns, seq, client_id, run_id, message, process_id`
+
+// scanLog reads a row selected with logSelectColumns
+func (c *Client) scanLog(rows pgx.Rows) (types.LogRecord, error) {
+	var log types.LogRecord
+	var processID *int32
+	if err := rows.Scan(&log.Timestamp, &log.Seq, &log.ClientID, &log.RunID, &log.Message, &processID); err != nil {
+		return log, err
+	}
+	if processID != nil {
+		log.ProcessID = strconv.Itoa(int(*processID))
+	}
+	c.decodeLog(&log)
+	return log, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
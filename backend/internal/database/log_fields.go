@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/types"
+)
+
+// decodedColumns returns the level, logger and message text columns for a
+// log. Logs that could not be decoded are stored with NULL columns.
+func decodedColumns(log types.LogRecord) (level, logger, msg *string) {
+	if log.Decoded == nil {
+		return nil, nil, nil
+	}
+	return nullString(log.Decoded.Level), nullString(log.Decoded.Logger), &log.Decoded.Msg
+}
+
+// decodedFields returns the structured fields of a log as a JSON document.
+// Standard record attributes use the DecodedLog JSON names; extra fields from
+// the Python logger are merged in at the top level.
+func decodedFields(log types.LogRecord) interface{} {
+	if log.Decoded == nil {
+		return nil
+	}
+
+	d := log.Decoded
+	fields := make(map[string]interface{}, len(d.Extra)+6)
+	for key, value := range d.Extra {
+		fields[key] = value
+	}
+	setField(fields, "module", d.Module)
+	setField(fields, "func_name", d.FuncName)
+	setField(fields, "pathname", d.Pathname)
+	setField(fields, "thread", d.Thread)
+	if d.Line != 0 {
+		fields["line"] = d.Line
+	}
+	if d.Process != 0 {
+		fields["process"] = d.Process
+	}
+	return fields
+}
+
+func setField(fields map[string]interface{}, key, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// BackfillLogFields decodes stored log frames that predate the level, logger,
+// msg and fields columns and fills those columns in. It works in batches,
+// found through a partial index and updated with one statement each, and
+// returns the number of rows updated.
+func (c *Client) BackfillLogFields(ctx context.Context, batchSize int) (int, error) {
+	total := 0
+	for {
+		rows, err := c.pool.Query(ctx, `
+			SELECT timestamp, seq, client_id, run_id, message
+			FROM logs
+			WHERE level IS NULL OR fields IS NULL
+			LIMIT $1
+		`, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("selecting logs to backfill: %w", err)
+		}
+
+		type pending struct {
+			timestamp time.Time
+			log       types.LogRecord
+		}
+		var batch []pending
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.timestamp, &p.log.Seq, &p.log.ClientID, &p.log.RunID, &p.log.Message); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("scanning log to backfill: %w", err)
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("reading logs to backfill: %w", err)
+		}
+
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		values := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*8)
+		for _, p := range batch {
+			c.decodeLog(&p.log)
+			level, logger, msg := decodedColumns(p.log)
+			fields := decodedFields(p.log)
+			if level == nil {
+				// Mark undecodable rows so they are not selected again
+				unknown := "UNKNOWN"
+				level = &unknown
+			}
+			if fields == nil {
+				fields = map[string]interface{}{}
+			}
+
+			n := len(args)
+			values = append(values, fmt.Sprintf(
+				"($%d::text, $%d::text, $%d::text, $%d::jsonb, $%d::timestamptz, $%d::text, $%d::text, $%d::bigint)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8,
+			))
+			args = append(args, level, logger, msg, fields, p.timestamp, p.log.ClientID, p.log.RunID, p.log.Seq)
+		}
+
+		if _, err := c.pool.Exec(ctx, `
+			UPDATE logs
+			SET level = v.level, logger = v.logger, msg = v.msg, fields = v.fields
+			FROM (VALUES `+strings.Join(values, ", ")+`) AS v (level, logger, msg, fields, timestamp, client_id, run_id, seq)
+			WHERE logs.timestamp = v.timestamp AND logs.client_id = v.client_id
+			AND logs.run_id = v.run_id AND logs.seq = v.seq
+		`, args...); err != nil {
+			return total, fmt.Errorf("backfilling logs: %w", err)
+		}
+		total += len(batch)
+	}
+}
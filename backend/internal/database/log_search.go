@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/jackc/pgconn"
+)
+
+// ErrInvalidSearch is returned when a search cannot be run as given, such as
+// an invalid regular expression
+var ErrInvalidSearch = errors.New("invalid log search")
+
+// MaxSearchRegexLength is the longest regular expression a search accepts
+const MaxSearchRegexLength = 256
+
+// searchTimeout bounds a search in the database, as full-text and regex
+// matches over a wide time range can run for a long time
+const searchTimeout = 5 * time.Second
+
+// Highlight markers around matched text in search snippets
+const (
+	HighlightStart = "<mark>"
+	HighlightStop  = "</mark>"
+)
+
+// Field predicate operators
+const (
+	FieldOpEq       = "eq"
+	FieldOpNe       = "ne"
+	FieldOpGt       = "gt"
+	FieldOpGte      = "gte"
+	FieldOpLt       = "lt"
+	FieldOpLte      = "lte"
+	FieldOpContains = "contains"
+	FieldOpExists   = "exists"
+)
+
+// FieldPredicate filters logs on a structured field of the decoded record
+type FieldPredicate struct {
+	Key   string `json:"key"`
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+}
+
+// SearchCursor is the position of the last result of a search page. Results
+// are ordered newest first by (timestamp, client, run, seq).
+type SearchCursor struct {
+	Timestamp int64  `json:"t"`
+	ClientID  string `json:"c"`
+	RunID     string `json:"r,omitempty"`
+	Seq       int64  `json:"s"`
+}
+
+// LogSearch describes a log search
+type LogSearch struct {
+	ClientID  string
+	RunID     string
+	Text      string
+	Regex     string
+	Levels    []string
+	Logger    string
+	ProcessID *int
+	Fields    []FieldPredicate
+	From      time.Time
+	To        time.Time
+	After     *SearchCursor
+	Limit     int
+}
+
+// LogSearchResult is a matching log with its highlighted snippet
+type LogSearchResult struct {
+	types.LogRecord
+	Level   string `json:"level,omitempty"`
+	Logger  string `json:"logger,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// LogSearchPage is a page of search results
+type LogSearchPage struct {
+	Results    []LogSearchResult `json:"results"`
+	NextCursor *SearchCursor     `json:"-"`
+}
+
+// SearchLogs runs a full-text, regex and structured search over logs. It
+// runs for at most searchTimeout.
+func (c *Client) SearchLogs(ctx context.Context, s LogSearch) (*LogSearchPage, error) {
+	if len(s.Regex) > MaxSearchRegexLength {
+		return nil, fmt.Errorf("%w: regex longer than %d characters", ErrInvalidSearch, MaxSearchRegexLength)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions = append(conditions,
+		"timestamp >= "+arg(s.From),
+		"timestamp <= "+arg(s.To),
+	)
+
+	if s.ClientID != "" {
+		conditions = append(conditions, "client_id = "+arg(s.ClientID))
+	}
+	if s.RunID != "" {
+		conditions = append(conditions, "run_id = "+arg(s.RunID))
+	}
+	if len(s.Levels) > 0 {
+		conditions = append(conditions, "level = ANY("+arg(s.Levels)+")")
+	}
+	if s.Logger != "" {
+		conditions = append(conditions, "logger = "+arg(s.Logger))
+	}
+	if s.ProcessID != nil {
+		conditions = append(conditions, "process_id = "+arg(*s.ProcessID))
+	}
+
+	// Snippets highlight the full-text match, or the regex match otherwise
+	snippet := "NULL"
+	if s.Text != "" {
+		tsQuery := "websearch_to_tsquery('english', " + arg(s.Text) + ")"
+		conditions = append(conditions, "to_tsvector('english', COALESCE(msg, '')) @@ "+tsQuery)
+		snippet = fmt.Sprintf("ts_headline('english', COALESCE(msg, ''), %s, %s)",
+			tsQuery, arg("StartSel="+HighlightStart+", StopSel="+HighlightStop+", MaxFragments=2"))
+	}
+	if s.Regex != "" {
+		pattern := arg(s.Regex)
+		conditions = append(conditions, "msg ~ "+pattern)
+		if s.Text == "" {
+			snippet = fmt.Sprintf("regexp_replace(msg, %s, %s, 'g')", pattern, arg(HighlightStart+`\&`+HighlightStop))
+		}
+	}
+
+	for _, p := range s.Fields {
+		condition, err := fieldCondition("fields", p, arg)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if s.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(timestamp_ns, client_id, run_id, seq) < (%s, %s, %s, %s)",
+			arg(s.After.Timestamp), arg(s.After.ClientID), arg(s.After.RunID), arg(s.After.Seq)))
+	}
+
+	query := `
+		SELECT ` + logSelectColumns + `, COALESCE(level, ''), COALESCE(logger, ''), ` + snippet + `
+		FROM logs
+		WHERE ` + strings.Join(conditions, "\n\t\tAND ") + `
+		ORDER BY timestamp_ns DESC, client_id DESC, run_id DESC, seq DESC
+		LIMIT ` + arg(s.Limit)
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("starting search: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", searchTimeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("limiting search time: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, searchError(err)
+	}
+	defer rows.Close()
+
+	page := &LogSearchPage{Results: []LogSearchResult{}}
+	for rows.Next() {
+		var result LogSearchResult
+		var processID *int32
+		var snippetText *string
+		if err := rows.Scan(
+			&result.Timestamp,
+			&result.Seq,
+			&result.ClientID,
+			&result.RunID,
+			&result.Message,
+			&processID,
+			&result.Level,
+			&result.Logger,
+			&snippetText,
+		); err != nil {
+			return nil, fmt.Errorf("scanning search result: %w", err)
+		}
+		if processID != nil {
+			result.ProcessID = strconv.Itoa(int(*processID))
+		}
+		if snippetText != nil {
+			result.Snippet = *snippetText
+		}
+		c.decodeLog(&result.LogRecord)
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, searchError(err)
+	}
+
+	if len(page.Results) == s.Limit {
+		last := page.Results[len(page.Results)-1]
+		page.NextCursor = &SearchCursor{Timestamp: last.Timestamp, ClientID: last.ClientID, RunID: last.RunID, Seq: last.Seq}
+	}
+
+	return page, nil
+}
+
+// fieldCondition builds the SQL condition for a predicate on a key of a JSONB
+// column
+func fieldCondition(column string, p FieldPredicate, arg func(interface{}) string) (string, error) {
+	if p.Key == "" {
+		return "", fmt.Errorf("%w: empty field name", ErrInvalidSearch)
+	}
+
+	key := arg(p.Key)
+	numeric := fmt.Sprintf("(CASE WHEN jsonb_typeof(%[1]s -> %[2]s) = 'number' THEN (%[1]s ->> %[2]s)::numeric END)", column, key)
+
+	switch p.Op {
+	case FieldOpEq, "":
+		return fmt.Sprintf("%s ->> %s = %s", column, key, arg(p.Value)), nil
+	case FieldOpNe:
+		return fmt.Sprintf("%s ->> %s IS DISTINCT FROM %s", column, key, arg(p.Value)), nil
+	case FieldOpContains:
+		return fmt.Sprintf("%s ->> %s ILIKE '%%' || %s || '%%'", column, key, arg(p.Value)), nil
+	case FieldOpExists:
+		return fmt.Sprintf("%s ? %s", column, key), nil
+	case FieldOpGt, FieldOpGte, FieldOpLt, FieldOpLte:
+		value, err := strconv.ParseFloat(p.Value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%w: field %s needs a numeric value", ErrInvalidSearch, p.Key)
+		}
+		operators := map[string]string{FieldOpGt: ">", FieldOpGte: ">=", FieldOpLt: "<", FieldOpLte: "<="}
+		return fmt.Sprintf("%s %s %s", numeric, operators[p.Op], arg(value)), nil
+	default:
+		return "", fmt.Errorf("%w: unknown operator %q", ErrInvalidSearch, p.Op)
+	}
+}
+
+// searchError maps user-caused database errors to ErrInvalidSearch
+func searchError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "2201B":
+			return fmt.Errorf("%w: %s", ErrInvalidSearch, pgErr.Message)
+		case "57014":
+			return fmt.Errorf("%w: search took longer than %s, narrow it down", ErrInvalidSearch, searchTimeout)
+		}
+	}
+	return fmt.Errorf("searching logs: %w", err)
+}
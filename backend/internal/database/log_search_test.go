@@ -0,0 +1,122 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFieldCondition(t *testing.T) {
+	number := "(CASE WHEN jsonb_typeof(fields -> $1) = 'number' THEN (fields ->> $1)::numeric END)"
+
+	tests := []struct {
+		name     string
+		p        FieldPredicate
+		want     string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "eq",
+			p:        FieldPredicate{Key: "optimizer", Op: FieldOpEq, Value: "adam"},
+			want:     "fields ->> $1 = $2",
+			wantArgs: []interface{}{"optimizer", "adam"},
+		},
+		{
+			name:     "no operator is eq",
+			p:        FieldPredicate{Key: "optimizer", Value: "adam"},
+			want:     "fields ->> $1 = $2",
+			wantArgs: []interface{}{"optimizer", "adam"},
+		},
+		{
+			name:     "ne",
+			p:        FieldPredicate{Key: "optimizer", Op: FieldOpNe, Value: "sgd"},
+			want:     "fields ->> $1 IS DISTINCT FROM $2",
+			wantArgs: []interface{}{"optimizer", "sgd"},
+		},
+		{
+			name:     "contains",
+			p:        FieldPredicate{Key: "path", Op: FieldOpContains, Value: "50%"},
+			want:     "fields ->> $1 ILIKE '%' || $2 || '%'",
+			wantArgs: []interface{}{"path", "50%"},
+		},
+		{
+			name:     "exists",
+			p:        FieldPredicate{Key: "epoch", Op: FieldOpExists},
+			want:     "fields ? $1",
+			wantArgs: []interface{}{"epoch"},
+		},
+		{
+			name:     "gt",
+			p:        FieldPredicate{Key: "loss", Op: FieldOpGt, Value: "0.5"},
+			want:     number + " > $2",
+			wantArgs: []interface{}{"loss", 0.5},
+		},
+		{
+			name:     "gte",
+			p:        FieldPredicate{Key: "loss", Op: FieldOpGte, Value: "1"},
+			want:     number + " >= $2",
+			wantArgs: []interface{}{"loss", 1.0},
+		},
+		{
+			name:     "lt",
+			p:        FieldPredicate{Key: "loss", Op: FieldOpLt, Value: "-2.5"},
+			want:     number + " < $2",
+			wantArgs: []interface{}{"loss", -2.5},
+		},
+		{
+			name:     "lte",
+			p:        FieldPredicate{Key: "loss", Op: FieldOpLte, Value: "1e3"},
+			want:     number + " <= $2",
+			wantArgs: []interface{}{"loss", 1000.0},
+		},
+		{
+			name:    "comparison with a word",
+			p:       FieldPredicate{Key: "loss", Op: FieldOpGt, Value: "high"},
+			wantErr: true,
+		},
+		{
+			name:    "comparison without a value",
+			p:       FieldPredicate{Key: "loss", Op: FieldOpLt},
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			p:       FieldPredicate{Op: FieldOpEq, Value: "adam"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			p:       FieldPredicate{Key: "loss", Op: "like", Value: "a%"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []interface{}
+			arg := func(v interface{}) string {
+				args = append(args, v)
+				return fmt.Sprintf("$%d", len(args))
+			}
+
+			got, err := fieldCondition("fields", tt.p, arg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSearch) {
+					t.Fatalf("fieldCondition() error = %v, want ErrInvalidSearch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fieldCondition() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("fieldCondition() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("fieldCondition() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
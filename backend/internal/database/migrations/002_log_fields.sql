@@ -0,0 +1,10 @@
+-- Decoded log fields populated at ingest time
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS level TEXT;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS logger TEXT;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS msg TEXT;
+
+-- Per-level summaries
+CREATE INDEX IF NOT EXISTS idx_logs_client_level ON logs (client_id, level, timestamp DESC);
+
+-- Existing rows keep NULL columns until the backend backfills them by
+-- decoding the stored frames (database.Client.BackfillLogFields)
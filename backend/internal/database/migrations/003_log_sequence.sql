@@ -0,0 +1,18 @@
+-- Nanosecond timestamps and per-client sequence numbers for logs.
+-- TIMESTAMPTZ only has microsecond resolution, so the full timestamp is kept
+-- in timestamp_ns and (timestamp_ns, seq) defines the order of log lines.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS timestamp_ns BIGINT;
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+
+UPDATE logs
+SET timestamp_ns = (EXTRACT(EPOCH FROM timestamp) * 1000000)::BIGINT * 1000
+WHERE timestamp_ns IS NULL;
+
+ALTER TABLE logs ALTER COLUMN timestamp_ns SET NOT NULL;
+
+-- Allow many log lines per client and timestamp. Compressed chunks must be
+-- decompressed before the constraint can be replaced.
+ALTER TABLE logs DROP CONSTRAINT IF EXISTS logs_pkey;
+ALTER TABLE logs ADD PRIMARY KEY (timestamp, client_id, seq);
+
+CREATE INDEX IF NOT EXISTS idx_logs_client_order ON logs (client_id, timestamp_ns, seq);
@@ -0,0 +1,15 @@
+-- Structured fields of decoded log records for field predicates
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS fields JSONB;
+
+-- Full-text search over log messages
+CREATE INDEX IF NOT EXISTS idx_logs_msg_fts ON logs USING GIN (to_tsvector('english', COALESCE(msg, '')));
+
+-- Trigram index to speed up regex search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_logs_msg_trgm ON logs USING GIN (msg gin_trgm_ops);
+
+-- Containment queries over structured fields
+CREATE INDEX IF NOT EXISTS idx_logs_fields ON logs USING GIN (fields jsonb_path_ops);
+
+-- Existing rows get fields from the backend backfill
+-- (database.Client.BackfillLogFields)
@@ -0,0 +1,20 @@
+-- Per-run identity. A client can have several concurrent and historical runs,
+-- each addressed by its own run_id.
+ALTER TABLE logs ADD COLUMN IF NOT EXISTS run_id TEXT NOT NULL DEFAULT '';
+
+-- Sequence numbers are per run, so the run is part of the log key
+ALTER TABLE logs DROP CONSTRAINT IF EXISTS logs_pkey;
+ALTER TABLE logs ADD PRIMARY KEY (timestamp, client_id, run_id, seq);
+
+CREATE INDEX IF NOT EXISTS idx_logs_run_order ON logs (run_id, timestamp_ns, seq);
+
+-- Status is tracked per run. Existing rows predate runs and use the client
+-- ID as their run ID.
+ALTER TABLE model_status ADD COLUMN IF NOT EXISTS run_id TEXT;
+UPDATE model_status SET run_id = client_id WHERE run_id IS NULL;
+ALTER TABLE model_status ALTER COLUMN run_id SET NOT NULL;
+
+ALTER TABLE model_status DROP CONSTRAINT IF EXISTS model_status_pkey;
+ALTER TABLE model_status ADD PRIMARY KEY (run_id);
+
+CREATE INDEX IF NOT EXISTS idx_model_status_client ON model_status (client_id, timestamp DESC);
@@ -0,0 +1,44 @@
+-- Persistent run history. model_runs holds the current state of every run
+-- and model_run_events every lifecycle transition, replacing the one row per
+-- run kept in model_status.
+CREATE TABLE IF NOT EXISTS model_runs (
+    run_id       TEXT PRIMARY KEY,
+    client_id    TEXT NOT NULL,
+    process_type TEXT NOT NULL DEFAULT '',
+    status       TEXT NOT NULL,
+    message      TEXT,
+    config       JSONB,
+    process_id   INTEGER,
+    exit_reason  TEXT,
+    metrics      JSONB,
+    created_at   TIMESTAMPTZ NOT NULL,
+    started_at   TIMESTAMPTZ,
+    ended_at     TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_runs_client ON model_runs (client_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_model_runs_created ON model_runs (created_at DESC);
+
+CREATE TABLE IF NOT EXISTS model_run_events (
+    id          BIGSERIAL PRIMARY KEY,
+    event_id    TEXT NOT NULL UNIQUE,
+    run_id      TEXT NOT NULL REFERENCES model_runs (run_id) ON DELETE CASCADE,
+    event_type  TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    message     TEXT,
+    progress    INTEGER,
+    timestamp   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_run_events_run ON model_run_events (run_id, timestamp);
+
+-- Carry over the last known state of existing runs
+INSERT INTO model_runs (run_id, client_id, process_type, status, message, created_at, started_at, ended_at, updated_at)
+SELECT run_id, client_id, process_type, status, message, timestamp, timestamp,
+       CASE WHEN status IN ('completed', 'error') THEN timestamp END,
+       timestamp
+FROM model_status
+ON CONFLICT (run_id) DO NOTHING;
+
+DROP TABLE IF EXISTS model_status;
@@ -0,0 +1,16 @@
+-- Persistent job queue of the ML orchestrator. Jobs wait in the queued state
+-- until a slot is free under the concurrency limits, are dispatched in
+-- (priority, position) order and are removed once their run ends.
+CREATE TABLE IF NOT EXISTS job_queue (
+    run_id        TEXT PRIMARY KEY,
+    client_id     TEXT NOT NULL,
+    process_type  TEXT NOT NULL,
+    priority      INTEGER NOT NULL,
+    position      BIGSERIAL,
+    payload       BYTEA NOT NULL,
+    state         TEXT NOT NULL DEFAULT 'queued',
+    enqueued_at   TIMESTAMPTZ NOT NULL,
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_queue_order ON job_queue (state, priority, position);
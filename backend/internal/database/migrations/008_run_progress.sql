@@ -0,0 +1,3 @@
+-- Structured progress of a run (phase, epoch, step, percent and ETA), as
+-- last reported by its process
+ALTER TABLE model_runs ADD COLUMN IF NOT EXISTS progress JSONB;
@@ -0,0 +1,15 @@
+-- Training metrics of runs, such as loss or accuracy per step, as a
+-- hypertable so long runs can be downsampled with time_bucket
+CREATE TABLE IF NOT EXISTS run_metrics (
+    time      TIMESTAMPTZ NOT NULL,
+    run_id    TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    name      TEXT NOT NULL,
+    step      BIGINT NOT NULL DEFAULT 0,
+    value     DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (run_id, name, step, time)
+);
+
+SELECT create_hypertable('run_metrics', 'time', if_not_exists => TRUE);
+
+CREATE INDEX IF NOT EXISTS idx_run_metrics_name_step ON run_metrics (name, run_id, step);
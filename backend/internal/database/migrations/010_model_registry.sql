@@ -0,0 +1,30 @@
+-- Model registry. Each successful training run registers a model version;
+-- model_version_events is the audit trail of registrations and stage
+-- transitions.
+CREATE TABLE IF NOT EXISTS model_versions (
+    id         TEXT PRIMARY KEY,
+    client_id  TEXT NOT NULL,
+    name       TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    run_id     TEXT NOT NULL UNIQUE,
+    stage      TEXT NOT NULL DEFAULT 'none',
+    config     JSONB,
+    metrics    JSONB,
+    artifact   TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (client_id, name, version)
+);
+
+CREATE TABLE IF NOT EXISTS model_version_events (
+    id         BIGSERIAL PRIMARY KEY,
+    version_id TEXT NOT NULL REFERENCES model_versions (id) ON DELETE CASCADE,
+    from_stage TEXT,
+    to_stage   TEXT NOT NULL,
+    actor      TEXT NOT NULL,
+    reason     TEXT,
+    timestamp  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_model_versions_stage ON model_versions (client_id, name, stage);
+CREATE INDEX IF NOT EXISTS idx_model_version_events_version ON model_version_events (version_id, timestamp);
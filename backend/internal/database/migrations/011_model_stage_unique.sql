@@ -0,0 +1,2 @@
+-- A model has at most one version in staging and one in production
+CREATE UNIQUE INDEX IF NOT EXISTS idx_model_versions_one_per_stage ON model_versions (client_id, name, stage) WHERE stage IN ('staging', 'production');
@@ -0,0 +1,3 @@
+-- Logs still waiting for the decoded column backfill, so finding them does
+-- not scan the whole table at every startup
+CREATE INDEX IF NOT EXISTS idx_logs_backfill ON logs (timestamp) WHERE level IS NULL OR fields IS NULL;
@@ -0,0 +1,17 @@
+-- migrations/000002_create_password_resets_table.up.sql
+CREATE TABLE password_resets
+(
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP
+    WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP
+    WITH TIME ZONE,
+    created_at TIMESTAMP
+    WITH TIME ZONE NOT NULL
+);
+
+    CREATE INDEX idx_password_resets_user ON password_resets(user_id);
+
+    -- migrations/000002_create_password_resets_table.down.sql
+    DROP TABLE IF EXISTS password_resets;
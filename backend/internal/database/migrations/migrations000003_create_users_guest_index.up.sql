@@ -0,0 +1,5 @@
+-- migrations/000003_create_users_guest_index.up.sql
+CREATE INDEX idx_users_type_created ON users(user_type, created_at);
+
+    -- migrations/000003_create_users_guest_index.down.sql
+    DROP INDEX IF EXISTS idx_users_type_created;
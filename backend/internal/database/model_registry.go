@@ -0,0 +1,420 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrModelVersionNotFound is returned when a model version or alias does
+	// not exist
+	ErrModelVersionNotFound = errors.New("model version not found")
+	// ErrRunNotRegistrable is returned when registering a run that is not a
+	// completed training run
+	ErrRunNotRegistrable = errors.New("run is not a completed training run")
+	// ErrInvalidStage is returned for stages model versions cannot be in
+	ErrInvalidStage = errors.New("invalid model stage")
+)
+
+// DefaultModelName is the name of models trained without a model_name in
+// their config
+const DefaultModelName = "default"
+
+// RegistryActor is the actor recorded for registrations and for versions
+// archived when another version takes their stage
+const RegistryActor = "registry"
+
+// AliasLatest resolves to the newest version of a model that is not archived
+const AliasLatest = "latest"
+
+// modelVersionColumns are the columns read by scanModelVersion
+const modelVersionColumns = `id, client_id, name, version, run_id, stage, config, metrics,
+	artifact, created_at, updated_at`
+
+// ModelVersionFilter selects model versions. Empty fields match all.
+type ModelVersionFilter struct {
+	ClientID string
+	Name     string
+	Stage    string
+}
+
+// RegisterModelVersion registers a completed training run as the next
+// version of its model. The model is named by model_name in the run's
+// config; the version takes the run's config, its reported metrics with
+// the last value of each stored metric series, and the artifact the run
+// saved. Registering a run again returns its version and false.
+func (c *Client) RegisterModelVersion(ctx context.Context, runID, artifact string) (*types.ModelVersion, bool, error) {
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("starting model registration: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if existing, err := scanModelVersion(tx.QueryRow(ctx,
+		`SELECT `+modelVersionColumns+` FROM model_versions WHERE run_id = $1`, runID)); err == nil {
+		return existing, false, nil
+	} else if !errors.Is(err, ErrModelVersionNotFound) {
+		return nil, false, err
+	}
+
+	var clientID, processType, status string
+	var configJSON, metricsJSON []byte
+	err = tx.QueryRow(ctx, `
+		SELECT client_id, process_type, status, config, metrics FROM model_runs WHERE run_id = $1
+	`, runID).Scan(&clientID, &processType, &status, &configJSON, &metricsJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("looking up run: %w", err)
+	}
+	if processType != "train" || status != types.StatusCompleted {
+		return nil, false, ErrRunNotRegistrable
+	}
+
+	var config interface{}
+	if configJSON != nil {
+		if err := json.Unmarshal(configJSON, &config); err != nil {
+			return nil, false, fmt.Errorf("decoding run config: %w", err)
+		}
+	}
+	metrics := make(map[string]interface{})
+	if metricsJSON != nil {
+		if err := json.Unmarshal(metricsJSON, &metrics); err != nil {
+			return nil, false, fmt.Errorf("decoding run metrics: %w", err)
+		}
+	}
+	if err := finalMetrics(ctx, tx, runID, metrics); err != nil {
+		return nil, false, err
+	}
+
+	name := modelName(config)
+
+	// Versions of a model are numbered one at a time
+	if err := lockModel(ctx, tx, clientID, name); err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now()
+	version, err := scanModelVersion(tx.QueryRow(ctx, `
+		INSERT INTO model_versions (id, client_id, name, version, run_id, stage, config, metrics,
+			artifact, created_at, updated_at)
+		SELECT $1, $2, $3, COALESCE(MAX(version), 0) + 1, $4, $5, $6, $7, $8, $9, $9
+		FROM model_versions WHERE client_id = $2 AND name = $3
+		RETURNING `+modelVersionColumns,
+		uuid.New().String(), clientID, name, runID, types.StageNone,
+		jsonValue(config), jsonValue(metrics), nullString(artifact), now))
+	if err != nil {
+		return nil, false, fmt.Errorf("registering model version: %w", err)
+	}
+
+	err = recordStageEvent(ctx, tx, version.ID, "", types.StageNone, RegistryActor,
+		fmt.Sprintf("Registered from run %s", runID), now)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("committing model registration: %w", err)
+	}
+	return version, true, nil
+}
+
+// TransitionModelVersion moves a model version to a stage and records who
+// moved it and why. A version promoted to staging or production takes the
+// place of the version in that stage, which is archived. Moving a version
+// to the stage it is in changes nothing.
+func (c *Client) TransitionModelVersion(ctx context.Context, id, stage, actor, reason string) (*types.ModelVersion, error) {
+	if !types.IsModelStage(stage) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStage, stage)
+	}
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("starting stage transition: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	version, err := scanModelVersion(tx.QueryRow(ctx,
+		`SELECT `+modelVersionColumns+` FROM model_versions WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// Transitions of a model's versions happen one at a time, so concurrent
+	// promotions cannot both keep their stage
+	if err := lockModel(ctx, tx, version.ClientID, version.Name); err != nil {
+		return nil, err
+	}
+	version, err = scanModelVersion(tx.QueryRow(ctx,
+		`SELECT `+modelVersionColumns+` FROM model_versions WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	if version.Stage == stage {
+		return version, nil
+	}
+
+	now := time.Now()
+	if stage == types.StageStaging || stage == types.StageProduction {
+		rows, err := tx.Query(ctx, `
+			UPDATE model_versions SET stage = $4, updated_at = $5
+			WHERE client_id = $1 AND name = $2 AND stage = $3
+			RETURNING id
+		`, version.ClientID, version.Name, stage, types.StageArchived, now)
+		if err != nil {
+			return nil, fmt.Errorf("archiving replaced versions: %w", err)
+		}
+		var replaced []string
+		for rows.Next() {
+			var replacedID string
+			if err := rows.Scan(&replacedID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scanning replaced version: %w", err)
+			}
+			replaced = append(replaced, replacedID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("archiving replaced versions: %w", err)
+		}
+
+		for _, replacedID := range replaced {
+			err := recordStageEvent(ctx, tx, replacedID, stage, types.StageArchived, RegistryActor,
+				fmt.Sprintf("Replaced in %s by version %d", stage, version.Version), now)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE model_versions SET stage = $2, updated_at = $3 WHERE id = $1`, id, stage, now)
+	if err != nil {
+		return nil, fmt.Errorf("updating model stage: %w", err)
+	}
+	if err := recordStageEvent(ctx, tx, id, version.Stage, stage, actor, reason, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing stage transition: %w", err)
+	}
+	version.Stage, version.UpdatedAt = stage, now
+	return version, nil
+}
+
+// GetModelVersion returns a single model version
+func (c *Client) GetModelVersion(ctx context.Context, id string) (*types.ModelVersion, error) {
+	return scanModelVersion(c.pool.QueryRow(ctx,
+		`SELECT `+modelVersionColumns+` FROM model_versions WHERE id = $1`, id))
+}
+
+// ResolveModelVersion returns the version of a client's model named by ref:
+// a version ID, or name@alias where the alias is a version number, a stage
+// or latest. A bare name is the model's production version.
+func (c *Client) ResolveModelVersion(ctx context.Context, clientID, ref string) (*types.ModelVersion, error) {
+	name, alias, ok := strings.Cut(ref, "@")
+	if !ok {
+		if version, err := c.GetModelVersion(ctx, ref); err == nil {
+			if version.ClientID != clientID {
+				return nil, ErrModelVersionNotFound
+			}
+			return version, nil
+		} else if !errors.Is(err, ErrModelVersionNotFound) {
+			return nil, err
+		}
+		alias = types.StageProduction
+	}
+	if name == "" || alias == "" {
+		return nil, ErrModelVersionNotFound
+	}
+
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions WHERE client_id = $1 AND name = $2`
+	var arg interface{}
+	switch {
+	case alias == AliasLatest:
+		query += ` AND stage <> $3`
+		arg = types.StageArchived
+	case types.IsModelStage(alias):
+		query += ` AND stage = $3`
+		arg = alias
+	default:
+		number, err := strconv.Atoi(strings.TrimPrefix(alias, "v"))
+		if err != nil {
+			return nil, ErrModelVersionNotFound
+		}
+		query += ` AND version = $3`
+		arg = number
+	}
+
+	return scanModelVersion(c.pool.QueryRow(ctx, query+` ORDER BY version DESC LIMIT 1`, clientID, name, arg))
+}
+
+// LatestModelVersion returns a client's most recently registered version
+// that is not archived, of any model
+func (c *Client) LatestModelVersion(ctx context.Context, clientID string) (*types.ModelVersion, error) {
+	return scanModelVersion(c.pool.QueryRow(ctx, `SELECT `+modelVersionColumns+` FROM model_versions
+		WHERE client_id = $1 AND stage <> $2
+		ORDER BY created_at DESC, version DESC LIMIT 1`, clientID, types.StageArchived))
+}
+
+// ListModelVersions returns the model versions matching a filter by model
+// name, newest version first
+func (c *Client) ListModelVersions(ctx context.Context, f ModelVersionFilter) ([]types.ModelVersion, error) {
+	var conditions []string
+	var args []interface{}
+	for column, value := range map[string]string{"client_id": f.ClientID, "name": f.Name, "stage": f.Stage} {
+		if value != "" {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+		}
+	}
+
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	rows, err := c.pool.Query(ctx, query+` ORDER BY name, version DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("listing model versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []types.ModelVersion{}
+	for rows.Next() {
+		version, err := scanModelVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading model versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetModelVersionEvents returns the audit trail of a model version in order
+func (c *Client) GetModelVersionEvents(ctx context.Context, id string) ([]types.ModelVersionEvent, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT id, version_id, COALESCE(from_stage, ''), to_stage, actor, COALESCE(reason, ''), timestamp
+		FROM model_version_events
+		WHERE version_id = $1
+		ORDER BY timestamp, id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("querying model version events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []types.ModelVersionEvent{}
+	for rows.Next() {
+		var e types.ModelVersionEvent
+		if err := rows.Scan(&e.ID, &e.VersionID, &e.FromStage, &e.ToStage, &e.Actor, &e.Reason, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("scanning model version event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading model version events: %w", err)
+	}
+	return events, nil
+}
+
+// finalMetrics adds the last value of each metric series of a run to
+// metrics, keeping values the run reported itself
+func finalMetrics(ctx context.Context, tx pgx.Tx, runID string, metrics map[string]interface{}) error {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (name) name, value
+		FROM run_metrics
+		WHERE run_id = $1
+		ORDER BY name, step DESC, time DESC
+	`, runID)
+	if err != nil {
+		return fmt.Errorf("querying final metrics: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return fmt.Errorf("scanning final metric: %w", err)
+		}
+		if _, ok := metrics[name]; !ok {
+			metrics[name] = value
+		}
+	}
+	return rows.Err()
+}
+
+// lockModel serialises changes to the versions of a model until the
+// transaction ends
+func lockModel(ctx context.Context, tx pgx.Tx, clientID, name string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, clientID+"/"+name); err != nil {
+		return fmt.Errorf("locking model versions: %w", err)
+	}
+	return nil
+}
+
+// recordStageEvent appends a stage change to a model version's audit trail
+func recordStageEvent(ctx context.Context, tx pgx.Tx, versionID, from, to, actor, reason string, at time.Time) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO model_version_events (version_id, from_stage, to_stage, actor, reason, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, versionID, nullString(from), to, actor, nullString(reason), at)
+	if err != nil {
+		return fmt.Errorf("recording model version event: %w", err)
+	}
+	return nil
+}
+
+// modelName returns the model_name of a training config
+func modelName(config interface{}) string {
+	if m, ok := config.(map[string]interface{}); ok {
+		if name, ok := m["model_name"].(string); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return DefaultModelName
+}
+
+// scanModelVersion reads a row selected with modelVersionColumns
+func scanModelVersion(row pgx.Row) (*types.ModelVersion, error) {
+	var v types.ModelVersion
+	var config, metrics []byte
+	var artifact *string
+	err := row.Scan(&v.ID, &v.ClientID, &v.Name, &v.Version, &v.RunID, &v.Stage,
+		&config, &metrics, &artifact, &v.CreatedAt, &v.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrModelVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning model version: %w", err)
+	}
+
+	if artifact != nil {
+		v.Artifact = *artifact
+	}
+	if config != nil {
+		if err := json.Unmarshal(config, &v.Config); err != nil {
+			return nil, fmt.Errorf("decoding model config: %w", err)
+		}
+	}
+	if metrics != nil {
+		if err := json.Unmarshal(metrics, &v.Metrics); err != nil {
+			return nil, fmt.Errorf("decoding model metrics: %w", err)
+		}
+	}
+	return &v, nil
+}
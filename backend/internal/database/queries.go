@@ -18,12 +18,12 @@ type LogQuery struct {
 
 func (c *Client) QueryLogs(ctx context.Context, q LogQuery) ([]types.LogRecord, error) {
 	query := `
-        SELECT timestamp, client_id, message, process_id 
+        SELECT ` + logSelectColumns + `
         FROM logs 
         WHERE client_id = $1 
         AND timestamp >= $2 
         AND timestamp <= $3 
-        ORDER BY timestamp DESC
+        ORDER BY timestamp_ns DESC, seq DESC
         LIMIT $4 OFFSET $5
     `
 
@@ -36,13 +36,8 @@ func (c *Client) QueryLogs(ctx context.Context, q LogQuery) ([]types.LogRecord,
 
 	var logs []types.LogRecord
 	for rows.Next() {
-		var log types.LogRecord
-		if err := rows.Scan(
-			&log.Timestamp,
-			&log.ClientID,
-			&log.Message,
-			&log.ProcessID,
-		); err != nil {
+		log, err := c.scanLog(rows)
+		if err != nil {
 			return nil, err
 		}
 		logs = append(logs, log)
@@ -51,15 +46,19 @@ func (c *Client) QueryLogs(ctx context.Context, q LogQuery) ([]types.LogRecord,
 	return logs, nil
 }
 
+// GetModelStatus returns the status of a client's most recent run
 func (c *Client) GetModelStatus(ctx context.Context, clientID string) (*types.ModelStatus, error) {
 	query := `
-        SELECT status, message, timestamp, process_type
-        FROM model_status
+        SELECT run_id, status, COALESCE(message, ''), updated_at, process_type
+        FROM model_runs
         WHERE client_id = $1
+        ORDER BY created_at DESC
+        LIMIT 1
     `
 
 	var status types.ModelStatus
 	err := c.pool.QueryRow(ctx, query, clientID).Scan(
+		&status.RunID,
 		&status.Status,
 		&status.Message,
 		&status.Timestamp,
@@ -73,6 +72,8 @@ func (c *Client) GetModelStatus(ctx context.Context, clientID string) (*types.Mo
 	return &status, nil
 }
 
+// BatchInsertLogs inserts logs in a single transaction, skipping rows that
+// already exist
 func (c *Client) BatchInsertLogs(ctx context.Context, logs []types.LogRecord) error {
 	tx, err := c.pool.Begin(ctx)
 	if err != nil {
@@ -82,9 +83,10 @@ func (c *Client) BatchInsertLogs(ctx context.Context, logs []types.LogRecord) er
 
 	for _, log := range logs {
 		_, err := tx.Exec(ctx, `
-            INSERT INTO logs (timestamp, client_id, message, process_id)
-            VALUES ($1, $2, $3, $4)
-        `, log.Timestamp, log.ClientID, log.Message, log.ProcessID)
+            INSERT INTO logs (timestamp, timestamp_ns, seq, client_id, run_id, message, process_id, level, logger, msg, fields)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            ON CONFLICT DO NOTHING
+        `, logValues(log)...)
 		if err != nil {
 			return err
 		}
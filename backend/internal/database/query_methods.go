@@ -4,42 +4,8 @@ import (
 	"context"
 	"fmt"
 	"time"
-
-	"backend/internal/types"
 )
 
-// GetAllModelStatuses retrieves all model statuses
-func (c *Client) GetAllModelStatuses(ctx context.Context) ([]types.ModelStatus, error) {
-	query := `
-		SELECT client_id, status, message, timestamp, process_type
-		FROM model_status
-		ORDER BY timestamp DESC
-	`
-
-	rows, err := c.pool.Query(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("querying model statuses: %w", err)
-	}
-	defer rows.Close()
-
-	var statuses []types.ModelStatus
-	for rows.Next() {
-		var status types.ModelStatus
-		if err := rows.Scan(
-			&status.ClientID,
-			&status.Status,
-			&status.Message,
-			&status.Timestamp,
-			&status.ProcessType,
-		); err != nil {
-			return nil, fmt.Errorf("scanning model status: %w", err)
-		}
-		statuses = append(statuses, status)
-	}
-
-	return statuses, nil
-}
-
 // CountClientLogs counts logs for a client within a time range
 func (c *Client) CountClientLogs(ctx context.Context, clientID string, from, to time.Time) (int, error) {
 	query := `
@@ -61,25 +27,13 @@ func (c *Client) CountClientLogs(ctx context.Context, clientID string, from, to
 
 // GetLogCountsByLevel returns log counts grouped by log level
 func (c *Client) GetLogCountsByLevel(ctx context.Context, clientID string, from, to time.Time) (map[string]int, error) {
-	// Note: This is a simplified implementation that would need to be adapted
-	// to your actual log storage schema. Here, we're assuming you can extract
-	// a log level from your binary log data.
 	query := `
-		WITH unpacked_logs AS (
-			SELECT 
-				client_id,
-				timestamp,
-				-- This would need to be adjusted based on your actual log format
-				-- This is a placeholder for extracting log level from binary data
-				'INFO' as level
-			FROM logs
-			WHERE client_id = $1
-			AND timestamp >= $2
-			AND timestamp <= $3
-		)
-		SELECT level, COUNT(*)
-		FROM unpacked_logs
-		GROUP BY level
+		SELECT COALESCE(level, 'UNKNOWN') AS level, COUNT(*)
+		FROM logs
+		WHERE client_id = $1
+		AND timestamp >= $2
+		AND timestamp <= $3
+		GROUP BY 1
 	`
 
 	rows, err := c.pool.Query(ctx, query, clientID, from, to)
@@ -101,13 +55,43 @@ func (c *Client) GetLogCountsByLevel(ctx context.Context, clientID string, from,
 	return counts, nil
 }
 
+// GetRunLogCountsByLevel returns the log counts of a single run grouped by
+// log level
+func (c *Client) GetRunLogCountsByLevel(ctx context.Context, runID string) (map[string]int, error) {
+	query := `
+		SELECT COALESCE(level, 'UNKNOWN') AS level, COUNT(*)
+		FROM logs
+		WHERE run_id = $1
+		GROUP BY 1
+	`
+
+	rows, err := c.pool.Query(ctx, query, runID)
+	if err != nil {
+		return nil, fmt.Errorf("querying run log counts by level: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var level string
+		var count int
+		if err := rows.Scan(&level, &count); err != nil {
+			return nil, fmt.Errorf("scanning log level count: %w", err)
+		}
+		counts[level] = count
+	}
+
+	return counts, nil
+}
+
 // TimeSeriesBucket represents a time bucket with a count
 type TimeSeriesBucket struct {
-	Timestamp time.Time `json:"timestamp"`
-	Count     int       `json:"count"`
+	Timestamp time.Time      `json:"timestamp"`
+	Count     int            `json:"count"`
+	Levels    map[string]int `json:"levels"`
 }
 
-// GetLogRateOverTime returns log counts in time buckets
+// GetLogRateOverTime returns log counts in time buckets, broken down by level
 func (c *Client) GetLogRateOverTime(ctx context.Context, clientID string, from, to time.Time, buckets int) ([]TimeSeriesBucket, error) {
 	// Calculate bucket interval
 	interval := to.Sub(from) / time.Duration(buckets)
@@ -118,17 +102,18 @@ func (c *Client) GetLogRateOverTime(ctx context.Context, clientID string, from,
 	// Create a time-bucket query using TimescaleDB's time_bucket function
 	query := `
 		SELECT 
-			time_bucket($1, timestamp) AS bucket,
+			time_bucket(make_interval(secs => $1), timestamp) AS bucket,
+			COALESCE(level, 'UNKNOWN') AS level,
 			COUNT(*) as count
 		FROM logs
 		WHERE client_id = $2
 		AND timestamp >= $3
 		AND timestamp <= $4
-		GROUP BY bucket
+		GROUP BY bucket, 2
 		ORDER BY bucket
 	`
 
-	rows, err := c.pool.Query(ctx, query, interval.String(), clientID, from, to)
+	rows, err := c.pool.Query(ctx, query, interval.Seconds(), clientID, from, to)
 	if err != nil {
 		return nil, fmt.Errorf("querying log rates: %w", err)
 	}
@@ -137,19 +122,108 @@ func (c *Client) GetLogRateOverTime(ctx context.Context, clientID string, from,
 	var timeSeries []TimeSeriesBucket
 	for rows.Next() {
 		var bucket time.Time
+		var level string
 		var count int
-		if err := rows.Scan(&bucket, &count); err != nil {
+		if err := rows.Scan(&bucket, &level, &count); err != nil {
 			return nil, fmt.Errorf("scanning time bucket: %w", err)
 		}
-		timeSeries = append(timeSeries, TimeSeriesBucket{
-			Timestamp: bucket,
-			Count:     count,
-		})
+
+		// Rows arrive ordered by bucket, so levels for the same bucket are adjacent
+		if n := len(timeSeries); n == 0 || !timeSeries[n-1].Timestamp.Equal(bucket) {
+			timeSeries = append(timeSeries, TimeSeriesBucket{
+				Timestamp: bucket,
+				Levels:    make(map[string]int),
+			})
+		}
+		current := &timeSeries[len(timeSeries)-1]
+		current.Count += count
+		current.Levels[level] = count
 	}
 
 	return timeSeries, nil
 }
 
+// LogMessageCount is a distinct log message and how often it occurred
+type LogMessageCount struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// GetTopLogMessages returns the most frequent messages at the given levels
+func (c *Client) GetTopLogMessages(ctx context.Context, clientID string, from, to time.Time, levels []string, limit int) ([]LogMessageCount, error) {
+	query := `
+		SELECT level, msg, COUNT(*) AS count
+		FROM logs
+		WHERE client_id = $1
+		AND timestamp >= $2
+		AND timestamp <= $3
+		AND level = ANY($4)
+		AND msg IS NOT NULL
+		GROUP BY level, msg
+		ORDER BY count DESC, msg
+		LIMIT $5
+	`
+
+	rows, err := c.pool.Query(ctx, query, clientID, from, to, levels, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying top log messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []LogMessageCount
+	for rows.Next() {
+		var m LogMessageCount
+		if err := rows.Scan(&m.Level, &m.Message, &m.Count); err != nil {
+			return nil, fmt.Errorf("scanning log message count: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, nil
+}
+
+// GetTopLogMessageByClient returns the most frequent message at the given
+// levels of each client since its time in since, in a single query
+func (c *Client) GetTopLogMessageByClient(ctx context.Context, since map[string]time.Time, levels []string) (map[string]string, error) {
+	clientIDs := make([]string, 0, len(since))
+	froms := make([]time.Time, 0, len(since))
+	for clientID, from := range since {
+		clientIDs = append(clientIDs, clientID)
+		froms = append(froms, from)
+	}
+
+	messages := make(map[string]string, len(since))
+	if len(clientIDs) == 0 {
+		return messages, nil
+	}
+
+	rows, err := c.pool.Query(ctx, `
+		SELECT DISTINCT ON (logs.client_id) logs.client_id, logs.msg
+		FROM logs
+		JOIN unnest($1::text[], $2::timestamptz[]) AS clients (client_id, since)
+			ON logs.client_id = clients.client_id
+		WHERE logs.timestamp >= clients.since
+		AND logs.level = ANY($3)
+		AND logs.msg IS NOT NULL
+		GROUP BY logs.client_id, logs.msg
+		ORDER BY logs.client_id, COUNT(*) DESC, logs.msg
+	`, clientIDs, froms, levels)
+	if err != nil {
+		return nil, fmt.Errorf("querying top log messages by client: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clientID, message string
+		if err := rows.Scan(&clientID, &message); err != nil {
+			return nil, fmt.Errorf("scanning top log message: %w", err)
+		}
+		messages[clientID] = message
+	}
+	return messages, rows.Err()
+}
+
 // GetClientLogStats returns statistics about client logs
 func (c *Client) GetClientLogStats(ctx context.Context, clientID string) (map[string]interface{}, error) {
 	query := `
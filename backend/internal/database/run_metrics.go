@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/internal/types"
+)
+
+// Defaults and limits of metric queries
+const (
+	DefaultMetricPoints = 500
+	MaxMetricPoints     = 5000
+)
+
+// MetricQuery selects the metrics of a run. Points are averaged into
+// buckets of Bucket, or of the width that gives about Points buckets over
+// the selected time range when Bucket is zero.
+type MetricQuery struct {
+	RunID  string
+	Names  []string
+	From   time.Time
+	To     time.Time
+	Bucket time.Duration
+	Points int
+}
+
+// MetricBucket summarises the points of a metric in a time or step bucket
+type MetricBucket struct {
+	Time  time.Time `json:"time"`
+	Step  int64     `json:"step"`
+	Value float64   `json:"value"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int64     `json:"count"`
+}
+
+// MetricSeries is a run's downsampled metrics by name
+type MetricSeries struct {
+	RunID   string                    `json:"run_id"`
+	Bucket  float64                   `json:"bucket_seconds"`
+	Metrics map[string][]MetricBucket `json:"metrics"`
+}
+
+// MetricComparison is a metric of several runs by run, bucketed by step so
+// runs that started at different times line up
+type MetricComparison struct {
+	Name       string                    `json:"name"`
+	BucketStep int64                     `json:"bucket_steps"`
+	Runs       map[string][]MetricBucket `json:"runs"`
+}
+
+// InsertRunMetrics stores metric points, skipping points already stored,
+// and returns the number of new points
+func (c *Client) InsertRunMetrics(ctx context.Context, points []types.MetricPoint) (int64, error) {
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("starting metric insert: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var inserted int64
+	for _, p := range points {
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO run_metrics (time, run_id, client_id, name, step, value)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT DO NOTHING
+		`, p.Time, p.RunID, p.ClientID, p.Name, p.Step, p.Value)
+		if err != nil {
+			return 0, fmt.Errorf("inserting metric: %w", err)
+		}
+		inserted += tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("committing metrics: %w", err)
+	}
+	return inserted, nil
+}
+
+// QueryRunMetrics returns the metrics of a run downsampled with time_bucket
+func (c *Client) QueryRunMetrics(ctx context.Context, q MetricQuery) (*MetricSeries, error) {
+	from, to := q.From, q.To
+	if from.IsZero() || to.IsZero() {
+		var first, last *time.Time
+		err := c.pool.QueryRow(ctx, `
+			SELECT min(time), max(time) FROM run_metrics
+			WHERE run_id = $1 AND ($2::text[] IS NULL OR name = ANY($2))
+		`, q.RunID, nullStrings(q.Names)).Scan(&first, &last)
+		if err != nil {
+			return nil, fmt.Errorf("finding metric range: %w", err)
+		}
+		if first == nil {
+			return &MetricSeries{RunID: q.RunID, Metrics: map[string][]MetricBucket{}}, nil
+		}
+		if from.IsZero() {
+			from = *first
+		}
+		if to.IsZero() {
+			to = *last
+		}
+	}
+
+	bucket := q.Bucket
+	if bucket <= 0 {
+		points := q.Points
+		if points <= 0 || points > MaxMetricPoints {
+			points = DefaultMetricPoints
+		}
+		bucket = to.Sub(from) / time.Duration(points)
+	}
+	bucket = max(bucket, time.Millisecond)
+
+	rows, err := c.pool.Query(ctx, `
+		SELECT name, time_bucket(make_interval(secs => $2), time) AS bucket,
+			avg(value), min(value), max(value), max(step), count(*)
+		FROM run_metrics
+		WHERE run_id = $1 AND ($3::text[] IS NULL OR name = ANY($3))
+		AND time >= $4 AND time <= $5
+		GROUP BY name, bucket
+		ORDER BY name, bucket
+	`, q.RunID, bucket.Seconds(), nullStrings(q.Names), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("querying metrics: %w", err)
+	}
+	defer rows.Close()
+
+	series := &MetricSeries{
+		RunID:   q.RunID,
+		Bucket:  bucket.Seconds(),
+		Metrics: make(map[string][]MetricBucket),
+	}
+	for rows.Next() {
+		var name string
+		var b MetricBucket
+		if err := rows.Scan(&name, &b.Time, &b.Value, &b.Min, &b.Max, &b.Step, &b.Count); err != nil {
+			return nil, fmt.Errorf("scanning metric bucket: %w", err)
+		}
+		series.Metrics[name] = append(series.Metrics[name], b)
+	}
+	return series, rows.Err()
+}
+
+// CompareRunMetrics returns a metric of several runs bucketed by step into
+// about points buckets per run
+func (c *Client) CompareRunMetrics(ctx context.Context, runIDs []string, name string, points int) (*MetricComparison, error) {
+	if points <= 0 || points > MaxMetricPoints {
+		points = DefaultMetricPoints
+	}
+
+	var lastStep *int64
+	err := c.pool.QueryRow(ctx, `
+		SELECT max(step) FROM run_metrics WHERE run_id = ANY($1) AND name = $2
+	`, runIDs, name).Scan(&lastStep)
+	if err != nil {
+		return nil, fmt.Errorf("finding metric steps: %w", err)
+	}
+
+	comparison := &MetricComparison{Name: name, BucketStep: 1, Runs: make(map[string][]MetricBucket)}
+	for _, runID := range runIDs {
+		comparison.Runs[runID] = []MetricBucket{}
+	}
+	if lastStep == nil {
+		return comparison, nil
+	}
+	comparison.BucketStep = max(*lastStep/int64(points)+1, 1)
+
+	rows, err := c.pool.Query(ctx, `
+		SELECT run_id, (step / $3) * $3 AS bucket, min(time),
+			avg(value), min(value), max(value), count(*)
+		FROM run_metrics
+		WHERE run_id = ANY($1) AND name = $2
+		GROUP BY run_id, bucket
+		ORDER BY run_id, bucket
+	`, runIDs, name, comparison.BucketStep)
+	if err != nil {
+		return nil, fmt.Errorf("comparing metrics: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var runID string
+		var b MetricBucket
+		if err := rows.Scan(&runID, &b.Step, &b.Time, &b.Value, &b.Min, &b.Max, &b.Count); err != nil {
+			return nil, fmt.Errorf("scanning metric bucket: %w", err)
+		}
+		comparison.Runs[runID] = append(comparison.Runs[runID], b)
+	}
+	return comparison, rows.Err()
+}
+
+// nullStrings returns nil for an empty filter so the query matches all
+func nullStrings(values []string) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
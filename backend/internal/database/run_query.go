@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/types"
+)
+
+// ErrInvalidRunQuery is returned when a run history query cannot be run as
+// given, such as an unknown sort key
+var ErrInvalidRunQuery = errors.New("invalid run query")
+
+// Run history sort keys
+const (
+	RunSortStartTime = "start_time"
+	RunSortRuntime   = "runtime"
+	RunSortStatus    = "status"
+)
+
+// runSortKeys maps sort keys to their SQL expression and the type used to
+// compare cursor values. The runtime of an unfinished run is the time from
+// its start to its last update.
+var runSortKeys = map[string]struct {
+	expr string
+	cast string
+}{
+	RunSortStartTime: {"COALESCE(started_at, created_at)", "timestamptz"},
+	RunSortRuntime:   {"EXTRACT(EPOCH FROM COALESCE(ended_at, updated_at) - COALESCE(started_at, created_at))::float8", "float8"},
+	RunSortStatus:    {"status", "text"},
+}
+
+// RunCursor is the position of the last run of a history page: its sort value
+// as text and its run ID, which breaks ties
+type RunCursor struct {
+	SortBy string `json:"k"`
+	Value  string `json:"v"`
+	RunID  string `json:"r"`
+}
+
+// RunQuery describes a run history query
+type RunQuery struct {
+	ClientID    string
+	ProcessType string
+	Status      string
+	ExitReason  string
+	StartFrom   time.Time
+	StartTo     time.Time
+	MinRuntime  *float64
+	MaxRuntime  *float64
+	Config      []FieldPredicate
+	SortBy      string
+	Ascending   bool
+	After       *RunCursor
+	Limit       int
+	Offset      int
+}
+
+// RunPage is a page of runs with the total number of matching runs
+type RunPage struct {
+	Runs       []RunResult
+	Total      int
+	NextCursor *RunCursor
+}
+
+// RunResult is a run with its runtime in seconds
+type RunResult struct {
+	types.ModelRun
+	Runtime float64
+}
+
+// QueryRuns returns a sorted page of runs matching a query
+func (c *Client) QueryRuns(ctx context.Context, q RunQuery) (*RunPage, error) {
+	if q.SortBy == "" {
+		q.SortBy = RunSortStartTime
+	}
+	sortKey, ok := runSortKeys[q.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort key %q", ErrInvalidRunQuery, q.SortBy)
+	}
+	if q.After != nil && q.Offset != 0 {
+		return nil, fmt.Errorf("%w: offset cannot be combined with a cursor", ErrInvalidRunQuery)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.ClientID != "" {
+		conditions = append(conditions, "client_id = "+arg(q.ClientID))
+	}
+	if q.ProcessType != "" {
+		conditions = append(conditions, "process_type = "+arg(q.ProcessType))
+	}
+	if q.Status != "" {
+		conditions = append(conditions, "status = "+arg(q.Status))
+	}
+	if q.ExitReason != "" {
+		conditions = append(conditions, "exit_reason = "+arg(q.ExitReason))
+	}
+	if !q.StartFrom.IsZero() {
+		conditions = append(conditions, runSortKeys[RunSortStartTime].expr+" >= "+arg(q.StartFrom))
+	}
+	if !q.StartTo.IsZero() {
+		conditions = append(conditions, runSortKeys[RunSortStartTime].expr+" <= "+arg(q.StartTo))
+	}
+	if q.MinRuntime != nil {
+		conditions = append(conditions, runSortKeys[RunSortRuntime].expr+" >= "+arg(*q.MinRuntime))
+	}
+	if q.MaxRuntime != nil {
+		conditions = append(conditions, runSortKeys[RunSortRuntime].expr+" <= "+arg(*q.MaxRuntime))
+	}
+	for _, p := range q.Config {
+		condition, err := fieldCondition("config", p, arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRunQuery, err)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, "\n\t\tAND ")
+	}
+
+	page := &RunPage{Runs: []RunResult{}}
+	if err := c.pool.QueryRow(ctx, `SELECT COUNT(*) FROM model_runs `+where, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("counting runs: %w", err)
+	}
+
+	direction, comparison := "DESC", "<"
+	if q.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+
+	if q.After != nil {
+		if q.After.SortBy != q.SortBy {
+			return nil, fmt.Errorf("%w: cursor is for a different sort", ErrInvalidRunQuery)
+		}
+		condition := fmt.Sprintf("(%s, run_id) %s (%s::%s, %s)",
+			sortKey.expr, comparison, arg(q.After.Value), sortKey.cast, arg(q.After.RunID))
+		if where == "" {
+			where = "WHERE " + condition
+		} else {
+			where += "\n\t\tAND " + condition
+		}
+	}
+
+	query := `
+		SELECT ` + runColumns + `, ` + runSortKeys[RunSortRuntime].expr + `, (` + sortKey.expr + `)::text
+		FROM model_runs
+		` + where + `
+		ORDER BY ` + sortKey.expr + ` ` + direction + `, run_id ` + direction + `
+		LIMIT ` + arg(q.Limit) + ` OFFSET ` + arg(q.Offset)
+
+	rows, err := c.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %w", err)
+	}
+	defer rows.Close()
+
+	var lastValue string
+	for rows.Next() {
+		var result RunResult
+		run, err := scanRun(rows, &result.Runtime, &lastValue)
+		if err != nil {
+			return nil, err
+		}
+		result.ModelRun = *run
+		page.Runs = append(page.Runs, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading runs: %w", err)
+	}
+
+	if q.Limit > 0 && len(page.Runs) == q.Limit {
+		last := page.Runs[len(page.Runs)-1]
+		page.NextCursor = &RunCursor{SortBy: q.SortBy, Value: lastValue, RunID: last.RunID}
+	}
+
+	return page, nil
+}
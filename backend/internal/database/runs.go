@@ -0,0 +1,307 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrRunNotFound is returned when a run does not exist
+var ErrRunNotFound = errors.New("run not found")
+
+// RunCreatedEvent is the event type recorded when a run is first requested
+const RunCreatedEvent = "run.created"
+
+// RunTransition is a lifecycle change of a run. Zero-valued optional fields
+// leave the stored value unchanged.
+type RunTransition struct {
+	EventID     string
+	EventType   string
+	RunID       string
+	ClientID    string
+	ProcessType string
+	Status      string
+	Message     string
+	Progress    int
+	Config      interface{}
+	ProcessID   int
+	ExitReason  string
+	Metrics     map[string]interface{}
+	Timestamp   time.Time
+
+	// ProgressDetail replaces the stored progress when set
+	ProgressDetail *types.Progress
+}
+
+// runColumns are the columns read by scanRun
+const runColumns = `run_id, client_id, process_type, status, message, config, process_id,
+	exit_reason, metrics, progress, created_at, started_at, ended_at, updated_at`
+
+// CreateRun records a newly requested run as pending
+func (c *Client) CreateRun(ctx context.Context, runID, clientID, processType string, config interface{}) error {
+	_, err := c.RecordRunTransition(ctx, RunTransition{
+		EventID:     uuid.New().String(),
+		EventType:   RunCreatedEvent,
+		RunID:       runID,
+		ClientID:    clientID,
+		ProcessType: processType,
+		Status:      types.StatusPending,
+		Config:      config,
+		Timestamp:   time.Now(),
+	})
+	return err
+}
+
+// RecordRunTransition applies a transition to a run and appends it to the
+// run's event log. Transitions are idempotent by event ID; it returns false
+// if the event was already recorded. Once a run has ended it no longer
+// changes: later transitions, terminal or not, are only added to the event
+// log, so late events cannot revive or rewrite it.
+func (c *Client) RecordRunTransition(ctx context.Context, t RunTransition) (bool, error) {
+	if t.EventID == "" {
+		t.EventID = uuid.New().String()
+	}
+
+	var startedAt, endedAt *time.Time
+	if t.Status == types.StatusRunning {
+		startedAt = &t.Timestamp
+	}
+	if types.IsTerminalStatus(t.Status) {
+		endedAt = &t.Timestamp
+	}
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("starting run transition: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO model_runs (run_id, client_id, process_type, status, message, config, process_id,
+			exit_reason, metrics, progress, created_at, started_at, ended_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $13, $10, $11, $12, $10)
+		ON CONFLICT (run_id) DO UPDATE SET
+			process_type = COALESCE(NULLIF(EXCLUDED.process_type, ''), model_runs.process_type),
+			status = EXCLUDED.status,
+			message = COALESCE(NULLIF(EXCLUDED.message, ''), model_runs.message),
+			config = COALESCE(EXCLUDED.config, model_runs.config),
+			process_id = COALESCE(EXCLUDED.process_id, model_runs.process_id),
+			exit_reason = COALESCE(EXCLUDED.exit_reason, model_runs.exit_reason),
+			metrics = COALESCE(EXCLUDED.metrics, model_runs.metrics),
+			progress = COALESCE(EXCLUDED.progress, model_runs.progress),
+			started_at = COALESCE(model_runs.started_at, EXCLUDED.started_at),
+			ended_at = COALESCE(model_runs.ended_at, EXCLUDED.ended_at),
+			updated_at = EXCLUDED.updated_at
+		WHERE model_runs.ended_at IS NULL
+	`,
+		t.RunID,
+		t.ClientID,
+		t.ProcessType,
+		t.Status,
+		t.Message,
+		jsonValue(t.Config),
+		nullInt(t.ProcessID),
+		nullString(t.ExitReason),
+		jsonValue(t.Metrics),
+		t.Timestamp,
+		startedAt,
+		endedAt,
+		jsonValue(t.ProgressDetail),
+	)
+	if err != nil {
+		return false, fmt.Errorf("updating run: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO model_run_events (event_id, run_id, event_type, status, message, progress, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO NOTHING
+	`, t.EventID, t.RunID, t.EventType, t.Status, t.Message, nullInt(t.Progress), t.Timestamp)
+	if err != nil {
+		return false, fmt.Errorf("recording run event: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Redelivered event; leave the run as it was
+		return false, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("committing run transition: %w", err)
+	}
+	return true, nil
+}
+
+// GetRun returns a single run
+func (c *Client) GetRun(ctx context.Context, runID string) (*types.ModelRun, error) {
+	rows, err := c.pool.Query(ctx, `SELECT `+runColumns+` FROM model_runs WHERE run_id = $1`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("querying run: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("querying run: %w", err)
+		}
+		return nil, ErrRunNotFound
+	}
+	return scanRun(rows)
+}
+
+// ListRuns returns all runs, oldest first
+func (c *Client) ListRuns(ctx context.Context) ([]types.ModelRun, error) {
+	rows, err := c.pool.Query(ctx, `SELECT `+runColumns+` FROM model_runs ORDER BY created_at, run_id`)
+	if err != nil {
+		return nil, fmt.Errorf("querying runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []types.ModelRun
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// ListRunningRuns returns the runs that are running and have not ended
+func (c *Client) ListRunningRuns(ctx context.Context) ([]types.ModelRun, error) {
+	rows, err := c.pool.Query(ctx, `SELECT `+runColumns+` FROM model_runs
+		WHERE status = $1 AND ended_at IS NULL
+		ORDER BY created_at, run_id`, types.StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("listing running runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []types.ModelRun
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// GetRunEvents returns the recorded transitions of a run in order
+func (c *Client) GetRunEvents(ctx context.Context, runID string) ([]types.RunEvent, error) {
+	rows, err := c.pool.Query(ctx, `
+		SELECT event_id, run_id, event_type, status, COALESCE(message, ''), COALESCE(progress, 0), timestamp
+		FROM model_run_events
+		WHERE run_id = $1
+		ORDER BY timestamp, id
+	`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("querying run events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []types.RunEvent{}
+	for rows.Next() {
+		var e types.RunEvent
+		if err := rows.Scan(&e.EventID, &e.RunID, &e.EventType, &e.Status, &e.Message, &e.Progress, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("scanning run event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading run events: %w", err)
+	}
+
+	return events, nil
+}
+
+// scanRun reads a row selected with runColumns, followed by any extra
+// columns scanned into extra
+func scanRun(rows pgx.Rows, extra ...interface{}) (*types.ModelRun, error) {
+	var run types.ModelRun
+	var message, exitReason *string
+	var processID *int32
+	var config, metrics, progress []byte
+	dest := []interface{}{
+		&run.RunID,
+		&run.ClientID,
+		&run.ProcessType,
+		&run.Status,
+		&message,
+		&config,
+		&processID,
+		&exitReason,
+		&metrics,
+		&progress,
+		&run.CreatedAt,
+		&run.StartedAt,
+		&run.EndedAt,
+		&run.UpdatedAt,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return nil, fmt.Errorf("scanning run: %w", err)
+	}
+
+	if message != nil {
+		run.Message = *message
+	}
+	if exitReason != nil {
+		run.ExitReason = *exitReason
+	}
+	if processID != nil {
+		run.ProcessID = int(*processID)
+	}
+	if config != nil {
+		if err := json.Unmarshal(config, &run.Config); err != nil {
+			return nil, fmt.Errorf("decoding run config: %w", err)
+		}
+	}
+	if metrics != nil {
+		if err := json.Unmarshal(metrics, &run.Metrics); err != nil {
+			return nil, fmt.Errorf("decoding run metrics: %w", err)
+		}
+	}
+	if progress != nil {
+		if err := json.Unmarshal(progress, &run.Progress); err != nil {
+			return nil, fmt.Errorf("decoding run progress: %w", err)
+		}
+	}
+	return &run, nil
+}
+
+// jsonValue returns v for a JSONB column, or NULL when it is empty
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if len(value) == 0 {
+			return nil
+		}
+	case *types.Progress:
+		if value == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+func nullInt(i int) *int32 {
+	if i == 0 {
+		return nil
+	}
+	i32 := int32(i)
+	return &i32
+}
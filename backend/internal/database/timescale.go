@@ -3,18 +3,21 @@ package database
 import (
 	"context"
 	"fmt"
+	"math"
 
 	"backend/internal/config"
+	"backend/internal/logdecode"
 	"backend/internal/types"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type Client struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	decoder *logdecode.Decoder
 }
 
-func New(cfg config.DatabaseConfig) (*Client, error) {
+func New(cfg config.DatabaseConfig, decoder *logdecode.Decoder) (*Client, error) {
 	connString := fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s",
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName,
@@ -25,45 +28,64 @@ func New(cfg config.DatabaseConfig) (*Client, error) {
 		return nil, fmt.Errorf("connecting to database: %w", err)
 	}
 
-	return &Client{pool: pool}, nil
+	return &Client{pool: pool, decoder: decoder}, nil
 }
 
-func (c *Client) FetchLogs(ctx context.Context, clientID string, from, to int64, limit int) ([]types.LogRecord, error) {
+// FetchLogs returns a client's logs between two Unix nanosecond timestamps in
+// (timestamp, seq) order, optionally limited to one run. When after is set,
+// only logs following that cursor are returned, so pages never overlap or
+// skip logs.
+func (c *Client) FetchLogs(ctx context.Context, clientID, runID string, from, to int64, after *types.LogCursor, limit int) (*types.LogPage, error) {
+	afterTimestamp, afterSeq := logNanos(from)-1, int64(math.MaxInt64)
+	if after != nil {
+		afterTimestamp, afterSeq = logNanos(after.Timestamp), after.Seq
+	}
+
 	query := `
-        SELECT timestamp, client_id, message, process_id 
+        SELECT ` + logSelectColumns + `
         FROM logs 
         WHERE client_id = $1 
         AND timestamp >= $2 
         AND timestamp <= $3 
-        ORDER BY timestamp DESC
-        LIMIT $4
+        AND timestamp_ns <= $4
+        AND (timestamp_ns, seq) > ($5, $6)
+        AND ($8 = '' OR run_id = $8)
+        ORDER BY timestamp_ns, seq
+        LIMIT $7
     `
 
-	rows, err := c.pool.Query(ctx, query, clientID, from, to, limit)
+	rows, err := c.pool.Query(ctx, query, clientID, logTime(from), logTime(to), logNanos(to),
+		afterTimestamp, afterSeq, limit, runID)
 	if err != nil {
 		return nil, fmt.Errorf("querying logs: %w", err)
 	}
 	defer rows.Close()
 
-	var logs []types.LogRecord
+	page := &types.LogPage{Logs: []types.LogRecord{}}
 	for rows.Next() {
-		var log types.LogRecord
-		if err := rows.Scan(&log.Timestamp, &log.ClientID, &log.Message, &log.ProcessID); err != nil {
+		log, err := c.scanLog(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning log row: %w", err)
 		}
-		logs = append(logs, log)
+		page.Logs = append(page.Logs, log)
+	}
+
+	// A full page means there may be more logs after the last one
+	if limit > 0 && len(page.Logs) == limit {
+		last := page.Logs[len(page.Logs)-1]
+		page.NextCursor = &types.LogCursor{Timestamp: last.Timestamp, Seq: last.Seq}
 	}
 
-	return logs, nil
+	return page, nil
 }
 
 func (c *Client) SaveLog(ctx context.Context, log types.LogRecord) error {
 	query := `
-        INSERT INTO logs (timestamp, client_id, message, process_id)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO logs (timestamp, timestamp_ns, seq, client_id, run_id, message, process_id, level, logger, msg, fields)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
     `
 
-	_, err := c.pool.Exec(ctx, query, log.Timestamp, log.ClientID, log.Message, log.ProcessID)
+	_, err := c.pool.Exec(ctx, query, logValues(log)...)
 	if err != nil {
 		return fmt.Errorf("inserting log: %w", err)
 	}
@@ -71,26 +93,12 @@ func (c *Client) SaveLog(ctx context.Context, log types.LogRecord) error {
 	return nil
 }
 
-func (c *Client) UpdateModelStatus(ctx context.Context, status types.ModelStatus) error {
-	query := `
-        INSERT INTO model_status (client_id, status, message, timestamp, process_type)
-        VALUES ($1, $2, $3, $4, $5)
-        ON CONFLICT (client_id) DO UPDATE 
-        SET status = $2, message = $3, timestamp = $4, process_type = $5
-    `
-
-	_, err := c.pool.Exec(ctx, query,
-		status.ClientID,
-		status.Status,
-		status.Message,
-		status.Timestamp,
-		status.ProcessType,
-	)
-	if err != nil {
-		return fmt.Errorf("updating model status: %w", err)
+// decodeLog attaches the structured form of a stored log frame. Frames that
+// cannot be decoded are returned raw.
+func (c *Client) decodeLog(log *types.LogRecord) {
+	if err := c.decoder.DecodeRecord(log); err != nil {
+		log.Decoded = nil
 	}
-
-	return nil
 }
 
 func (c *Client) Close() error {
@@ -102,24 +110,119 @@ func (c *Client) Close() error {
 func (c *Client) InitSchema(ctx context.Context) error {
 	queries := []string{
 		`CREATE TABLE IF NOT EXISTS logs (
-            timestamp   TIMESTAMPTZ NOT NULL,
-            client_id  TEXT NOT NULL,
-            message    BYTEA NOT NULL,
-            process_id INTEGER,
-            PRIMARY KEY (timestamp, client_id)
+            timestamp    TIMESTAMPTZ NOT NULL,
+            timestamp_ns BIGINT NOT NULL,
+            seq          BIGINT NOT NULL DEFAULT 0,
+            client_id    TEXT NOT NULL,
+            run_id       TEXT NOT NULL DEFAULT '',
+            message      BYTEA NOT NULL,
+            process_id   INTEGER,
+            PRIMARY KEY (timestamp, client_id, run_id, seq)
         )`,
 
 		`SELECT create_hypertable('logs', 'timestamp', if_not_exists => TRUE)`,
 
-		`CREATE TABLE IF NOT EXISTS model_status (
-            client_id     TEXT PRIMARY KEY,
+		`CREATE TABLE IF NOT EXISTS model_runs (
+            run_id       TEXT PRIMARY KEY,
+            client_id    TEXT NOT NULL,
+            process_type TEXT NOT NULL DEFAULT '',
             status       TEXT NOT NULL,
             message      TEXT,
-            timestamp    TIMESTAMPTZ NOT NULL,
-            process_type TEXT NOT NULL
+            config       JSONB,
+            process_id   INTEGER,
+            exit_reason  TEXT,
+            metrics      JSONB,
+            created_at   TIMESTAMPTZ NOT NULL,
+            started_at   TIMESTAMPTZ,
+            ended_at     TIMESTAMPTZ,
+            updated_at   TIMESTAMPTZ NOT NULL
+        )`,
+
+		`CREATE TABLE IF NOT EXISTS model_run_events (
+            id          BIGSERIAL PRIMARY KEY,
+            event_id    TEXT NOT NULL UNIQUE,
+            run_id      TEXT NOT NULL REFERENCES model_runs (run_id) ON DELETE CASCADE,
+            event_type  TEXT NOT NULL,
+            status      TEXT NOT NULL,
+            message     TEXT,
+            progress    INTEGER,
+            timestamp   TIMESTAMPTZ NOT NULL
         )`,
 
 		`CREATE INDEX IF NOT EXISTS idx_logs_client_id ON logs (client_id)`,
+
+		`ALTER TABLE logs ADD COLUMN IF NOT EXISTS level TEXT`,
+		`ALTER TABLE logs ADD COLUMN IF NOT EXISTS logger TEXT`,
+		`ALTER TABLE logs ADD COLUMN IF NOT EXISTS msg TEXT`,
+
+		`CREATE INDEX IF NOT EXISTS idx_logs_client_level ON logs (client_id, level, timestamp DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_logs_client_order ON logs (client_id, timestamp_ns, seq)`,
+
+		`ALTER TABLE logs ADD COLUMN IF NOT EXISTS fields JSONB`,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`CREATE INDEX IF NOT EXISTS idx_logs_msg_fts ON logs USING GIN (to_tsvector('english', COALESCE(msg, '')))`,
+		`CREATE INDEX IF NOT EXISTS idx_logs_msg_trgm ON logs USING GIN (msg gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_logs_fields ON logs USING GIN (fields jsonb_path_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_logs_backfill ON logs (timestamp) WHERE level IS NULL OR fields IS NULL`,
+
+		`CREATE INDEX IF NOT EXISTS idx_logs_run_order ON logs (run_id, timestamp_ns, seq)`,
+		`CREATE INDEX IF NOT EXISTS idx_model_runs_client ON model_runs (client_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_model_runs_created ON model_runs (created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_model_run_events_run ON model_run_events (run_id, timestamp)`,
+
+		`CREATE TABLE IF NOT EXISTS job_queue (
+            run_id        TEXT PRIMARY KEY,
+            client_id     TEXT NOT NULL,
+            process_type  TEXT NOT NULL,
+            priority      INTEGER NOT NULL,
+            position      BIGSERIAL,
+            payload       BYTEA NOT NULL,
+            state         TEXT NOT NULL DEFAULT 'queued',
+            enqueued_at   TIMESTAMPTZ NOT NULL,
+            dispatched_at TIMESTAMPTZ
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_job_queue_order ON job_queue (state, priority, position)`,
+
+		`ALTER TABLE model_runs ADD COLUMN IF NOT EXISTS progress JSONB`,
+
+		`CREATE TABLE IF NOT EXISTS run_metrics (
+            time      TIMESTAMPTZ NOT NULL,
+            run_id    TEXT NOT NULL,
+            client_id TEXT NOT NULL,
+            name      TEXT NOT NULL,
+            step      BIGINT NOT NULL DEFAULT 0,
+            value     DOUBLE PRECISION NOT NULL,
+            PRIMARY KEY (run_id, name, step, time)
+        )`,
+		`SELECT create_hypertable('run_metrics', 'time', if_not_exists => TRUE)`,
+		`CREATE INDEX IF NOT EXISTS idx_run_metrics_name_step ON run_metrics (name, run_id, step)`,
+
+		`CREATE TABLE IF NOT EXISTS model_versions (
+            id         TEXT PRIMARY KEY,
+            client_id  TEXT NOT NULL,
+            name       TEXT NOT NULL,
+            version    INTEGER NOT NULL,
+            run_id     TEXT NOT NULL UNIQUE,
+            stage      TEXT NOT NULL DEFAULT 'none',
+            config     JSONB,
+            metrics    JSONB,
+            artifact   TEXT,
+            created_at TIMESTAMPTZ NOT NULL,
+            updated_at TIMESTAMPTZ NOT NULL,
+            UNIQUE (client_id, name, version)
+        )`,
+		`CREATE TABLE IF NOT EXISTS model_version_events (
+            id         BIGSERIAL PRIMARY KEY,
+            version_id TEXT NOT NULL REFERENCES model_versions (id) ON DELETE CASCADE,
+            from_stage TEXT,
+            to_stage   TEXT NOT NULL,
+            actor      TEXT NOT NULL,
+            reason     TEXT,
+            timestamp  TIMESTAMPTZ NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_model_versions_stage ON model_versions (client_id, name, stage)`,
+		`CREATE INDEX IF NOT EXISTS idx_model_version_events_version ON model_version_events (version_id, timestamp)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_model_versions_one_per_stage ON model_versions (client_id, name, stage) WHERE stage IN ('staging', 'production')`,
 	}
 
 	for _, query := range queries {
@@ -59,6 +59,15 @@ func (u *UserDB) InitSchema(ctx context.Context) error {
             updated_at TIMESTAMP WITH TIME ZONE NOT NULL
         )`,
 		`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
+		`CREATE TABLE IF NOT EXISTS password_resets (
+            token_hash TEXT PRIMARY KEY,
+            user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+            used_at TIMESTAMP WITH TIME ZONE,
+            created_at TIMESTAMP WITH TIME ZONE NOT NULL
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_password_resets_user ON password_resets(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_type_created ON users(user_type, created_at)`,
 	}
 
 	for _, query := range queries {
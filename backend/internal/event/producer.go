@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"backend/internal/types"
+
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
@@ -38,13 +40,14 @@ func NewProducer(brokers []string, commandTopic, statusTopic string) *Producer {
 }
 
 // PublishTrainRequest publishes a train request event
-func (p *Producer) PublishTrainRequest(ctx context.Context, clientID string, data []float64, startDate, endDate string, config interface{}) error {
+func (p *Producer) PublishTrainRequest(ctx context.Context, clientID, runID string, data []float64, startDate, endDate string, config interface{}) error {
 	event := TrainRequestedEvent{
 		BaseEvent: BaseEvent{
 			ID:        uuid.New().String(),
 			Type:      EventTypeTrainRequested,
 			Timestamp: time.Now(),
 			ClientID:  clientID,
+			RunID:     runID,
 		},
 		Data:          data,
 		StartDate:     startDate,
@@ -55,30 +58,52 @@ func (p *Producer) PublishTrainRequest(ctx context.Context, clientID string, dat
 	return p.publishEvent(ctx, p.commandWriter, event)
 }
 
-// PublishPredictRequest publishes a predict request event
-func (p *Producer) PublishPredictRequest(ctx context.Context, clientID string, data []float64, config interface{}) error {
+// PublishPredictRequest publishes a predict request event. The model
+// version is nil for predictions that do not use a registered model.
+func (p *Producer) PublishPredictRequest(ctx context.Context, clientID, runID string, data []float64, config interface{}, model *types.ModelVersion) error {
 	event := PredictRequestedEvent{
 		BaseEvent: BaseEvent{
 			ID:        uuid.New().String(),
 			Type:      EventTypePredictRequested,
 			Timestamp: time.Now(),
 			ClientID:  clientID,
+			RunID:     runID,
 		},
 		Data:          data,
 		Configuration: config,
 	}
+	if model != nil {
+		event.ModelVersionID, event.Artifact = model.ID, model.Artifact
+	}
+
+	return p.publishEvent(ctx, p.commandWriter, event)
+}
+
+// PublishCancelRequest publishes a request to stop a run
+func (p *Producer) PublishCancelRequest(ctx context.Context, clientID, runID, reason string) error {
+	event := CancelRequestedEvent{
+		BaseEvent: BaseEvent{
+			ID:        uuid.New().String(),
+			Type:      EventTypeCancelRequested,
+			Timestamp: time.Now(),
+			ClientID:  clientID,
+			RunID:     runID,
+		},
+		Reason: reason,
+	}
 
 	return p.publishEvent(ctx, p.commandWriter, event)
 }
 
 // PublishModelStatus publishes a model status event
-func (p *Producer) PublishModelStatus(ctx context.Context, eventType EventType, clientID, status, message, processType string, progress int) error {
+func (p *Producer) PublishModelStatus(ctx context.Context, eventType EventType, clientID, runID, status, message, processType string, progress int) error {
 	event := ModelStatusEvent{
 		BaseEvent: BaseEvent{
 			ID:        uuid.New().String(),
 			Type:      eventType,
 			Timestamp: time.Now(),
 			ClientID:  clientID,
+			RunID:     runID,
 		},
 		Status:      status,
 		Message:     message,
@@ -89,6 +114,44 @@ func (p *Producer) PublishModelStatus(ctx context.Context, eventType EventType,
 	return p.publishEvent(ctx, p.statusWriter, event)
 }
 
+// PublishStatusEvent publishes a fully populated model status event. The
+// event ID and timestamp are filled in when unset.
+func (p *Producer) PublishStatusEvent(ctx context.Context, event ModelStatusEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	return p.publishEvent(ctx, p.statusWriter, event)
+}
+
+// PublishMetrics publishes the metrics a run reported. The event ID and
+// timestamp are filled in when unset.
+func (p *Producer) PublishMetrics(ctx context.Context, event MetricsEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	return p.publishEvent(ctx, p.statusWriter, event)
+}
+
+// PublishServiceStatus publishes an ML service availability event
+func (p *Producer) PublishServiceStatus(ctx context.Context, event ServiceStatusEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	return p.publishEvent(ctx, p.statusWriter, event)
+}
+
 // publishEvent serializes and publishes an event to Kafka
 func (p *Producer) publishEvent(ctx context.Context, writer *kafka.Writer, event interface{}) error {
 	data, err := Serialize(event)
@@ -105,9 +168,18 @@ func (p *Producer) publishEvent(ctx context.Context, writer *kafka.Writer, event
 	case PredictRequestedEvent:
 		eventType = string(e.Type)
 		eventID = e.ID
+	case CancelRequestedEvent:
+		eventType = string(e.Type)
+		eventID = e.ID
 	case ModelStatusEvent:
 		eventType = string(e.Type)
 		eventID = e.ID
+	case ServiceStatusEvent:
+		eventType = string(e.Type)
+		eventID = e.ID
+	case MetricsEvent:
+		eventType = string(e.Type)
+		eventID = e.ID
 	default:
 		eventType = "unknown"
 		eventID = uuid.New().String()
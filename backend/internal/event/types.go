@@ -3,6 +3,8 @@ package event
 import (
 	"encoding/json"
 	"time"
+
+	"backend/internal/types"
 )
 
 // EventType defines the type of event
@@ -12,12 +14,20 @@ const (
 	// Command events
 	EventTypeTrainRequested   EventType = "train.requested"
 	EventTypePredictRequested EventType = "predict.requested"
+	EventTypeCancelRequested  EventType = "model.cancel.requested"
 
 	// Status events
+	EventTypeModelQueued    EventType = "model.queued"
 	EventTypeModelStarted   EventType = "model.started"
 	EventTypeModelCompleted EventType = "model.completed"
 	EventTypeModelFailed    EventType = "model.failed"
 	EventTypeModelProgress  EventType = "model.progress"
+	EventTypeModelCancelled EventType = "model.cancelled"
+	EventTypeModelMetrics   EventType = "model.metrics"
+
+	// Service events
+	EventTypeServiceUnavailable EventType = "ml_service.unavailable"
+	EventTypeServiceAvailable   EventType = "ml_service.available"
 )
 
 // BaseEvent contains common fields for all events
@@ -26,6 +36,7 @@ type BaseEvent struct {
 	Type      EventType `json:"type"`
 	Timestamp time.Time `json:"timestamp"`
 	ClientID  string    `json:"client_id"`
+	RunID     string    `json:"run_id,omitempty"`
 }
 
 // TrainRequestedEvent represents a model training request
@@ -37,20 +48,59 @@ type TrainRequestedEvent struct {
 	Configuration interface{} `json:"config,omitempty"`
 }
 
-// PredictRequestedEvent represents a prediction request
+// PredictRequestedEvent represents a prediction request. A prediction with
+// a registered model carries the version and its artifact.
 type PredictRequestedEvent struct {
 	BaseEvent
-	Data          []float64   `json:"data,omitempty"`
-	Configuration interface{} `json:"config,omitempty"`
+	Data           []float64   `json:"data,omitempty"`
+	Configuration  interface{} `json:"config,omitempty"`
+	ModelVersionID string      `json:"model_version_id,omitempty"`
+	Artifact       string      `json:"artifact,omitempty"`
+}
+
+// CancelRequestedEvent represents a request to stop a running model
+type CancelRequestedEvent struct {
+	BaseEvent
+	Reason string `json:"reason,omitempty"`
 }
 
 // ModelStatusEvent represents a status update from a model
 type ModelStatusEvent struct {
 	BaseEvent
-	Status      string `json:"status"`
-	Message     string `json:"message,omitempty"`
-	ProcessType string `json:"process_type"`
-	Progress    int    `json:"progress,omitempty"`
+	Status      string                 `json:"status"`
+	Message     string                 `json:"message,omitempty"`
+	ProcessType string                 `json:"process_type"`
+	Progress    int                    `json:"progress,omitempty"`
+	Config      interface{}            `json:"config,omitempty"`
+	ProcessID   int                    `json:"process_id,omitempty"`
+	ExitReason  string                 `json:"exit_reason,omitempty"`
+	Metrics     map[string]interface{} `json:"metrics,omitempty"`
+
+	// QueuePosition is set on queued events
+	QueuePosition int `json:"queue_position,omitempty"`
+
+	// ProgressDetail is the structured progress of progress events
+	ProgressDetail *types.Progress `json:"progress_detail,omitempty"`
+
+	// Artifact is where a completed training run saved its model
+	Artifact string `json:"artifact,omitempty"`
+}
+
+// MetricsEvent carries the training metrics a run reported at a step
+type MetricsEvent struct {
+	BaseEvent
+	Step    int64              `json:"step"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// ServiceStatusEvent reports the availability of the ML service as seen by
+// the orchestrator's circuit breaker. RetryAt is when an open breaker next
+// lets a call through.
+type ServiceStatusEvent struct {
+	BaseEvent
+	State   string     `json:"state"`
+	Message string     `json:"message,omitempty"`
+	RetryAt *time.Time `json:"retry_at,omitempty"`
 }
 
 // Serialize converts an event to JSON bytes
@@ -67,8 +117,14 @@ func Deserialize(data []byte, eventType EventType) (interface{}, error) {
 		event = &TrainRequestedEvent{}
 	case EventTypePredictRequested:
 		event = &PredictRequestedEvent{}
-	case EventTypeModelStarted, EventTypeModelCompleted, EventTypeModelFailed, EventTypeModelProgress:
+	case EventTypeCancelRequested:
+		event = &CancelRequestedEvent{}
+	case EventTypeModelQueued, EventTypeModelStarted, EventTypeModelCompleted, EventTypeModelFailed, EventTypeModelProgress, EventTypeModelCancelled:
 		event = &ModelStatusEvent{}
+	case EventTypeModelMetrics:
+		event = &MetricsEvent{}
+	case EventTypeServiceUnavailable, EventTypeServiceAvailable:
+		event = &ServiceStatusEvent{}
 	default:
 		// For unknown event types, deserialize to a map
 		event = &map[string]interface{}{}
@@ -2,98 +2,259 @@ package grpc
 
 import (
 	"backend/internal/buffer"
+	"backend/internal/config"
+	"backend/internal/logdecode"
+	"backend/internal/resilience"
 	"backend/internal/types"
 	pb "backend/proto"
 	"context"
-	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// LogHandler is called for every log received from the ML service. ctx is
+// cancelled when the stream the log arrived on closes.
+type LogHandler func(ctx context.Context, record types.LogRecord)
+
+// LogGapHandler is called when logs of a run were found missing
+type LogGapHandler func(gap LogGap)
+
+// Client talks to a pool of ML service workers. Runs are started on the
+// least-loaded healthy worker and later calls for a run go to the worker
+// that owns it. Logs are streamed according to the log subscriptions and
+// the active runs.
 type Client struct {
-	conn      *grpc.ClientConn
-	client    pb.ProcessServiceClient
-	stream    pb.ProcessService_StreamLogsClient
-	logBuffer *buffer.LogBuffer
+	cfg            config.GRPCConfig
+	logBuffer      *buffer.LogBuffer
+	decoder        *logdecode.Decoder
+	handlers       []LogHandler
+	gapHandlers    []LogGapHandler
+	handlersMu     sync.RWMutex
+	policy         *callPolicy
+	healthInterval time.Duration
+	streamBackoff  resilience.RetryPolicy
+
+	mu      sync.RWMutex
+	workers map[string]*worker
+	runs    map[string]string // run ID to worker address
+
+	subsMu    sync.Mutex
+	subRefs   map[string]int // subscriptions per stream filter
+	streams   map[streamKey]*logStream
+	runHealth map[string]*runStream
+	reconcile chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // background goroutines, including log streams
 }
 
-func NewClient(serverAddr string, logBuffer *buffer.LogBuffer) (*Client, error) {
-	// dialCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	// defer cancel()
+func NewClient(cfg config.GRPCConfig, logBuffer *buffer.LogBuffer, decoder *logdecode.Decoder) (*Client, error) {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	conn, err := grpc.NewClient(serverAddr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	resolveCtx, resolveCancel := context.WithTimeout(ctx, healthCheckTimeout)
+	addresses, err := workerAddresses(resolveCtx, cfg)
+	resolveCancel()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		cancel()
+		return nil, err
 	}
 
 	client := &Client{
-		conn:      conn,
-		client:    pb.NewProcessServiceClient(conn),
-		logBuffer: logBuffer,
+		cfg:            cfg,
+		logBuffer:      logBuffer,
+		decoder:        decoder,
+		policy:         newCallPolicy(cfg),
+		healthInterval: millisOr(cfg.HealthInterval, defaultHealthInterval),
+		streamBackoff: resilience.RetryPolicy{
+			InitialBackoff: millisOr(cfg.StreamBackoff, defaultStreamBackoff),
+			MaxBackoff:     millisOr(cfg.MaxStreamBackoff, defaultMaxStreamBackoff),
+		},
+		workers:   make(map[string]*worker),
+		runs:      make(map[string]string),
+		subRefs:   make(map[string]int),
+		streams:   make(map[streamKey]*logStream),
+		runHealth: make(map[string]*runStream),
+		reconcile: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 
-	if err := client.setupStreamConnection(); err != nil {
-		conn.Close()
-		return nil, err
+	client.mu.Lock()
+	for _, address := range addresses {
+		if err := client.addWorker(address); err != nil {
+			client.mu.Unlock()
+			client.Close()
+			return nil, err
+		}
 	}
+	client.mu.Unlock()
+
+	// Find healthy workers before the first run is routed
+	client.checkWorkers()
+	client.wg.Add(2)
+	go client.monitorWorkers()
+	go client.manageStreams()
 
-	go client.handleLogStream()
 	return client, nil
 }
 
-func (c *Client) setupStreamConnection() error {
-	stream, err := c.client.StreamLogs(context.Background(), &pb.LogRequest{ClientId: "3a44390c-c7b6-43b9-9cdc-1dcc9bb7d794"})
-	if err != nil {
-		return fmt.Errorf("failed to setup stream: %w", err)
+// handleLog buffers a received log and passes it to the log handlers,
+// skipping logs that were already received on another stream
+func (c *Client) handleLog(ctx context.Context, w *worker, msg *pb.LogMessage) {
+	// log.Printf("Received log: %+v", msg)
+	// Store received log in buffer
+	record := types.LogRecord{
+		Timestamp: msg.Timestamp,
+		Seq:       msg.Seq,
+		ClientID:  msg.ClientId,
+		RunID:     msg.RunId,
+		Message:   msg.Message,
+		ProcessID: msg.ProcessId,
 	}
-	c.stream = stream
-	return nil
-}
-
-func (c *Client) handleLogStream() {
-	for {
-		msg, err := c.stream.Recv()
-		if err != nil {
-			log.Printf("Stream error: %v, attempting reconnect...", err)
-			time.Sleep(1 * time.Second)
-			if err := c.setupStreamConnection(); err != nil {
-				log.Printf("Reconnection failed: %v", err)
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			continue
+	if err := c.decoder.DecodeRecord(&record); err != nil {
+		// Keep the raw frame so the log is not lost
+		log.Printf("Failed to decode log for client %s: %v", msg.ClientId, err)
+	}
+	if record.RunID == "" && record.Decoded != nil {
+		// Older ML services only carry the run in the logger extras
+		if runID, ok := record.Decoded.Extra["run_id"].(string); ok {
+			record.RunID = runID
 		}
-		// log.Printf("Received log: %+v", msg)
-		// Store received log in buffer
-		record := types.LogRecord{
-			Timestamp: msg.Timestamp,
-			ClientID:  msg.ClientId,
-			Message:   msg.Message,
-			ProcessID: msg.ProcessId,
+	}
+	accepted, gap := c.acceptLog(w, &record)
+	if !accepted {
+		return
+	}
+	if record.RunID != "" {
+		if _, ok := c.runWorker(record.RunID); !ok {
+			c.pinRun(record.RunID, w, false)
 		}
-		c.logBuffer.Push(msg.ClientId, record)
-		log.Printf("Buffered log for client %s", msg.ClientId)
+	}
+	c.logBuffer.Push(msg.ClientId, record)
 
+	c.handlersMu.RLock()
+	handlers, gapHandlers := c.handlers, c.gapHandlers
+	c.handlersMu.RUnlock()
+	if gap != nil {
+		// Mark the gap before the first log after it
+		for _, handler := range gapHandlers {
+			handler(*gap)
+		}
+	}
+	for _, handler := range handlers {
+		handler(ctx, record)
 	}
 }
 
-func (c *Client) StartProcess(ctx context.Context, clientID string, payload []byte) (*pb.ProcessResponse, error) {
+// OnLog registers a handler for received logs. Handlers run on the stream
+// goroutine, so a slow handler slows down the stream.
+func (c *Client) OnLog(handler LogHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
+// OnLogGap registers a handler for logs found missing from a run. Like log
+// handlers, they run on the stream goroutine.
+func (c *Client) OnLogGap(handler LogGapHandler) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.gapHandlers = append(c.gapHandlers, handler)
+}
+
+// Breaker returns the circuit breaker guarding calls to the ML service
+func (c *Client) Breaker() *resilience.Breaker {
+	return c.policy.breaker
+}
+
+// StartProcess starts a run on the least-loaded healthy worker. Starting a
+// run that is already running returns the running process, so transient
+// failures are retried; a retry after an unanswered call goes to the same
+// worker.
+func (c *Client) StartProcess(ctx context.Context, clientID, runID string, payload []byte) (*pb.ProcessResponse, error) {
 	req := &pb.StartProcessRequest{
 		ClientId: clientID,
+		RunId:    runID,
 		Payload:  string(payload),
 	}
 
-	return c.client.StartProcess(ctx, req)
+	var target *worker
+	var resp *pb.ProcessResponse
+	err := c.policy.call(ctx, c.policy.startTimeout, func(ctx context.Context) error {
+		if target == nil {
+			w, err := c.leastLoadedWorker()
+			if err != nil {
+				return err
+			}
+			target = w
+		}
+
+		var err error
+		resp, err = target.client.StartProcess(ctx, req)
+		if status.Code(err) == codes.Unavailable {
+			c.markUnhealthy(target, err)
+			target = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		c.pinRun(runID, target, true)
+		return nil
+	})
+	return resp, err
 }
 
+// StopProcess stops a run on the worker that owns it. The process gets
+// gracePeriod to exit after SIGTERM before it is killed. A run no worker
+// owns is reported as not_found.
+func (c *Client) StopProcess(ctx context.Context, clientID, runID string, gracePeriod time.Duration) (*pb.StopProcessResponse, error) {
+	req := &pb.StopProcessRequest{
+		ClientId:      clientID,
+		RunId:         runID,
+		GracePeriodMs: int32(gracePeriod.Milliseconds()),
+	}
+
+	w, ok := c.runWorker(runID)
+	if !ok {
+		if w, ok = c.locateRun(ctx, runID); !ok {
+			return &pb.StopProcessResponse{RunId: runID, Status: "not_found"}, nil
+		}
+	}
+
+	var resp *pb.StopProcessResponse
+	err := c.policy.call(ctx, gracePeriod+c.policy.stopTimeout, func(ctx context.Context) error {
+		var err error
+		resp, err = w.client.StopProcess(ctx, req)
+		return err
+	})
+	if err == nil {
+		c.unpinRun(runID)
+	}
+	return resp, err
+}
+
+// Close stops the log streams and health checks, waits for them to return
+// and disconnects from the workers
 func (c *Client) Close() error {
-	if c.stream != nil {
-		c.stream.CloseSend()
+	c.cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var closeErr error
+	for _, w := range c.workers {
+		if err := w.conn.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
 	}
-	return c.conn.Close()
+	return closeErr
 }
@@ -0,0 +1,427 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/internal/config"
+	pb "backend/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults for worker health checks
+const (
+	defaultHealthInterval = 5 * time.Second
+	healthCheckTimeout    = 2 * time.Second
+)
+
+// healthService is the service name workers report health for
+const healthService = "process.ProcessService"
+
+// errNoWorkers is returned when no healthy worker can take a run. It is
+// UNAVAILABLE so callers retry it like any other outage.
+var errNoWorkers = status.Error(codes.Unavailable, "no healthy ML workers")
+
+// WorkerStatus is the state of a worker of the ML service pool
+type WorkerStatus struct {
+	Address   string    `json:"address"`
+	Healthy   bool      `json:"healthy"`
+	Processes int       `json:"processes"`
+	Runs      []string  `json:"runs"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// worker is a single ML service endpoint. Its state is guarded by the
+// client's mutex.
+type worker struct {
+	address string
+	conn    *grpc.ClientConn
+	client  pb.ProcessServiceClient
+	health  healthpb.HealthClient
+
+	healthy   bool
+	processes int
+	lastCheck time.Time
+	lastError string
+	// listed is set once the worker has reported its processes
+	listed bool
+}
+
+// workerAddresses returns the configured worker endpoints: the static list,
+// the addresses a DNS name resolves to, or the single server address
+func workerAddresses(ctx context.Context, cfg config.GRPCConfig) ([]string, error) {
+	if cfg.WorkersDNS != "" {
+		host, port, err := net.SplitHostPort(cfg.WorkersDNS)
+		if err != nil {
+			return nil, fmt.Errorf("parsing workers_dns: %w", err)
+		}
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolving workers: %w", err)
+		}
+		addresses := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			addresses = append(addresses, net.JoinHostPort(ip, port))
+		}
+		return addresses, nil
+	}
+
+	if len(cfg.Workers) > 0 {
+		return cfg.Workers, nil
+	}
+	if cfg.ServerAddress != "" {
+		return []string{cfg.ServerAddress}, nil
+	}
+	return nil, fmt.Errorf("no ML workers configured")
+}
+
+// addWorker connects to a worker. The caller holds mu.
+func (c *Client) addWorker(address string) error {
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	c.workers[address] = &worker{
+		address: address,
+		conn:    conn,
+		client:  pb.NewProcessServiceClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+	}
+	c.reconcileStreams()
+	return nil
+}
+
+// removeWorker disconnects a worker that is no longer configured. Its runs
+// are forgotten. The caller holds mu.
+func (c *Client) removeWorker(w *worker) {
+	w.conn.Close()
+	delete(c.workers, w.address)
+
+	for runID, address := range c.runs {
+		if address == w.address {
+			delete(c.runs, runID)
+		}
+	}
+	c.reconcileStreams()
+}
+
+// monitorWorkers refreshes the worker list and their health periodically
+func (c *Client) monitorWorkers() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.refreshWorkers()
+			c.checkWorkers()
+		}
+	}
+}
+
+// refreshWorkers adds and removes workers when the DNS name resolves to a
+// different set of addresses
+func (c *Client) refreshWorkers() {
+	if c.cfg.WorkersDNS == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, healthCheckTimeout)
+	defer cancel()
+
+	addresses, err := workerAddresses(ctx, c.cfg)
+	if err != nil {
+		log.Printf("Error resolving ML workers: %v", err)
+		return
+	}
+
+	current := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		current[address] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for address, w := range c.workers {
+		if !current[address] {
+			log.Printf("Removing ML worker %s", address)
+			c.removeWorker(w)
+		}
+	}
+	for _, address := range addresses {
+		if _, ok := c.workers[address]; ok {
+			continue
+		}
+		log.Printf("Adding ML worker %s", address)
+		if err := c.addWorker(address); err != nil {
+			log.Printf("Error adding ML worker: %v", err)
+		}
+	}
+}
+
+// checkWorkers checks the health and load of every worker
+func (c *Client) checkWorkers() {
+	c.mu.RLock()
+	workers := make([]*worker, 0, len(c.workers))
+	for _, w := range c.workers {
+		workers = append(workers, w)
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			c.checkWorker(w)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// checkWorker asks a worker for its health and running processes. Workers
+// that predate the health protocol count as healthy while they answer.
+func (c *Client) checkWorker(w *worker) {
+	ctx, cancel := context.WithTimeout(c.ctx, healthCheckTimeout)
+	defer cancel()
+
+	healthy := true
+	var checkErr error
+
+	resp, err := w.health.Check(ctx, &healthpb.HealthCheckRequest{Service: healthService})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+	case err != nil:
+		healthy, checkErr = false, err
+	case resp.Status != healthpb.HealthCheckResponse_SERVING:
+		healthy, checkErr = false, fmt.Errorf("worker is %s", resp.Status)
+	}
+
+	var processes []*pb.ProcessInfo
+	listed := false
+	if healthy {
+		list, err := w.client.ListProcesses(ctx, &pb.ListProcessesRequest{})
+		switch {
+		case status.Code(err) == codes.Unimplemented:
+		case err != nil:
+			healthy, checkErr = false, err
+		default:
+			processes, listed = list.Processes, true
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if healthy != w.healthy {
+		if healthy {
+			log.Printf("ML worker %s is healthy", w.address)
+		} else {
+			log.Printf("ML worker %s is unhealthy: %v", w.address, checkErr)
+		}
+	}
+
+	w.healthy = healthy
+	w.lastCheck = time.Now()
+	w.lastError = ""
+	if checkErr != nil {
+		w.lastError = checkErr.Error()
+	}
+
+	w.listed = w.listed || listed
+	if listed {
+		w.processes = len(processes)
+		// Learn runs started before this backend, and forget finished ones
+		running := make(map[string]bool, len(processes))
+		for _, p := range processes {
+			running[p.RunId] = true
+			c.runs[p.RunId] = w.address
+		}
+		for runID, address := range c.runs {
+			if address == w.address && !running[runID] {
+				delete(c.runs, runID)
+			}
+		}
+		c.reconcileStreams()
+	}
+}
+
+// markUnhealthy takes a worker out of rotation until its next health check
+func (c *Client) markUnhealthy(w *worker, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if w.healthy {
+		log.Printf("ML worker %s is unhealthy: %v", w.address, err)
+	}
+	w.healthy = false
+	w.lastError = err.Error()
+}
+
+// leastLoadedWorker returns the healthy worker running the fewest processes
+func (c *Client) leastLoadedWorker() (*worker, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var best *worker
+	for _, w := range c.workers {
+		if !w.healthy {
+			continue
+		}
+		if best == nil || w.processes < best.processes ||
+			(w.processes == best.processes && w.address < best.address) {
+			best = w
+		}
+	}
+	if best == nil {
+		return nil, errNoWorkers
+	}
+	return best, nil
+}
+
+// pinRun records the worker that owns a run
+func (c *Client) pinRun(runID string, w *worker, started bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.workers[w.address]; !ok {
+		return
+	}
+	if started && c.runs[runID] != w.address {
+		// Count the run until the next health check reports it
+		w.processes++
+	}
+	if c.runs[runID] != w.address {
+		c.runs[runID] = w.address
+		c.reconcileStreams()
+	}
+}
+
+// unpinRun forgets the worker of a finished run
+func (c *Client) unpinRun(runID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if address, ok := c.runs[runID]; ok {
+		if w, ok := c.workers[address]; ok && w.processes > 0 {
+			w.processes--
+		}
+		delete(c.runs, runID)
+		c.reconcileStreams()
+	}
+}
+
+// runWorker returns the worker that owns a run
+func (c *Client) runWorker(runID string) (*worker, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	address, ok := c.runs[runID]
+	if !ok {
+		return nil, false
+	}
+	w, ok := c.workers[address]
+	return w, ok
+}
+
+// locateRun asks every healthy worker for its processes to find the owner
+// of a run this backend does not know about
+func (c *Client) locateRun(ctx context.Context, runID string) (*worker, bool) {
+	c.mu.RLock()
+	workers := make([]*worker, 0, len(c.workers))
+	for _, w := range c.workers {
+		if w.healthy {
+			workers = append(workers, w)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, w := range workers {
+		listCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		list, err := w.client.ListProcesses(listCtx, &pb.ListProcessesRequest{})
+		cancel()
+		if err != nil {
+			continue
+		}
+		for _, p := range list.Processes {
+			if p.RunId == runID {
+				c.pinRun(runID, w, false)
+				return w, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RunningRuns returns the runs pinned to a worker: those it reported at its
+// last health check and those started since, mapped to whether the worker is
+// healthy. complete is false while a worker is unhealthy or has never
+// reported its processes, as its runs are then unknown.
+func (c *Client) RunningRuns() (runs map[string]bool, complete bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	complete = len(c.workers) > 0
+	for _, w := range c.workers {
+		if !w.healthy || !w.listed {
+			complete = false
+		}
+	}
+
+	runs = make(map[string]bool, len(c.runs))
+	for runID, address := range c.runs {
+		if w, ok := c.workers[address]; ok {
+			runs[runID] = w.healthy
+		}
+	}
+	return runs, complete
+}
+
+// Workers returns the state of every worker in the pool
+func (c *Client) Workers() []WorkerStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	runs := make(map[string][]string)
+	for runID, address := range c.runs {
+		runs[address] = append(runs[address], runID)
+	}
+
+	workers := make([]WorkerStatus, 0, len(c.workers))
+	for _, w := range c.workers {
+		workerRuns := runs[w.address]
+		sort.Strings(workerRuns)
+		if workerRuns == nil {
+			workerRuns = []string{}
+		}
+		workers = append(workers, WorkerStatus{
+			Address:   w.address,
+			Healthy:   w.healthy,
+			Processes: w.processes,
+			Runs:      workerRuns,
+			LastCheck: w.lastCheck,
+			LastError: w.lastError,
+		})
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Address < workers[j].Address })
+	return workers
+}
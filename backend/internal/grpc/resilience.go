@@ -0,0 +1,97 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/resilience"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults used when the gRPC config leaves a value unset
+const (
+	defaultStartTimeout     = 10 * time.Second
+	defaultStopTimeout      = 5 * time.Second
+	defaultMaxRetries       = 3
+	defaultRetryBackoff     = 200 * time.Millisecond
+	defaultMaxRetryBackoff  = 5 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// callPolicy holds the deadlines, retries and circuit breaker applied to
+// unary calls to the ML service
+type callPolicy struct {
+	startTimeout time.Duration
+	stopTimeout  time.Duration
+	retry        resilience.RetryPolicy
+	breaker      *resilience.Breaker
+}
+
+func newCallPolicy(cfg config.GRPCConfig) *callPolicy {
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	} else if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	threshold := cfg.BreakerThreshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+
+	return &callPolicy{
+		startTimeout: millisOr(cfg.StartTimeout, defaultStartTimeout),
+		stopTimeout:  millisOr(cfg.StopTimeout, defaultStopTimeout),
+		retry: resilience.RetryPolicy{
+			MaxRetries:     maxRetries,
+			InitialBackoff: millisOr(cfg.RetryBackoff, defaultRetryBackoff),
+			MaxBackoff:     millisOr(cfg.MaxRetryBackoff, defaultMaxRetryBackoff),
+		},
+		breaker: resilience.NewBreaker(threshold, millisOr(cfg.BreakerCooldown, defaultBreakerCooldown)),
+	}
+}
+
+// call runs an RPC through the circuit breaker, giving each attempt its
+// own deadline and retrying transient failures
+func (p *callPolicy) call(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	return resilience.Retry(ctx, p.retry, isTransient, func(ctx context.Context) error {
+		if err := p.breaker.Allow(); err != nil {
+			return fmt.Errorf("ml service unavailable: %w", err)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := fn(attemptCtx)
+		if isTransient(err) && ctx.Err() == nil {
+			p.breaker.Failure()
+		} else {
+			// Application errors still mean the service answered
+			p.breaker.Success()
+		}
+		return err
+	})
+}
+
+// isTransient reports whether an RPC error is worth retrying
+func isTransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func millisOr(ms int, fallback time.Duration) time.Duration {
+	if ms <= 0 {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,436 @@
+package grpc
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/types"
+	pb "backend/proto"
+)
+
+// Log stream filters. A stream carries the runs of one client or a single
+// run.
+const (
+	filterRunPrefix = "run:"
+	filterClientPfx = "client:"
+)
+
+// runHealthRetention is how long the stream state of a run nobody follows
+// any more is kept
+const runHealthRetention = 10 * time.Minute
+
+// Defaults for the delay before a failed log stream reconnects
+const (
+	defaultStreamBackoff    = 500 * time.Millisecond
+	defaultMaxStreamBackoff = 30 * time.Second
+)
+
+// LogSubscription keeps log streams open for as long as it is held
+type LogSubscription struct {
+	client *Client
+	filter string
+	once   sync.Once
+}
+
+// Close releases the subscription. Streams nobody needs are torn down.
+func (s *LogSubscription) Close() {
+	s.once.Do(func() {
+		s.client.unsubscribe(s.filter)
+	})
+}
+
+// RunStreamHealth is the state of the log streams carrying a run
+type RunStreamHealth struct {
+	RunID        string    `json:"run_id"`
+	ClientID     string    `json:"client_id"`
+	Worker       string    `json:"worker"`
+	Connected    bool      `json:"connected"`
+	Streams      []string  `json:"streams"`
+	LastSeq      int64     `json:"last_seq"`
+	LastReceived time.Time `json:"last_received,omitempty"`
+	Received     int64     `json:"received"`
+	Duplicates   int64     `json:"duplicates"`
+	Gaps         int64     `json:"gaps"`
+	Missing      int64     `json:"missing"`
+	Reconnects   int       `json:"reconnects"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// LogGap is a range of logs of a run that was never received, because the
+// ML service dropped them for a slow stream or no longer had them to replay
+type LogGap struct {
+	RunID      string    `json:"run_id,omitempty"`
+	ClientID   string    `json:"client_id"`
+	Worker     string    `json:"worker"`
+	FromSeq    int64     `json:"from_seq"`
+	ToSeq      int64     `json:"to_seq"`
+	Missing    int64     `json:"missing"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// streamKey identifies a log stream to a worker
+type streamKey struct {
+	worker string
+	filter string
+}
+
+// logStream is an open log stream. Its state is guarded by subsMu.
+type logStream struct {
+	key    streamKey
+	cancel context.CancelFunc
+
+	connected  bool
+	reconnects int
+	lastError  string
+}
+
+// runStream is what has been received for a run. Logs at or before the last
+// received sequence are duplicates, unless they are newer, which happens
+// when the ML service restarted and numbers the run from 1 again.
+type runStream struct {
+	clientID      string
+	worker        string
+	lastSeq       int64
+	lastTimestamp int64
+	lastReceived  time.Time
+	received      int64
+	duplicates    int64
+	gaps          int64
+	missing       int64
+}
+
+// SubscribeRun streams the logs of a run from the worker that owns it
+func (c *Client) SubscribeRun(runID string) *LogSubscription {
+	return c.subscribe(filterRunPrefix + runID)
+}
+
+// SubscribeClient streams the logs of every run of a client
+func (c *Client) SubscribeClient(clientID string) *LogSubscription {
+	return c.subscribe(filterClientPfx + clientID)
+}
+
+func (c *Client) subscribe(filter string) *LogSubscription {
+	c.subsMu.Lock()
+	c.subRefs[filter]++
+	c.subsMu.Unlock()
+
+	c.reconcileStreams()
+	return &LogSubscription{client: c, filter: filter}
+}
+
+func (c *Client) unsubscribe(filter string) {
+	c.subsMu.Lock()
+	if c.subRefs[filter]--; c.subRefs[filter] <= 0 {
+		delete(c.subRefs, filter)
+	}
+	c.subsMu.Unlock()
+
+	c.reconcileStreams()
+}
+
+// reconcileStreams asks the stream manager to open and close streams
+// without blocking
+func (c *Client) reconcileStreams() {
+	select {
+	case c.reconcile <- struct{}{}:
+	default:
+	}
+}
+
+// manageStreams keeps the open streams in line with the subscriptions and
+// the active runs
+func (c *Client) manageStreams() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.reconcile:
+		case <-ticker.C:
+		}
+		c.syncStreams()
+	}
+}
+
+// syncStreams opens the streams that are needed and closes the rest. Each
+// active run is streamed from its worker, so every run is persisted, and
+// each followed run or client from its worker or, if unknown, from every
+// worker.
+func (c *Client) syncStreams() {
+	c.mu.RLock()
+	workers := make(map[string]*worker, len(c.workers))
+	for address, w := range c.workers {
+		workers[address] = w
+	}
+	runs := make(map[string]string, len(c.runs))
+	for runID, address := range c.runs {
+		runs[runID] = address
+	}
+	c.mu.RUnlock()
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	desired := make(map[streamKey]bool)
+	onAllWorkers := func(filter string) {
+		for address := range workers {
+			desired[streamKey{address, filter}] = true
+		}
+	}
+
+	for runID, address := range runs {
+		desired[streamKey{address, filterRunPrefix + runID}] = true
+	}
+	for filter := range c.subRefs {
+		if runID, ok := strings.CutPrefix(filter, filterRunPrefix); ok {
+			if address, known := runs[runID]; known {
+				desired[streamKey{address, filter}] = true
+				continue
+			}
+		}
+		onAllWorkers(filter)
+	}
+
+	for key, s := range c.streams {
+		if !desired[key] {
+			s.cancel()
+			delete(c.streams, key)
+		}
+	}
+	for key := range desired {
+		if c.ctx.Err() != nil {
+			break
+		}
+		if _, ok := c.streams[key]; ok {
+			continue
+		}
+		if _, ok := workers[key.worker]; !ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(c.ctx)
+		s := &logStream{key: key, cancel: cancel}
+		c.streams[key] = s
+		c.wg.Add(1)
+		go c.handleLogStream(ctx, workers[key.worker], s)
+	}
+
+	// Forget runs nobody has followed for a while
+	for runID, rs := range c.runHealth {
+		if _, active := runs[runID]; active || c.subRefs[filterRunPrefix+runID] > 0 {
+			continue
+		}
+		if time.Since(rs.lastReceived) > runHealthRetention {
+			delete(c.runHealth, runID)
+		}
+	}
+}
+
+// handleLogStream receives logs on a stream until its context is cancelled.
+// A failed stream reconnects with backoff while the worker is unreachable,
+// asking the worker to replay what was missed since the last received log.
+func (c *Client) handleLogStream(ctx context.Context, w *worker, s *logStream) {
+	defer c.wg.Done()
+
+	failures := 0
+	for {
+		received, err := c.receiveLogs(ctx, w, s)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			failures = 0
+		}
+		failures++
+		c.streamDown(s, err)
+
+		delay := c.streamBackoff.Backoff(failures)
+		log.Printf("Log stream %s to %s failed: %v, reconnecting in %v", s.key.filter, w.address, err, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// receiveLogs opens a stream and receives logs until it fails. It reports
+// whether any log was received.
+func (c *Client) receiveLogs(ctx context.Context, w *worker, s *logStream) (bool, error) {
+	stream, err := w.client.StreamLogs(ctx, c.logRequest(w, s.key.filter))
+	if err != nil {
+		return false, err
+	}
+
+	c.subsMu.Lock()
+	s.connected = true
+	c.subsMu.Unlock()
+
+	received := false
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		c.handleLog(ctx, w, msg)
+	}
+}
+
+// logRequest builds the request of a stream. Each run the stream carries is
+// resumed after its last received sequence; a run nothing was received for
+// yet is replayed from the start.
+func (c *Client) logRequest(w *worker, filter string) *pb.LogRequest {
+	req := &pb.LogRequest{ResumeFrom: make(map[string]int64)}
+
+	runID, isRun := strings.CutPrefix(filter, filterRunPrefix)
+	clientID := strings.TrimPrefix(filter, filterClientPfx)
+	if isRun {
+		req.RunIds = []string{runID}
+		req.ResumeFrom[runID] = 0
+	} else {
+		req.ClientId = clientID
+	}
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for key, rs := range c.runHealth {
+		if rs.worker != w.address {
+			continue
+		}
+		if (isRun && key != runID) || (!isRun && rs.clientID != clientID) {
+			continue
+		}
+		req.ResumeFrom[key] = rs.lastSeq
+	}
+	return req
+}
+
+// streamDown records that a stream lost its connection
+func (c *Client) streamDown(s *logStream, err error) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	if s.connected {
+		s.reconnects++
+	}
+	s.connected = false
+	s.lastError = err.Error()
+}
+
+// acceptLog records a received log and reports whether it is new. Logs of a
+// run can arrive on more than one stream, or again after a reconnect. A log
+// that skips sequences after the last received one returns the gap.
+func (c *Client) acceptLog(w *worker, record *types.LogRecord) (bool, *LogGap) {
+	key := record.RunID
+	if key == "" {
+		key = record.ClientID
+	}
+
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	rs, ok := c.runHealth[key]
+	if !ok {
+		rs = &runStream{clientID: record.ClientID}
+		c.runHealth[key] = rs
+	}
+	if record.Seq <= rs.lastSeq && record.Timestamp <= rs.lastTimestamp {
+		rs.duplicates++
+		return false, nil
+	}
+
+	var gap *LogGap
+	if rs.lastSeq > 0 && record.Seq > rs.lastSeq+1 && rs.worker == w.address {
+		gap = &LogGap{
+			RunID:      record.RunID,
+			ClientID:   record.ClientID,
+			Worker:     w.address,
+			FromSeq:    rs.lastSeq + 1,
+			ToSeq:      record.Seq - 1,
+			Missing:    record.Seq - rs.lastSeq - 1,
+			DetectedAt: time.Now(),
+		}
+		rs.gaps++
+		rs.missing += gap.Missing
+		log.Printf("Missing logs %d-%d of %s from %s", gap.FromSeq, gap.ToSeq, key, w.address)
+	}
+
+	rs.worker = w.address
+	rs.lastSeq = record.Seq
+	rs.lastTimestamp = record.Timestamp
+	rs.lastReceived = time.Now()
+	rs.received++
+	return true, gap
+}
+
+// StreamHealth returns the stream state of every run logs were received
+// for recently, ordered by run ID
+func (c *Client) StreamHealth() []RunStreamHealth {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	health := make([]RunStreamHealth, 0, len(c.runHealth))
+	for runID := range c.runHealth {
+		health = append(health, c.runStreamHealth(runID))
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].RunID < health[j].RunID })
+	return health
+}
+
+// RunStreamHealth returns the stream state of a run
+func (c *Client) RunStreamHealth(runID string) (RunStreamHealth, bool) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	if _, ok := c.runHealth[runID]; !ok {
+		return RunStreamHealth{}, false
+	}
+	return c.runStreamHealth(runID), true
+}
+
+// runStreamHealth builds the health of a run from the streams that carry
+// it. The caller holds subsMu.
+func (c *Client) runStreamHealth(runID string) RunStreamHealth {
+	rs := c.runHealth[runID]
+	health := RunStreamHealth{
+		RunID:        runID,
+		ClientID:     rs.clientID,
+		Worker:       rs.worker,
+		Streams:      []string{},
+		LastSeq:      rs.lastSeq,
+		LastReceived: rs.lastReceived,
+		Received:     rs.received,
+		Duplicates:   rs.duplicates,
+		Gaps:         rs.gaps,
+		Missing:      rs.missing,
+	}
+
+	for key, s := range c.streams {
+		if key.worker != rs.worker {
+			continue
+		}
+		if key.filter != filterRunPrefix+runID && key.filter != filterClientPfx+rs.clientID {
+			continue
+		}
+		health.Streams = append(health.Streams, key.filter)
+		health.Connected = health.Connected || s.connected
+		health.Reconnects += s.reconnects
+		if s.lastError != "" {
+			health.LastError = s.lastError
+		}
+	}
+	sort.Strings(health.Streams)
+	return health
+}
@@ -0,0 +1,155 @@
+package grpc
+
+import (
+	"testing"
+
+	"backend/internal/types"
+)
+
+// streamCounts is the part of a run's stream state that acceptLog updates
+type streamCounts struct {
+	LastSeq, Received, Duplicates, Gaps, Missing int64
+}
+
+func TestAcceptLog(t *testing.T) {
+	workerA := &worker{address: "a:50051"}
+	workerB := &worker{address: "b:50051"}
+
+	// Each test feeds its logs in order to a new client and checks the
+	// result of the last one
+	tests := []struct {
+		name       string
+		worker     []*worker
+		logs       []types.LogRecord
+		wantNew    bool
+		wantGap    *LogGap
+		wantHealth streamCounts
+	}{
+		{
+			name:       "first log",
+			worker:     []*worker{workerA},
+			logs:       []types.LogRecord{{RunID: "r1", ClientID: "c1", Seq: 1, Timestamp: 100}},
+			wantNew:    true,
+			wantHealth: streamCounts{LastSeq: 1, Received: 1},
+		},
+		{
+			name:   "next log",
+			worker: []*worker{workerA, workerA},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 1, Timestamp: 100},
+				{RunID: "r1", ClientID: "c1", Seq: 2, Timestamp: 200},
+			},
+			wantNew:    true,
+			wantHealth: streamCounts{LastSeq: 2, Received: 2},
+		},
+		{
+			name:   "same log on another stream",
+			worker: []*worker{workerA, workerA},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 2, Timestamp: 200},
+				{RunID: "r1", ClientID: "c1", Seq: 2, Timestamp: 200},
+			},
+			wantHealth: streamCounts{LastSeq: 2, Received: 1, Duplicates: 1},
+		},
+		{
+			name:   "replayed older log",
+			worker: []*worker{workerA, workerA},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 5, Timestamp: 500},
+				{RunID: "r1", ClientID: "c1", Seq: 3, Timestamp: 300},
+			},
+			wantHealth: streamCounts{LastSeq: 5, Received: 1, Duplicates: 1},
+		},
+		{
+			name:   "restarted service numbers from 1 again",
+			worker: []*worker{workerA, workerA},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 5, Timestamp: 500},
+				{RunID: "r1", ClientID: "c1", Seq: 1, Timestamp: 600},
+			},
+			wantNew:    true,
+			wantHealth: streamCounts{LastSeq: 1, Received: 2},
+		},
+		{
+			name:   "skipped sequences are a gap",
+			worker: []*worker{workerA, workerA},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 2, Timestamp: 200},
+				{RunID: "r1", ClientID: "c1", Seq: 6, Timestamp: 600},
+			},
+			wantNew:    true,
+			wantGap:    &LogGap{RunID: "r1", ClientID: "c1", Worker: "a:50051", FromSeq: 3, ToSeq: 5, Missing: 3},
+			wantHealth: streamCounts{LastSeq: 6, Received: 2, Gaps: 1, Missing: 3},
+		},
+		{
+			name:   "no gap when the run moved to another worker",
+			worker: []*worker{workerA, workerB},
+			logs: []types.LogRecord{
+				{RunID: "r1", ClientID: "c1", Seq: 2, Timestamp: 200},
+				{RunID: "r1", ClientID: "c1", Seq: 6, Timestamp: 600},
+			},
+			wantNew:    true,
+			wantHealth: streamCounts{LastSeq: 6, Received: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{runHealth: make(map[string]*runStream)}
+
+			var accepted bool
+			var gap *LogGap
+			for i := range tt.logs {
+				accepted, gap = c.acceptLog(tt.worker[i], &tt.logs[i])
+			}
+
+			if accepted != tt.wantNew {
+				t.Errorf("acceptLog() new = %v, want %v", accepted, tt.wantNew)
+			}
+			switch {
+			case tt.wantGap == nil && gap != nil:
+				t.Errorf("acceptLog() gap = %+v, want none", *gap)
+			case tt.wantGap != nil && gap == nil:
+				t.Errorf("acceptLog() found no gap, want %+v", *tt.wantGap)
+			case tt.wantGap != nil:
+				gap.DetectedAt = tt.wantGap.DetectedAt
+				if *gap != *tt.wantGap {
+					t.Errorf("acceptLog() gap = %+v, want %+v", *gap, *tt.wantGap)
+				}
+			}
+
+			rs, ok := c.runHealth["r1"]
+			if !ok {
+				t.Fatal("no stream state for the run")
+			}
+			got := streamCounts{
+				LastSeq:    rs.lastSeq,
+				Received:   rs.received,
+				Duplicates: rs.duplicates,
+				Gaps:       rs.gaps,
+				Missing:    rs.missing,
+			}
+			if got != tt.wantHealth {
+				t.Errorf("stream health = %+v, want %+v", got, tt.wantHealth)
+			}
+		})
+	}
+}
+
+func TestAcceptLogWithoutRun(t *testing.T) {
+	c := &Client{runHealth: make(map[string]*runStream)}
+	w := &worker{address: "a:50051"}
+
+	// Logs outside a run are deduplicated per client
+	first := types.LogRecord{ClientID: "c1", Seq: 1, Timestamp: 100}
+	again := first
+	if ok, _ := c.acceptLog(w, &first); !ok {
+		t.Fatal("first client log was not accepted")
+	}
+	if ok, _ := c.acceptLog(w, &again); ok {
+		t.Error("repeated client log was accepted")
+	}
+	if _, ok := c.runHealth["c1"]; !ok {
+		t.Error("client log not tracked under the client ID")
+	}
+}
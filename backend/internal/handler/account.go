@@ -0,0 +1,405 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/database/models"
+	"backend/internal/mail"
+	"backend/internal/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// resetTokenTTL is how long a password reset link can be used
+const resetTokenTTL = time.Hour
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+	Name     string `json:"name"`
+}
+
+type UpgradeGuestRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+	Name     string `json:"name"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// UpdateProfileRequest changes the name or email of a user. Changing the
+// email needs the current password.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name"`
+	Email           *string `json:"email" binding:"omitempty,email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// Register creates a regular user and signs them in
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	email := strings.TrimSpace(req.Email)
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Email:     &email,
+		Name:      strings.TrimSpace(req.Name),
+		Type:      models.UserTypeRegular,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	err := h.userStore.Create(c, user)
+	if errors.Is(err, store.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	token, err := h.jwtService.GenerateToken(user.ID, string(user.Type))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+// UpgradeGuest registers the authenticated guest as a regular user. The
+// user ID stays the same, so the guest's runs and logs stay theirs. The
+// guest token is revoked and a regular token returned.
+func (h *AuthHandler) UpgradeGuest(c *gin.Context) {
+	var req UpgradeGuestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.Type != models.UserTypeGuest {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already registered"})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	user.Email = &email
+	user.Name = strings.TrimSpace(req.Name)
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade user"})
+		return
+	}
+
+	err := h.userStore.UpgradeGuest(c, user)
+	switch {
+	case errors.Is(err, store.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	case errors.Is(err, store.ErrNotGuest):
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already registered"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade user"})
+		return
+	}
+
+	token, err := h.jwtService.GenerateToken(user.ID, string(user.Type))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if claims, ok := c.MustGet("claims").(*auth.Claims); ok {
+		h.jwtService.Revoke(claims)
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token: token,
+		User:  *user,
+	})
+}
+
+// ChangePassword sets a new password for the authenticated user. Every
+// token of the user is revoked, so they sign in again with it.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.CheckPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if err := h.setPassword(c, user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// UpdateProfile changes the name or email of the authenticated user. A new
+// email is only accepted with the current password, so a leaked token
+// cannot redirect password resets.
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if req.Email != nil && user.Type != models.UserTypeRegular {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Guest users have no email"})
+		return
+	}
+
+	if req.Name != nil {
+		user.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if user.Email == nil || !strings.EqualFold(*user.Email, email) {
+			if !user.CheckPassword(req.CurrentPassword) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+				return
+			}
+		}
+		user.Email = &email
+	}
+
+	err := h.userStore.Update(c, user)
+	if errors.Is(err, store.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteAccount deletes the authenticated user with their runs, logs,
+// metrics and models, and revokes their tokens. Regular users confirm with
+// their password. Users with queued or running runs cancel them first.
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.Type == models.UserTypeRegular && !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	_, err := h.db.DeleteClientData(c.Request.Context(), user.ID)
+	if errors.Is(err, database.ErrClientActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cancel your queued and running runs first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	if err := h.userStore.Delete(c, user.ID); err != nil && !errors.Is(err, store.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	h.jwtService.RevokeUser(user.ID)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForgotPassword mails a password reset link. It answers the same whether
+// or not the email is registered, so emails cannot be probed.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.sendPasswordReset(c, strings.TrimSpace(req.Email)); err != nil {
+		log.Printf("Error sending password reset: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a reset link was sent"})
+}
+
+// ResetPassword sets a new password with a token from a reset link. Every
+// token of the user is revoked.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := h.userStore.ConsumePasswordReset(c, hashResetToken(req.Token))
+	if errors.Is(err, store.ErrInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	user, err := h.userStore.GetByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err := h.setPassword(c, user, req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset"})
+}
+
+// currentUser loads the authenticated user. It responds with 404 if the
+// user no longer exists.
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.userStore.GetByID(c, UserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// setPassword stores a new password and revokes the user's tokens
+func (h *AuthHandler) setPassword(c *gin.Context, user *models.User, password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	if err := h.userStore.Update(c, user); err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+	h.jwtService.RevokeUser(user.ID)
+	return nil
+}
+
+// sendPasswordReset stores a reset token for a registered user and mails
+// them the link to use it
+func (h *AuthHandler) sendPasswordReset(c *gin.Context, email string) error {
+	user, err := h.userStore.GetByEmail(c, email)
+	if errors.Is(err, store.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("looking up user: %w", err)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(resetTokenTTL)
+	if err := h.userStore.CreatePasswordReset(c, user.ID, hashResetToken(token), expiresAt); err != nil {
+		return fmt.Errorf("storing reset token: %w", err)
+	}
+
+	link, err := resetLink(h.resetURL, token)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(c, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use this link to choose a new password:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for it, ignore this email.\n",
+			link, resetTokenTTL),
+	})
+}
+
+// newResetToken returns a random password reset token. Only its hash is
+// stored.
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating reset token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// resetLink adds a reset token to the frontend's reset page URL
+func resetLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("parsing reset URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
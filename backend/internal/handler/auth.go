@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"backend/internal/auth"
+	"backend/internal/database"
 	"backend/internal/database/models"
+	"backend/internal/mail"
 	"backend/internal/store"
 
 	"github.com/gin-gonic/gin"
@@ -13,12 +15,19 @@ import (
 type AuthHandler struct {
 	userStore  *store.UserStore
 	jwtService *auth.JWTService
+	db         *database.Client
+	mailer     mail.Mailer
+	// Page of the frontend password reset links point to
+	resetURL string
 }
 
-func NewAuthHandler(userStore *store.UserStore, jwtService *auth.JWTService) *AuthHandler {
+func NewAuthHandler(userStore *store.UserStore, jwtService *auth.JWTService, db *database.Client, mailer mail.Mailer, resetURL string) *AuthHandler {
 	return &AuthHandler{
 		userStore:  userStore,
 		jwtService: jwtService,
+		db:         db,
+		mailer:     mailer,
+		resetURL:   resetURL,
 	}
 }
 
@@ -83,6 +92,58 @@ func (h *AuthHandler) CreateGuestUser(c *gin.Context) {
 	})
 }
 
+// Me returns the authenticated user
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, err := h.userStore.GetByID(c, UserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Logout revokes the token of the request, which also closes the
+// WebSockets opened with it
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if claims, ok := c.MustGet("claims").(*auth.Claims); ok {
+		h.jwtService.Revoke(claims)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// UserID returns the ID of the user authenticated by AuthMiddleware
+func UserID(c *gin.Context) string {
+	return c.GetString("user_id")
+}
+
+// authorizeClient checks that a client ID is the authenticated user's. It
+// responds with 403 if it is not.
+func authorizeClient(c *gin.Context, clientID string) bool {
+	if clientID != UserID(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to access this client"})
+		return false
+	}
+	return true
+}
+
+// AdminMiddleware lets only the given users through. It runs after
+// AuthMiddleware.
+func (h *AuthHandler) AdminMiddleware(admins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(admins))
+	for _, id := range admins {
+		allowed[id] = true
+	}
+	return func(c *gin.Context) {
+		if !allowed[UserID(c)] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // Middleware for JWT authentication
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -105,6 +166,7 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 
 		c.Set("user_id", claims.UserID)
 		c.Set("user_type", claims.Type)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
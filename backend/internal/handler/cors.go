@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSMiddleware allows cross-origin requests from the same origins as
+// WebSockets. Other origins get no CORS headers, so browsers block them.
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowed := checkOrigin(allowedOrigins)
+	return func(c *gin.Context) {
+		if origin := c.GetHeader("Origin"); origin != "" && allowed(c.Request) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		}
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
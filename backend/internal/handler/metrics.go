@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"backend/internal/hub"
+	"backend/internal/persist"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler exposes internal pipeline metrics
+type MetricsHandler struct {
+	pipeline *persist.Pipeline
+	logHub   *hub.Hub
+}
+
+// NewMetricsHandler creates a new metrics handler
+func NewMetricsHandler(pipeline *persist.Pipeline, logHub *hub.Hub) *MetricsHandler {
+	return &MetricsHandler{
+		pipeline: pipeline,
+		logHub:   logHub,
+	}
+}
+
+// GetLogPipelineStats returns throughput and backpressure of log persistence
+func (h *MetricsHandler) GetLogPipelineStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.pipeline.Stats())
+}
+
+// GetLogHubStats returns the fan-out of live logs to WebSocket connections
+func (h *MetricsHandler) GetLogHubStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.logHub.Stats())
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/internal/database"
+	"backend/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelHandler exposes the model registry
+type ModelHandler struct {
+	db *database.Client
+}
+
+// NewModelHandler creates a new model registry handler
+func NewModelHandler(db *database.Client) *ModelHandler {
+	return &ModelHandler{
+		db: db,
+	}
+}
+
+// TransitionRequest moves a model version to a stage: none, staging,
+// production or archived
+type TransitionRequest struct {
+	Stage  string `json:"stage" binding:"required"`
+	Reason string `json:"reason"`
+}
+
+// ListModels returns the authenticated user's model versions, optionally
+// filtered by model name and stage
+func (h *ModelHandler) ListModels(c *gin.Context) {
+	filter := database.ModelVersionFilter{
+		ClientID: UserID(c),
+		Name:     c.Query("name"),
+		Stage:    c.Query("stage"),
+	}
+	if filter.Stage != "" && !types.IsModelStage(filter.Stage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stage parameter"})
+		return
+	}
+
+	versions, err := h.db.ListModelVersions(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "count": len(versions)})
+}
+
+// GetModel describes a model version with its audit trail. The version is
+// given by ID or by alias, such as forecaster@production or forecaster@3.
+func (h *ModelHandler) GetModel(c *gin.Context) {
+	version, ok := h.resolveVersion(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.db.GetModelVersionEvents(c.Request.Context(), version.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": version, "events": events})
+}
+
+// TransitionModel moves a model version to another stage. Promoting a
+// version archives the version it replaces in staging or production.
+func (h *ModelHandler) TransitionModel(c *gin.Context) {
+	var req TransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !types.IsModelStage(req.Stage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid stage"})
+		return
+	}
+
+	version, ok := h.resolveVersion(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.db.TransitionModelVersion(c.Request.Context(), version.ID, req.Stage, UserID(c), req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// resolveVersion loads the authenticated user's model version named by the
+// versionId parameter. It responds with 404 if there is none, so version
+// IDs cannot be probed.
+func (h *ModelHandler) resolveVersion(c *gin.Context) (*types.ModelVersion, bool) {
+	version, err := h.db.ResolveModelVersion(c.Request.Context(), UserID(c), c.Param("versionId"))
+	if errors.Is(err, database.ErrModelVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model version not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return version, true
+}
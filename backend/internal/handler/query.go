@@ -2,10 +2,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"backend/internal/database"
 	"backend/internal/query"
 
 	"github.com/gin-gonic/gin"
@@ -26,6 +29,9 @@ func NewQueryHandler(queryService *query.QueryService) *QueryHandler {
 // GetModelState returns the current state of a specific model
 func (h *QueryHandler) GetModelState(c *gin.Context) {
 	clientID := c.Param("clientId")
+	if !authorizeClient(c, clientID) {
+		return
+	}
 
 	state, exists := h.queryService.GetModelState(clientID)
 	if !exists {
@@ -36,18 +42,62 @@ func (h *QueryHandler) GetModelState(c *gin.Context) {
 	c.JSON(http.StatusOK, state)
 }
 
-// GetRunningModels returns all currently running models
+// GetRun returns the state of a single run
+func (h *QueryHandler) GetRun(c *gin.Context) {
+	runID := c.Param("runId")
+
+	state, exists := h.queryService.GetRun(runID)
+	if !exists || state.ClientID != UserID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// GetRunEvents returns the lifecycle transitions of a run
+func (h *QueryHandler) GetRunEvents(c *gin.Context) {
+	runID := c.Param("runId")
+	if !h.authorizeRun(c, runID) {
+		return
+	}
+
+	events, err := h.queryService.GetRunEvents(c.Request.Context(), runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events, "count": len(events)})
+}
+
+// GetRunningModels returns the running models of the authenticated user
 func (h *QueryHandler) GetRunningModels(c *gin.Context) {
-	models := h.queryService.GetRunningModels()
+	models := make([]*query.ModelState, 0)
+	for _, state := range h.queryService.GetRunningModels() {
+		if state.ClientID == UserID(c) {
+			models = append(models, state)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"models": models, "count": len(models)})
 }
 
-// QueryModelHistory returns filtered model history
+// QueryModelHistory returns filtered, sorted and paginated model history.
+// Sort keys are start_time, runtime and status; config fields are filtered
+// with config.<name>=[op:]value like log search field predicates. The
+// exit_reason filter tells ended runs apart: runs the watchdog failed have
+// status error with exit_reason lost or timed_out, and cancelled runs have
+// status cancelled with exit_reason cancelled, killed or
+// cancelled_while_queued.
 func (h *QueryHandler) QueryModelHistory(c *gin.Context) {
-	// Parse query parameters
-	clientID := c.Query("client_id")
+	// Parse query parameters. Users only see their own runs.
+	clientID := c.DefaultQuery("client_id", UserID(c))
+	if !authorizeClient(c, clientID) {
+		return
+	}
 	processType := c.Query("process_type")
 	status := c.Query("status")
+	exitReason := c.Query("exit_reason")
 
 	// Parse time range parameters
 	var fromTime, toTime time.Time
@@ -75,7 +125,7 @@ func (h *QueryHandler) QueryModelHistory(c *gin.Context) {
 
 	if limitStr := c.Query("limit"); limitStr != "" {
 		limit, err = strconv.Atoi(limitStr)
-		if err != nil || limit < 0 {
+		if err != nil || limit <= 0 || limit > 500 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
 			return
 		}
@@ -89,30 +139,79 @@ func (h *QueryHandler) QueryModelHistory(c *gin.Context) {
 		}
 	}
 
+	// Parse runtime range parameters, in seconds
+	var minRuntime, maxRuntime *float64
+	for name, target := range map[string]**float64{"min_runtime": &minRuntime, "max_runtime": &maxRuntime} {
+		if valueStr := c.Query(name); valueStr != "" {
+			value, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil || value < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " parameter"})
+				return
+			}
+			*target = &value
+		}
+	}
+
+	sortOrder := c.DefaultQuery("order", "desc")
+	if sortOrder != "asc" && sortOrder != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order parameter"})
+		return
+	}
+
 	// Create filter
 	filter := query.QueryFilter{
 		ClientID:      clientID,
 		ProcessType:   processType,
 		Status:        status,
+		ExitReason:    exitReason,
 		StartTimeFrom: fromTime,
 		StartTimeTo:   toTime,
+		MinRuntime:    minRuntime,
+		MaxRuntime:    maxRuntime,
+		SortBy:        c.DefaultQuery("sort", database.RunSortStartTime),
+		SortOrder:     sortOrder,
+		Cursor:        c.Query("cursor"),
 		Limit:         limit,
 		Offset:        offset,
 	}
 
+	// Config predicates are given as config.<name>=[op:]value
+	for key, values := range c.Request.URL.Query() {
+		name, ok := strings.CutPrefix(key, "config.")
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			filter.Config = append(filter.Config, parseFieldPredicate(name, value))
+		}
+	}
+
 	// Query model history
-	history := h.queryService.QueryModelHistory(filter)
+	history, err := h.queryService.QueryModelHistory(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidRunQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"models": history,
-		"count":  len(history),
-		"filter": filter,
+		"models":      history.Models,
+		"count":       history.Count,
+		"total":       history.Total,
+		"next_cursor": history.NextCursor,
+		"filter":      filter,
 	})
 }
 
 // GetLogSummary returns summarized log information
 func (h *QueryHandler) GetLogSummary(c *gin.Context) {
 	clientID := c.Param("clientId")
+	if !authorizeClient(c, clientID) {
+		return
+	}
 
 	// Parse time range parameters
 	var fromTime, toTime time.Time
@@ -149,3 +248,235 @@ func (h *QueryHandler) GetLogSummary(c *gin.Context) {
 
 	c.JSON(http.StatusOK, summary)
 }
+
+// SearchLogs searches logs by text, regex, level, logger, process and fields.
+// Structured field predicates are given as field.<name>=[op:]value, where op
+// is one of eq, ne, gt, gte, lt, lte, contains or exists.
+func (h *QueryHandler) SearchLogs(c *gin.Context) {
+	// Users only search their own logs
+	search := database.LogSearch{
+		ClientID: c.DefaultQuery("client_id", UserID(c)),
+		RunID:    c.Query("run_id"),
+		Text:     c.Query("q"),
+		Regex:    c.Query("regex"),
+		Logger:   c.Query("logger"),
+		Limit:    50,
+	}
+	if !authorizeClient(c, search.ClientID) {
+		return
+	}
+
+	for _, level := range c.QueryArray("level") {
+		for _, l := range strings.Split(level, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				search.Levels = append(search.Levels, strings.ToUpper(l))
+			}
+		}
+	}
+
+	if pidStr := c.Query("process_id"); pidStr != "" {
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid process_id parameter"})
+			return
+		}
+		search.ProcessID = &pid
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+			return
+		}
+		search.Limit = limit
+	}
+
+	// Parse time range parameters, defaulting to the last week
+	var err error
+	search.To = time.Now()
+	if toStr := c.Query("to"); toStr != "" {
+		search.To, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time format"})
+			return
+		}
+	}
+	search.From = search.To.Add(-7 * 24 * time.Hour)
+	if fromStr := c.Query("from"); fromStr != "" {
+		search.From, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time format"})
+			return
+		}
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		name, ok := strings.CutPrefix(key, "field.")
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			search.Fields = append(search.Fields, parseFieldPredicate(name, value))
+		}
+	}
+
+	results, err := h.queryService.SearchLogs(c.Request.Context(), search, c.Query("cursor"))
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// maxCompareRuns is the most runs a metric comparison overlays
+const maxCompareRuns = 10
+
+// GetRunMetrics returns the metrics of a run downsampled into time buckets.
+// Metrics are chosen with name (repeated or comma separated), the bucket
+// width with bucket as a duration, or else about points buckets are made.
+func (h *QueryHandler) GetRunMetrics(c *gin.Context) {
+	runID := c.Param("runId")
+	if !h.authorizeRun(c, runID) {
+		return
+	}
+
+	q := database.MetricQuery{RunID: runID, Names: splitQueryArray(c, "name")}
+
+	var err error
+	if fromStr := c.Query("from"); fromStr != "" {
+		q.From, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time format"})
+			return
+		}
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		q.To, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time format"})
+			return
+		}
+	}
+	if bucketStr := c.Query("bucket"); bucketStr != "" {
+		q.Bucket, err = time.ParseDuration(bucketStr)
+		if err != nil || q.Bucket <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bucket parameter"})
+			return
+		}
+	}
+	var ok bool
+	if q.Points, ok = metricPoints(c); !ok {
+		return
+	}
+
+	series, err := h.queryService.GetRunMetrics(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// CompareRunMetrics overlays a metric of several runs of the authenticated
+// user, aligned by step, for comparison charts
+func (h *QueryHandler) CompareRunMetrics(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing name parameter"})
+		return
+	}
+
+	runIDs := splitQueryArray(c, "run_id")
+	if len(runIDs) == 0 || len(runIDs) > maxCompareRuns {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give between 1 and 10 run_id parameters"})
+		return
+	}
+	for _, runID := range runIDs {
+		if !h.authorizeRun(c, runID) {
+			return
+		}
+	}
+
+	points, ok := metricPoints(c)
+	if !ok {
+		return
+	}
+
+	comparison, err := h.queryService.CompareRunMetrics(c.Request.Context(), runIDs, name, points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
+// metricPoints parses the points parameter of metric queries. It responds
+// with 400 if the parameter is invalid.
+func metricPoints(c *gin.Context) (int, bool) {
+	pointsStr := c.Query("points")
+	if pointsStr == "" {
+		return database.DefaultMetricPoints, true
+	}
+	points, err := strconv.Atoi(pointsStr)
+	if err != nil || points <= 0 || points > database.MaxMetricPoints {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid points parameter"})
+		return 0, false
+	}
+	return points, true
+}
+
+// splitQueryArray returns the values of a repeated or comma separated
+// query parameter, without duplicates
+func splitQueryArray(c *gin.Context, key string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, value := range c.QueryArray(key) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" && !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// authorizeRun checks that a run belongs to the authenticated user. It
+// responds with 404 if it does not, so run IDs cannot be probed.
+func (h *QueryHandler) authorizeRun(c *gin.Context, runID string) bool {
+	clientID, err := h.queryService.RunClient(c.Request.Context(), runID)
+	if errors.Is(err, database.ErrRunNotFound) || (err == nil && clientID != UserID(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// parseFieldPredicate parses a field.<name>=[op:]value query parameter
+func parseFieldPredicate(name, value string) database.FieldPredicate {
+	if value == database.FieldOpExists {
+		return database.FieldPredicate{Key: name, Op: database.FieldOpExists}
+	}
+
+	if op, rest, ok := strings.Cut(value, ":"); ok {
+		switch op {
+		case database.FieldOpEq, database.FieldOpNe, database.FieldOpGt, database.FieldOpGte,
+			database.FieldOpLt, database.FieldOpLte, database.FieldOpContains:
+			return database.FieldPredicate{Key: name, Op: op, Value: rest}
+		}
+	}
+
+	return database.FieldPredicate{Key: name, Op: database.FieldOpEq, Value: value}
+}
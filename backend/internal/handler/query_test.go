@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"testing"
+
+	"backend/internal/database"
+)
+
+func TestParseFieldPredicate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  database.FieldPredicate
+	}{
+		{"plain value", "adam", database.FieldPredicate{Key: "k", Op: database.FieldOpEq, Value: "adam"}},
+		{"empty value", "", database.FieldPredicate{Key: "k", Op: database.FieldOpEq}},
+		{"exists", "exists", database.FieldPredicate{Key: "k", Op: database.FieldOpExists}},
+		{"eq", "eq:exists", database.FieldPredicate{Key: "k", Op: database.FieldOpEq, Value: "exists"}},
+		{"ne", "ne:sgd", database.FieldPredicate{Key: "k", Op: database.FieldOpNe, Value: "sgd"}},
+		{"gt", "gt:0.5", database.FieldPredicate{Key: "k", Op: database.FieldOpGt, Value: "0.5"}},
+		{"gte", "gte:1", database.FieldPredicate{Key: "k", Op: database.FieldOpGte, Value: "1"}},
+		{"lt", "lt:-2", database.FieldPredicate{Key: "k", Op: database.FieldOpLt, Value: "-2"}},
+		{"lte", "lte:3", database.FieldPredicate{Key: "k", Op: database.FieldOpLte, Value: "3"}},
+		{"contains", "contains:err", database.FieldPredicate{Key: "k", Op: database.FieldOpContains, Value: "err"}},
+		{"only the first colon splits", "eq:a:b", database.FieldPredicate{Key: "k", Op: database.FieldOpEq, Value: "a:b"}},
+		{"unknown operator is part of the value", "http://host", database.FieldPredicate{Key: "k", Op: database.FieldOpEq, Value: "http://host"}},
+		{"operators are case sensitive", "GT:1", database.FieldPredicate{Key: "k", Op: database.FieldOpEq, Value: "GT:1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFieldPredicate("k", tt.value); got != tt.want {
+				t.Errorf("parseFieldPredicate(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"backend/internal/database"
+	"backend/internal/orchestrator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueueHandler exposes the orchestrator job queue
+type QueueHandler struct {
+	orchestrator *orchestrator.MLOrchestrator
+}
+
+// NewQueueHandler creates a new queue handler
+func NewQueueHandler(orchestrator *orchestrator.MLOrchestrator) *QueueHandler {
+	return &QueueHandler{
+		orchestrator: orchestrator,
+	}
+}
+
+// ReorderRequest moves a queued job. Priority is a priority class,
+// interactive or batch, no higher than the job's current one; position is
+// the 1-based place among the user's own jobs of the class.
+type ReorderRequest struct {
+	Priority string `json:"priority"`
+	Position int    `json:"position"`
+}
+
+// GetQueue returns the authenticated user's queued and running jobs with
+// the concurrency limits
+func (h *QueueHandler) GetQueue(c *gin.Context) {
+	queue, err := h.orchestrator.Queue(c.Request.Context(), UserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// ReorderJob lowers the priority class or changes the position of one of
+// the authenticated user's queued jobs among their own jobs, so nobody can
+// jump ahead of other users. Other users' jobs are not found.
+func (h *QueueHandler) ReorderJob(c *gin.Context) {
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Position < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid position"})
+		return
+	}
+
+	err := h.orchestrator.ReorderJob(c.Request.Context(), UserID(c), c.Param("runId"), req.Priority, req.Position)
+	switch {
+	case errors.Is(err, orchestrator.ErrUnknownPriority):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, database.ErrJobPriorityRaised):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Job priority cannot be raised"})
+		return
+	case errors.Is(err, database.ErrJobNotQueued):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not queued"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetQueue(c)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"backend/internal/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type RESTHandler struct {
@@ -27,6 +29,7 @@ func NewRESTHandler(db *database.Client, grpcClient *grpc.Client, producer *even
 	}
 }
 
+// HandleTrain queues a training run for the authenticated user
 func (h *RESTHandler) HandleTrain(c *gin.Context) {
 	var req types.ModelRequest
 	if err := c.BindJSON(&req); err != nil {
@@ -34,11 +37,25 @@ func (h *RESTHandler) HandleTrain(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !bindClient(c, &req) {
+		return
+	}
+
+	// Every request starts a new run so a client can have several at once
+	runID := uuid.New().String()
+
+	// Record the run so it shows up in history before it starts
+	if err := h.db.CreateRun(c.Request.Context(), runID, req.ClientID, "train", req.Configuration); err != nil {
+		log.Printf("Failed to record train run %s: %v", runID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record run"})
+		return
+	}
 
 	// Publish train request event to Kafka
 	err := h.producer.PublishTrainRequest(
 		c.Request.Context(),
 		req.ClientID,
+		runID,
 		req.Data,
 		req.StartDate,
 		req.EndDate,
@@ -53,24 +70,58 @@ func (h *RESTHandler) HandleTrain(c *gin.Context) {
 	// Return immediate acknowledgment
 	c.JSON(http.StatusAccepted, gin.H{
 		"client_id": req.ClientID,
+		"run_id":    runID,
 		"status":    "pending",
 		"message":   "Training request has been queued",
 	})
 }
 
+// HandlePredict queues a prediction run for the authenticated user. The
+// request may name a registered model to predict with, as a version ID or
+// an alias such as forecaster@production. Without one the default model's
+// production version is used, or else the newest registered version.
 func (h *RESTHandler) HandlePredict(c *gin.Context) {
 	var req types.ModelRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !bindClient(c, &req) {
+		return
+	}
+
+	model, err := h.predictionModel(c, req)
+	if errors.Is(err, database.ErrModelVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model version not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if model != nil && model.Stage == types.StageArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Model version is archived"})
+		return
+	}
+
+	// Every request starts a new run so a client can have several at once
+	runID := uuid.New().String()
+
+	// Record the run so it shows up in history before it starts
+	if err := h.db.CreateRun(c.Request.Context(), runID, req.ClientID, "predict", req.Configuration); err != nil {
+		log.Printf("Failed to record predict run %s: %v", runID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record run"})
+		return
+	}
 
 	// Publish predict request event to Kafka
-	err := h.producer.PublishPredictRequest(
+	err = h.producer.PublishPredictRequest(
 		c.Request.Context(),
 		req.ClientID,
+		runID,
 		req.Data,
 		req.Configuration,
+		model,
 	)
 	if err != nil {
 		log.Printf("Failed to publish predict event: %v", err)
@@ -79,15 +130,23 @@ func (h *RESTHandler) HandlePredict(c *gin.Context) {
 	}
 
 	// Return immediate acknowledgment
-	c.JSON(http.StatusAccepted, gin.H{
+	response := gin.H{
 		"client_id": req.ClientID,
+		"run_id":    runID,
 		"status":    "pending",
 		"message":   "Prediction request has been queued",
-	})
+	}
+	if model != nil {
+		response["model_version_id"] = model.ID
+	}
+	c.JSON(http.StatusAccepted, response)
 }
 
 func (h *RESTHandler) HandleStatus(c *gin.Context) {
 	clientID := c.Param("clientId")
+	if !authorizeClient(c, clientID) {
+		return
+	}
 	status, err := h.db.GetModelStatus(c.Request.Context(), clientID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -96,3 +155,89 @@ func (h *RESTHandler) HandleStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, status)
 }
+
+// HandleCancel asks the orchestrator to stop a run. The run is given as
+// run_id in the body; without one the client's latest run is cancelled.
+func (h *RESTHandler) HandleCancel(c *gin.Context) {
+	clientID := c.Param("clientId")
+	if !authorizeClient(c, clientID) {
+		return
+	}
+
+	var req struct {
+		RunID  string `json:"run_id"`
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	if req.RunID == "" {
+		status, err := h.db.GetModelStatus(ctx, clientID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No run found for client"})
+			return
+		}
+		req.RunID = status.RunID
+	}
+
+	run, err := h.db.GetRun(ctx, req.RunID)
+	if errors.Is(err, database.ErrRunNotFound) || (err == nil && run.ClientID != clientID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if types.IsTerminalStatus(run.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Run already %s", run.Status)})
+		return
+	}
+
+	if err := h.producer.PublishCancelRequest(ctx, clientID, req.RunID, req.Reason); err != nil {
+		log.Printf("Failed to publish cancel event: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to publish event: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"client_id": clientID,
+		"run_id":    req.RunID,
+		"status":    "cancelling",
+		"message":   "Cancellation has been requested",
+	})
+}
+
+// predictionModel returns the registered model version a prediction uses.
+// It is nil when the request names no model and the client has no
+// registered versions; the process then loads the client's last trained
+// model.
+func (h *RESTHandler) predictionModel(c *gin.Context, req types.ModelRequest) (*types.ModelVersion, error) {
+	ctx := c.Request.Context()
+	if req.Model != "" {
+		return h.db.ResolveModelVersion(ctx, req.ClientID, req.Model)
+	}
+
+	model, err := h.db.ResolveModelVersion(ctx, req.ClientID, database.DefaultModelName+"@"+types.StageProduction)
+	if errors.Is(err, database.ErrModelVersionNotFound) {
+		model, err = h.db.LatestModelVersion(ctx, req.ClientID)
+	}
+	if errors.Is(err, database.ErrModelVersionNotFound) {
+		return nil, nil
+	}
+	return model, err
+}
+
+// bindClient runs a model request as the authenticated user. A request for
+// another client is rejected with 403.
+func bindClient(c *gin.Context, req *types.ModelRequest) bool {
+	if req.ClientID == "" {
+		req.ClientID = UserID(c)
+	}
+	return authorizeClient(c, req.ClientID)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 
@@ -29,10 +30,15 @@ func NewStatusHandler(db *database.Client, wsHandler *WebSocketHandler, consumer
 	}
 
 	// Subscribe to status events
+	consumer.Subscribe(event.EventTypeModelQueued, handler.handleStatusUpdate)
 	consumer.Subscribe(event.EventTypeModelStarted, handler.handleStatusUpdate)
 	consumer.Subscribe(event.EventTypeModelCompleted, handler.handleStatusUpdate)
 	consumer.Subscribe(event.EventTypeModelFailed, handler.handleStatusUpdate)
 	consumer.Subscribe(event.EventTypeModelProgress, handler.handleStatusUpdate)
+	consumer.Subscribe(event.EventTypeModelCancelled, handler.handleStatusUpdate)
+	consumer.Subscribe(event.EventTypeModelMetrics, handler.handleMetrics)
+	consumer.Subscribe(event.EventTypeServiceUnavailable, handler.handleServiceStatus)
+	consumer.Subscribe(event.EventTypeServiceAvailable, handler.handleServiceStatus)
 
 	return handler
 }
@@ -66,6 +72,8 @@ func (h *StatusHandler) handleStatusUpdate(ctx context.Context, eventType event.
 	status := statusEvent.Status
 	if status == "" {
 		switch eventType {
+		case event.EventTypeModelQueued:
+			status = types.StatusQueued
 		case event.EventTypeModelStarted:
 			status = "running"
 		case event.EventTypeModelCompleted:
@@ -74,22 +82,58 @@ func (h *StatusHandler) handleStatusUpdate(ctx context.Context, eventType event.
 			status = "error"
 		case event.EventTypeModelProgress:
 			status = "running"
+		case event.EventTypeModelCancelled:
+			status = types.StatusCancelled
 		}
 	}
 
-	// Update status in database
+	// Events from producers that predate runs use the client ID as the run
+	runID := statusEvent.RunID
+	if runID == "" {
+		runID = statusEvent.ClientID
+	}
+
 	modelStatus := types.ModelStatus{
 		ClientID:    statusEvent.ClientID,
+		RunID:       runID,
 		Status:      status,
 		Message:     statusEvent.Message,
 		Timestamp:   statusEvent.Timestamp,
 		ProcessType: statusEvent.ProcessType,
+
+		QueuePosition: statusEvent.QueuePosition,
+		Progress:      statusEvent.ProgressDetail,
 	}
 
-	// Update database
-	if err := h.db.UpdateModelStatus(ctx, modelStatus); err != nil {
-		log.Printf("Failed to update model status in database: %v", err)
+	// Record the transition in the run history
+	recorded, err := h.db.RecordRunTransition(ctx, database.RunTransition{
+		EventID:     statusEvent.ID,
+		EventType:   string(eventType),
+		RunID:       runID,
+		ClientID:    statusEvent.ClientID,
+		ProcessType: statusEvent.ProcessType,
+		Status:      status,
+		Message:     statusEvent.Message,
+		Progress:    statusEvent.Progress,
+		Config:      statusEvent.Config,
+		ProcessID:   statusEvent.ProcessID,
+		ExitReason:  statusEvent.ExitReason,
+		Metrics:     statusEvent.Metrics,
+		Timestamp:   statusEvent.Timestamp,
+
+		ProgressDetail: statusEvent.ProgressDetail,
+	})
+	if err != nil {
+		log.Printf("Failed to record run transition in database: %v", err)
 		// Continue anyway to update WebSocket clients
+	} else if !recorded {
+		// Already handled this event
+		return nil
+	}
+
+	// Successful training runs become versions in the model registry
+	if eventType == event.EventTypeModelCompleted {
+		h.registerModel(ctx, runID, statusEvent.Artifact)
 	}
 
 	// Cache status
@@ -97,23 +141,99 @@ func (h *StatusHandler) handleStatusUpdate(ctx context.Context, eventType event.
 	h.clientStatus[statusEvent.ClientID] = modelStatus
 	h.mu.Unlock()
 
-	// Broadcast to WebSocket clients
+	// Broadcast to WebSocket clients. Progress goes out throttled, and
+	// progress still held back is dropped once a run ends.
+	if eventType == event.EventTypeModelProgress {
+		h.wsHandler.PublishProgress(modelStatus)
+		return nil
+	}
+	if types.IsTerminalStatus(status) {
+		h.wsHandler.ClearProgress(runID)
+	}
 	h.broadcastStatus(modelStatus)
+	switch eventType {
+	case event.EventTypeModelQueued, event.EventTypeModelStarted, event.EventTypeModelCancelled:
+		h.wsHandler.PublishQueueUpdate(modelStatus)
+	}
 
 	return nil
 }
 
-// broadcastStatus sends a status update to relevant WebSocket clients
-func (h *StatusHandler) broadcastStatus(status types.ModelStatus) {
-	msg := types.WSMessage{
-		Type:    types.MessageTypeModelStatus,
-		Payload: status,
+// registerModel registers a completed run as a model version if it was a
+// training run
+func (h *StatusHandler) registerModel(ctx context.Context, runID, artifact string) {
+	version, registered, err := h.db.RegisterModelVersion(ctx, runID, artifact)
+	if errors.Is(err, database.ErrRunNotRegistrable) {
+		return
 	}
+	if err != nil {
+		log.Printf("Failed to register model of run %s: %v", runID, err)
+		return
+	}
+	if registered {
+		log.Printf("Registered run %s as %s version %d", runID, version.Name, version.Version)
+	}
+}
 
-	h.wsHandler.BroadcastToClient(status.ClientID, msg)
+// handleServiceStatus tells all WebSocket clients when the ML service
+// becomes unavailable or recovers
+func (h *StatusHandler) handleServiceStatus(ctx context.Context, eventType event.EventType, data []byte) error {
+	e, err := event.Deserialize(data, eventType)
+	if err != nil {
+		log.Printf("Error deserializing service status event: %v", err)
+		return err
+	}
+
+	h.wsHandler.BroadcastToAll(types.WSMessage{
+		Type:    types.MessageTypeServiceStatus,
+		Payload: e,
+	})
+	return nil
+}
+
+// handleMetrics stores the metrics a run reported and sends the points that
+// were new to WebSocket clients following the run's logs. Redelivered
+// events store nothing and send nothing.
+func (h *StatusHandler) handleMetrics(ctx context.Context, eventType event.EventType, data []byte) error {
+	e, err := event.Deserialize(data, eventType)
+	if err != nil {
+		log.Printf("Error deserializing metrics event: %v", err)
+		return err
+	}
+	metricsEvent, ok := e.(*event.MetricsEvent)
+	if !ok || metricsEvent.RunID == "" || len(metricsEvent.Metrics) == 0 {
+		return nil
+	}
+
+	points := make([]types.MetricPoint, 0, len(metricsEvent.Metrics))
+	for name, value := range metricsEvent.Metrics {
+		points = append(points, types.MetricPoint{
+			RunID:    metricsEvent.RunID,
+			ClientID: metricsEvent.ClientID,
+			Name:     name,
+			Step:     metricsEvent.Step,
+			Time:     metricsEvent.Timestamp,
+			Value:    value,
+		})
+	}
+
+	inserted, err := h.db.InsertRunMetrics(ctx, points)
+	if err != nil {
+		log.Printf("Error storing metrics of run %s: %v", metricsEvent.RunID, err)
+		return err
+	}
+	if inserted > 0 {
+		h.wsHandler.PublishMetrics(metricsEvent.ClientID, metricsEvent.RunID, points)
+	}
+	return nil
+}
+
+// broadcastStatus sends a status update to relevant WebSocket clients
+func (h *StatusHandler) broadcastStatus(status types.ModelStatus) {
+	h.wsHandler.PublishStatus(status)
 }
 
-// GetStatus retrieves the current status for a client
+// GetStatus retrieves the status of a client's latest run
 func (h *StatusHandler) GetStatus(clientID string) (types.ModelStatus, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
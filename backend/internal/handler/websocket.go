@@ -4,20 +4,26 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"sync"
 	"time"
 
-	"backend/internal/buffer"
+	"backend/internal/auth"
 	"backend/internal/database"
 	"backend/internal/grpc"
+	"backend/internal/hub"
 	"backend/internal/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// maxHistoryLimit caps the number of logs returned by one history request
+const maxHistoryLimit = 1000
+
 // WebSocketHandler manages WebSocket connections and message handling
 type WebSocketHandler struct {
 	// Connections management
@@ -30,11 +36,21 @@ type WebSocketHandler struct {
 	// Dependencies
 	db         *database.Client
 	grpcClient *grpc.Client
+	jwtService *auth.JWTService
+	tickets    *auth.Tickets
 
 	// WebSocket upgrader
 	upgrader websocket.Upgrader
 
-	logBuffer *buffer.LogBuffer
+	// Live logs, queued per connection, and what each connection follows
+	logHub   *hub.Hub
+	sessions map[*types.WSConnection]*wsSession
+
+	// Log subscriptions of clients with open connections
+	viewers map[string]*grpc.LogSubscription
+
+	// Progress messages, throttled per run
+	progress *progressThrottle
 }
 
 // GetClientConnections returns all WebSocket connections for a client
@@ -48,39 +64,70 @@ func (h *WebSocketHandler) GetClientConnections(clientID string) []*types.WSConn
 	return connections
 }
 
-// NewWebSocketHandler creates a new WebSocket handler
-func NewWebSocketHandler(db *database.Client, grpcClient *grpc.Client, logBuffer *buffer.LogBuffer) *WebSocketHandler {
-	return &WebSocketHandler{
+// NewWebSocketHandler creates a new WebSocket handler. Connections from the
+// given origins are accepted.
+func NewWebSocketHandler(db *database.Client, grpcClient *grpc.Client, logHub *hub.Hub,
+	jwtService *auth.JWTService, allowedOrigins []string) *WebSocketHandler {
+	h := &WebSocketHandler{
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			CheckOrigin:  checkOrigin(allowedOrigins),
+			Subprotocols: []string{bearerProtocol},
 		},
 		connections: make(map[*types.WSConnection]bool),
 		clients:     make(map[string][]*types.WSConnection),
-		logBuffer:   logBuffer,
+		viewers:     make(map[string]*grpc.LogSubscription),
+		logHub:      logHub,
+		sessions:    make(map[*types.WSConnection]*wsSession),
 		db:          db,
 		grpcClient:  grpcClient,
+		jwtService:  jwtService,
+		tickets:     auth.NewTickets(wsTicketTTL),
 	}
+	h.progress = newProgressThrottle(h.sendProgress)
+
+	// Close connections whose token is revoked
+	jwtService.OnRevoke(h.handleTokenRevoked)
+	return h
 }
 
-// HandleConnection handles new WebSocket connections
+// HandleConnection handles new WebSocket connections. The upgrade must
+// carry a valid token, and users can only watch their own client ID, which
+// is the default.
 func (h *WebSocketHandler) HandleConnection(c *gin.Context) {
+	claims, err := h.authenticate(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	clientID := c.Query("clientId")
+	if clientID == "" {
+		clientID = claims.UserID
+	}
+	if clientID != claims.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to watch this client"})
+		return
+	}
+
 	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Error upgrading to WebSocket: %v", err)
 		return
 	}
 
-	clientID := c.Query("clientId")
 	conn := &types.WSConnection{
 		Conn:     ws,
 		ClientID: clientID,
+		UserID:   claims.UserID,
+		TokenID:  claims.Id,
+	}
+	if claims.ExpiresAt > 0 {
+		conn.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
 	}
 
-	h.registerConnection(conn)
+	sub := h.registerConnection(conn)
 	go h.handleMessages(conn)
-	go h.streamLogs(conn)
+	go h.pumpLogs(conn, sub)
 }
 
 // BroadcastToClient sends a message to all connections for a specific client
@@ -118,67 +165,97 @@ func (h *WebSocketHandler) BroadcastToAll(message types.WSMessage) {
 	}
 }
 
-func (h *WebSocketHandler) streamLogs(conn *types.WSConnection) {
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	noDataCount := 0
-	maxEmptyChecks := 500 // Stop after ~5 seconds of no data
+// HandleLogGap tells the connections viewing a run that some of its logs
+// are missing, so viewers can mark the gap in the log
+func (h *WebSocketHandler) HandleLogGap(gap grpc.LogGap) {
+	connections := h.topicConnections(gap.ClientID, true, topicLogsPrefix+gap.RunID)
+	h.sendToConnections(connections, types.WSMessage{
+		Type:    types.MessageTypeLogGap,
+		Payload: gap,
+	})
+}
 
+// pumpLogs writes the logs queued for a connection as they are published.
+// A connection that fell behind under the disconnect policy is closed.
+func (h *WebSocketHandler) pumpLogs(conn *types.WSConnection, sub *hub.Subscription) {
 	for {
 		select {
-		case <-ticker.C:
-			if !h.logBuffer.HasLogs(conn.ClientID) {
-				noDataCount++
-				if noDataCount >= maxEmptyChecks {
-					return
-				}
-				continue
+		case <-sub.Done():
+			if errors.Is(sub.Err(), hub.ErrSlowConsumer) {
+				log.Printf("Disconnecting slow WebSocket client %s", conn.ClientID)
+				h.disconnect(conn, websocket.CloseTryAgainLater, "too slow to keep up with logs")
 			}
+			return
+		case <-sub.Ready():
+		}
 
-			noDataCount = 0
-			logs := h.logBuffer.PopLogs(conn.ClientID)
-
-			if len(logs) > 0 {
-				for _, logMsg := range logs {
-					message := types.WSMessage{
-						Type:    types.MessageTypeLiveLog,
-						Payload: logMsg,
-					}
-
-					if err := conn.WriteJSON(message); err != nil {
-						log.Printf("Error sending to websocket: %v", err)
-						return
-					}
-				}
+		logs, skipped := sub.Take()
+		if skipped > 0 {
+			message := types.WSMessage{
+				Type:    types.MessageTypeLogsSkipped,
+				Payload: gin.H{"skipped": skipped},
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				log.Printf("Error sending to websocket: %v", err)
+				return
+			}
+		}
+		for _, logMsg := range logs {
+			message := types.WSMessage{
+				Type:    types.MessageTypeLiveLog,
+				Payload: logMsg,
+			}
+			if err := conn.WriteJSON(message); err != nil {
+				log.Printf("Error sending to websocket: %v", err)
+				return
 			}
 		}
 	}
 }
 
-// registerConnection adds a new WebSocket connection to the handler
-func (h *WebSocketHandler) registerConnection(conn *types.WSConnection) {
+// registerConnection adds a new WebSocket connection to the handler and
+// subscribes it to the live logs of its client
+func (h *WebSocketHandler) registerConnection(conn *types.WSConnection) *hub.Subscription {
+	var sub *hub.Subscription
+	if conn.ClientID != "" {
+		sub = h.logHub.Subscribe(hub.ClientTopic(conn.ClientID))
+	} else {
+		sub = h.logHub.Subscribe()
+	}
+
 	h.mu.Lock()
 	h.connections[conn] = true
+	h.sessions[conn] = &wsSession{
+		logs:   sub,
+		topics: make(map[string]*grpc.LogSubscription),
+		expiry: h.expireConnection(conn),
+	}
 	h.mu.Unlock()
 
 	// Register with client ID
 	h.clientsMu.Lock()
 	h.clients[conn.ClientID] = append(h.clients[conn.ClientID], conn)
+	if _, ok := h.viewers[conn.ClientID]; !ok && conn.ClientID != "" {
+		// Stream the client's logs while anyone is watching
+		h.viewers[conn.ClientID] = h.grpcClient.SubscribeClient(conn.ClientID)
+	}
 	h.clientsMu.Unlock()
 
-	// Setup cleanup when connection closes
-	go func() {
-		<-h.waitForDisconnect(conn)
-		h.unregisterConnection(conn)
-	}()
+	return sub
 }
 
 // unregisterConnection removes a WebSocket connection
 func (h *WebSocketHandler) unregisterConnection(conn *types.WSConnection) {
 	h.mu.Lock()
 	delete(h.connections, conn)
+	session, ok := h.sessions[conn]
+	delete(h.sessions, conn)
 	h.mu.Unlock()
+	if !ok {
+		// Already unregistered
+		return
+	}
+	session.close()
 
 	h.clientsMu.Lock()
 	clientConns := h.clients[conn.ClientID]
@@ -192,27 +269,18 @@ func (h *WebSocketHandler) unregisterConnection(conn *types.WSConnection) {
 	// If no more connections for this client, remove the client entry
 	if len(h.clients[conn.ClientID]) == 0 {
 		delete(h.clients, conn.ClientID)
+		if viewer, ok := h.viewers[conn.ClientID]; ok {
+			viewer.Close()
+			delete(h.viewers, conn.ClientID)
+		}
 	}
 	h.clientsMu.Unlock()
 
 	conn.Conn.Close()
 }
 
-// waitForDisconnect monitors connection for closure
-func (h *WebSocketHandler) waitForDisconnect(conn *types.WSConnection) chan struct{} {
-	done := make(chan struct{})
-	go func() {
-		for {
-			if _, _, err := conn.Conn.NextReader(); err != nil {
-				close(done)
-				break
-			}
-		}
-	}()
-	return done
-}
-
-// handleMessages processes incoming WebSocket messages
+// handleMessages processes incoming WebSocket messages. It is the only
+// reader of the connection and unregisters it once reading fails.
 func (h *WebSocketHandler) handleMessages(conn *types.WSConnection) {
 	for {
 		var message types.WSMessage
@@ -228,42 +296,74 @@ func (h *WebSocketHandler) handleMessages(conn *types.WSConnection) {
 		switch message.Type {
 		case types.MessageTypeHistoryReq:
 			go h.handleHistoryRequest(conn, message)
+		case types.MessageTypeSubscribe:
+			h.handleSubscribe(conn, message)
+		case types.MessageTypeUnsubscribe:
+			h.handleUnsubscribe(conn, message)
+		case types.MessageTypeListSubscriptions:
+			h.handleListSubscriptions(conn, message)
+		default:
+			h.sendErrorMessage(conn, message.RequestID, fmt.Sprintf("unknown message type %q", message.Type))
 		}
 	}
 }
 
-// handleHistoryRequest processes requests for historical logs
+// handleHistoryRequest processes requests for historical logs, optionally for
+// a single run. Logs are returned in (timestamp, seq) order; the response
+// carries a cursor that can be sent back as after_timestamp/after_seq to
+// fetch the next page.
 func (h *WebSocketHandler) handleHistoryRequest(conn *types.WSConnection, msg types.WSMessage) {
 	var req struct {
-		FromTimestamp int64 `json:"from_timestamp"`
-		ToTimestamp   int64 `json:"to_timestamp"`
-		Limit         int   `json:"limit"`
+		RunID          string `json:"run_id"`
+		FromTimestamp  int64  `json:"from_timestamp"`
+		ToTimestamp    int64  `json:"to_timestamp"`
+		AfterTimestamp *int64 `json:"after_timestamp"`
+		AfterSeq       int64  `json:"after_seq"`
+		Limit          int    `json:"limit"`
 	}
 
-	if err := json.Unmarshal(msg.Payload.(json.RawMessage), &req); err != nil {
-		h.sendErrorMessage(conn, "Invalid history request format")
+	raw, err := json.Marshal(msg.Payload)
+	if err != nil || json.Unmarshal(raw, &req) != nil {
+		h.sendErrorMessage(conn, msg.RequestID, "Invalid history request format")
 		return
 	}
 
+	if req.ToTimestamp == 0 {
+		req.ToTimestamp = time.Now().UnixNano()
+	}
+	if req.Limit <= 0 || req.Limit > maxHistoryLimit {
+		req.Limit = maxHistoryLimit
+	}
+
+	var after *types.LogCursor
+	if req.AfterTimestamp != nil {
+		after = &types.LogCursor{Timestamp: *req.AfterTimestamp, Seq: req.AfterSeq}
+	}
+
 	// Fetch logs from database
-	logs, err := h.db.FetchLogs(context.Background(), conn.ClientID, req.FromTimestamp, req.ToTimestamp, req.Limit)
+	page, err := h.db.FetchLogs(context.Background(), conn.ClientID, req.RunID, req.FromTimestamp, req.ToTimestamp, after, req.Limit)
 	if err != nil {
-		h.sendErrorMessage(conn, "Failed to fetch history")
+		h.sendErrorMessage(conn, msg.RequestID, "Failed to fetch history")
 		return
 	}
 
-	// Send logs in batches
+	// Send logs in batches; only the last batch carries the next cursor
 	batchSize := 100
-	for i := 0; i < len(logs); i += batchSize {
+	for i := 0; i == 0 || i < len(page.Logs); i += batchSize {
 		end := i + batchSize
-		if end > len(logs) {
-			end = len(logs)
+		if end > len(page.Logs) {
+			end = len(page.Logs)
+		}
+
+		batch := types.LogPage{Logs: page.Logs[i:end]}
+		if end == len(page.Logs) {
+			batch.NextCursor = page.NextCursor
 		}
 
 		response := types.WSMessage{
 			Type:      types.MessageTypeLiveLog,
 			RequestID: msg.RequestID,
-			Payload:   logs[i:end],
+			Payload:   batch,
 		}
 
 		if err := h.sendMessage(conn, response); err != nil {
@@ -280,10 +380,12 @@ func (h *WebSocketHandler) sendMessage(conn *types.WSConnection, msg types.WSMes
 	return conn.Conn.WriteJSON(msg)
 }
 
-// sendErrorMessage sends an error message to a connection
-func (h *WebSocketHandler) sendErrorMessage(conn *types.WSConnection, errMsg string) {
+// sendErrorMessage sends an error message to a connection, answering the
+// request with the given ID
+func (h *WebSocketHandler) sendErrorMessage(conn *types.WSConnection, requestID, errMsg string) {
 	response := types.WSMessage{
-		Type: "error",
+		Type:      types.MessageTypeError,
+		RequestID: requestID,
 		Payload: map[string]string{
 			"error": errMsg,
 		},
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	"backend/internal/grpc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkerHandler exposes the ML worker pool
+type WorkerHandler struct {
+	grpcClient *grpc.Client
+}
+
+// NewWorkerHandler creates a new worker handler
+func NewWorkerHandler(grpcClient *grpc.Client) *WorkerHandler {
+	return &WorkerHandler{
+		grpcClient: grpcClient,
+	}
+}
+
+// GetWorkers returns the health and load of every ML worker. The runs of
+// other users are left out.
+func (h *WorkerHandler) GetWorkers(c *gin.Context) {
+	workers := h.grpcClient.Workers()
+
+	owned := make(map[string]bool)
+	for _, stream := range h.grpcClient.StreamHealth() {
+		if stream.ClientID == UserID(c) {
+			owned[stream.RunID] = true
+		}
+	}
+
+	healthy := 0
+	for i, w := range workers {
+		if w.Healthy {
+			healthy++
+		}
+		runs := []string{}
+		for _, runID := range w.Runs {
+			if owned[runID] {
+				runs = append(runs, runID)
+			}
+		}
+		workers[i].Runs = runs
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workers": workers,
+		"count":   len(workers),
+		"healthy": healthy,
+		"breaker": h.grpcClient.Breaker().State(),
+	})
+}
+
+// GetLogStreams returns the health of the log streams of the authenticated
+// user's recent runs
+func (h *WorkerHandler) GetLogStreams(c *gin.Context) {
+	streams := make([]grpc.RunStreamHealth, 0)
+	for _, stream := range h.grpcClient.StreamHealth() {
+		if stream.ClientID == UserID(c) {
+			streams = append(streams, stream)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"streams": streams, "count": len(streams)})
+}
+
+// GetRunLogStream returns the health of the log streams carrying a run
+func (h *WorkerHandler) GetRunLogStream(c *gin.Context) {
+	health, ok := h.grpcClient.RunStreamHealth(c.Param("runId"))
+	if !ok || health.ClientID != UserID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No logs received for run"})
+		return
+	}
+
+	c.JSON(http.StatusOK, health)
+}
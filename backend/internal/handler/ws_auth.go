@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// wsTicketTTL is how long a WebSocket ticket can be used to connect
+const wsTicketTTL = 30 * time.Second
+
+// bearerProtocol is the WebSocket subprotocol offered ahead of the token by
+// clients that pass the token as a subprotocol
+const bearerProtocol = "bearer"
+
+// ownershipCheckTimeout bounds the lookup of a run's owner
+const ownershipCheckTimeout = 5 * time.Second
+
+// errNotRunOwner is returned for runs a user may not follow. Unknown runs
+// get the same error so run IDs cannot be probed.
+var errNotRunOwner = errors.New("not allowed to follow this run")
+
+// checkOrigin returns an origin check allowing the given origins. Requests
+// without an origin do not come from a browser and are allowed.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if len(allowed) == 0 {
+			u, err := url.Parse(origin)
+			return err == nil && strings.EqualFold(u.Host, r.Host)
+		}
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// authenticate returns the claims of the token of a WebSocket upgrade. The
+// token is taken from the Authorization header, from the subprotocols
+// ("bearer" followed by the token) or from a ticket query parameter.
+func (h *WebSocketHandler) authenticate(c *gin.Context) (*auth.Claims, error) {
+	if ticket := c.Query("ticket"); ticket != "" {
+		claims, err := h.tickets.Redeem(ticket)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.jwtService.Verify(claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		protocols := websocket.Subprotocols(c.Request)
+		for i, protocol := range protocols {
+			if protocol == bearerProtocol && i+1 < len(protocols) {
+				token = protocols[i+1]
+				break
+			}
+		}
+	}
+	if token == "" {
+		return nil, errors.New("no token provided")
+	}
+	return h.jwtService.ValidateToken(token)
+}
+
+// IssueTicket gives an authenticated user a single-use ticket to open a
+// WebSocket with, for browsers that cannot send the token on the upgrade
+func (h *WebSocketHandler) IssueTicket(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*auth.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	ticket, expiresAt, err := h.tickets.Issue(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
+
+// authorizeRun checks that the user of a connection owns a run
+func (h *WebSocketHandler) authorizeRun(conn *types.WSConnection, runID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ownershipCheckTimeout)
+	defer cancel()
+
+	run, err := h.db.GetRun(ctx, runID)
+	if errors.Is(err, database.ErrRunNotFound) {
+		return errNotRunOwner
+	}
+	if err != nil {
+		return fmt.Errorf("checking run owner: %w", err)
+	}
+	if run.ClientID != conn.UserID {
+		return errNotRunOwner
+	}
+	return nil
+}
+
+// disconnect closes a connection with a close frame telling why. Reading
+// then fails and the connection is unregistered.
+func (h *WebSocketHandler) disconnect(conn *types.WSConnection, code int, reason string) {
+	conn.Mu.Lock()
+	conn.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second))
+	conn.Mu.Unlock()
+	conn.Conn.Close()
+}
+
+// handleTokenRevoked disconnects the connections opened with a revoked token
+func (h *WebSocketHandler) handleTokenRevoked(r auth.Revocation) {
+	h.mu.RLock()
+	var revoked []*types.WSConnection
+	for conn := range h.connections {
+		if (r.TokenID != "" && conn.TokenID == r.TokenID) || (r.UserID != "" && conn.UserID == r.UserID) {
+			revoked = append(revoked, conn)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range revoked {
+		log.Printf("Disconnecting WebSocket of user %s: token revoked", conn.UserID)
+		h.disconnect(conn, websocket.ClosePolicyViolation, "token revoked")
+	}
+}
+
+// expireConnection disconnects a connection when its token expires. Tokens
+// without an expiry return nil.
+func (h *WebSocketHandler) expireConnection(conn *types.WSConnection) *time.Timer {
+	if conn.ExpiresAt.IsZero() {
+		return nil
+	}
+	return time.AfterFunc(time.Until(conn.ExpiresAt), func() {
+		log.Printf("Disconnecting WebSocket of user %s: token expired", conn.UserID)
+		h.disconnect(conn, websocket.ClosePolicyViolation, "token expired")
+	})
+}
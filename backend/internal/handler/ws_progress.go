@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"backend/internal/types"
+)
+
+// progressInterval is the least time between two progress messages of a
+// run. Updates in between are held back and only the latest is sent.
+const progressInterval = 500 * time.Millisecond
+
+// progressThrottle limits the progress messages sent per run
+type progressThrottle struct {
+	mu      sync.Mutex
+	runs    map[string]*runProgress
+	publish func(status types.ModelStatus)
+}
+
+// runProgress is the throttling state of a run
+type runProgress struct {
+	lastSent time.Time
+	pending  *types.ModelStatus
+	timer    *time.Timer
+}
+
+func newProgressThrottle(publish func(status types.ModelStatus)) *progressThrottle {
+	return &progressThrottle{
+		runs:    make(map[string]*runProgress),
+		publish: publish,
+	}
+}
+
+// offer sends a progress update now if the run's interval has passed, and
+// otherwise holds it back until it has
+func (t *progressThrottle) offer(status types.ModelStatus) {
+	t.mu.Lock()
+	run, ok := t.runs[status.RunID]
+	if !ok {
+		run = &runProgress{}
+		t.runs[status.RunID] = run
+	}
+
+	wait := progressInterval - time.Since(run.lastSent)
+	if wait <= 0 && run.pending == nil {
+		run.lastSent = time.Now()
+		t.mu.Unlock()
+		t.publish(status)
+		return
+	}
+
+	run.pending = &status
+	if run.timer == nil {
+		run.timer = time.AfterFunc(max(wait, 0), func() { t.flush(status.RunID, run) })
+	}
+	t.mu.Unlock()
+}
+
+// flush sends the update held back for a run
+func (t *progressThrottle) flush(runID string, run *runProgress) {
+	t.mu.Lock()
+	if t.runs[runID] != run || run.pending == nil {
+		t.mu.Unlock()
+		return
+	}
+	status := *run.pending
+	run.pending, run.timer = nil, nil
+	run.lastSent = time.Now()
+	t.mu.Unlock()
+
+	t.publish(status)
+}
+
+// clear forgets a run, dropping any update held back
+func (t *progressThrottle) clear(runID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if run, ok := t.runs[runID]; ok {
+		if run.timer != nil {
+			run.timer.Stop()
+		}
+		delete(t.runs, runID)
+	}
+}
+
+// PublishProgress sends a run's progress as a model_progress message to the
+// connections that get its status, at most once per progress interval
+func (h *WebSocketHandler) PublishProgress(status types.ModelStatus) {
+	h.progress.offer(status)
+}
+
+// ClearProgress stops the progress messages of a run that has ended
+func (h *WebSocketHandler) ClearProgress(runID string) {
+	h.progress.clear(runID)
+}
+
+// sendProgress sends a progress message to the connections following a
+// run's status
+func (h *WebSocketHandler) sendProgress(status types.ModelStatus) {
+	connections := h.topicConnections(status.ClientID, true, topicStatusPrefix+status.RunID, TopicRunningModels)
+	h.sendToConnections(connections, types.WSMessage{
+		Type:    types.MessageTypeModelProgress,
+		Payload: status,
+	})
+}
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/internal/grpc"
+	"backend/internal/hub"
+	"backend/internal/types"
+)
+
+// Topics a connection can subscribe to on top of its client's own runs
+const (
+	topicLogsPrefix    = "logs:"   // live logs of a run
+	topicStatusPrefix  = "status:" // status updates of a run
+	TopicRunningModels = "running_models"
+	TopicQueue         = "queue"
+)
+
+// maxTopicsPerConnection caps the subscriptions of one connection
+const maxTopicsPerConnection = 100
+
+// wsSession is the subscription state of a connection. It is guarded by the
+// handler's mu.
+type wsSession struct {
+	logs *hub.Subscription
+	// Explicit topics; log topics hold the stream of their run open
+	topics map[string]*grpc.LogSubscription
+	// Disconnects the connection when its token expires
+	expiry *time.Timer
+}
+
+// subscriptionRequest is the payload of subscribe and unsubscribe messages
+type subscriptionRequest struct {
+	Topics []string `json:"topics"`
+}
+
+// validateTopic checks that a topic is one a connection can follow
+func validateTopic(topic string) error {
+	switch topic {
+	case TopicRunningModels, TopicQueue:
+		return nil
+	}
+	for _, prefix := range []string{topicLogsPrefix, topicStatusPrefix} {
+		if id, ok := strings.CutPrefix(topic, prefix); ok {
+			if id == "" {
+				return fmt.Errorf("topic %q has no run ID", topic)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown topic %q", topic)
+}
+
+// topicRunID returns the run a topic is about
+func topicRunID(topic string) (string, bool) {
+	if runID, ok := strings.CutPrefix(topic, topicLogsPrefix); ok {
+		return runID, true
+	}
+	return strings.CutPrefix(topic, topicStatusPrefix)
+}
+
+// decodeSubscriptionRequest reads and validates the topics of a message
+func decodeSubscriptionRequest(msg types.WSMessage) ([]string, error) {
+	var req subscriptionRequest
+	raw, err := json.Marshal(msg.Payload)
+	if err != nil || json.Unmarshal(raw, &req) != nil {
+		return nil, fmt.Errorf("invalid %s request format", msg.Type)
+	}
+	if len(req.Topics) == 0 {
+		return nil, fmt.Errorf("no topics given")
+	}
+	for _, topic := range req.Topics {
+		if err := validateTopic(topic); err != nil {
+			return nil, err
+		}
+	}
+	return req.Topics, nil
+}
+
+// handleSubscribe adds topics to a connection. Either every topic is added
+// or, on error, none. Runs can only be followed by the user who owns them.
+func (h *WebSocketHandler) handleSubscribe(conn *types.WSConnection, msg types.WSMessage) {
+	topics, err := decodeSubscriptionRequest(msg)
+	if err != nil {
+		h.sendErrorMessage(conn, msg.RequestID, err.Error())
+		return
+	}
+	for _, topic := range topics {
+		runID, ok := topicRunID(topic)
+		if !ok {
+			continue
+		}
+		if err := h.authorizeRun(conn, runID); err != nil {
+			h.sendErrorMessage(conn, msg.RequestID, fmt.Sprintf("%s: %v", topic, err))
+			return
+		}
+	}
+
+	h.mu.Lock()
+	session, ok := h.sessions[conn]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	added := 0
+	for _, topic := range topics {
+		if _, ok := session.topics[topic]; !ok {
+			added++
+		}
+	}
+	if len(session.topics)+added > maxTopicsPerConnection {
+		h.mu.Unlock()
+		h.sendErrorMessage(conn, msg.RequestID, fmt.Sprintf("at most %d topics per connection", maxTopicsPerConnection))
+		return
+	}
+	for _, topic := range topics {
+		if _, ok := session.topics[topic]; ok {
+			continue
+		}
+		var stream *grpc.LogSubscription
+		if runID, ok := strings.CutPrefix(topic, topicLogsPrefix); ok {
+			session.logs.Add(hub.RunTopic(runID))
+			stream = h.grpcClient.SubscribeRun(runID)
+		}
+		session.topics[topic] = stream
+	}
+	current := session.topicList()
+	h.mu.Unlock()
+
+	h.sendAck(conn, msg, current)
+}
+
+// handleUnsubscribe removes topics from a connection. Topics it does not
+// follow are ignored.
+func (h *WebSocketHandler) handleUnsubscribe(conn *types.WSConnection, msg types.WSMessage) {
+	topics, err := decodeSubscriptionRequest(msg)
+	if err != nil {
+		h.sendErrorMessage(conn, msg.RequestID, err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	session, ok := h.sessions[conn]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	for _, topic := range topics {
+		stream, ok := session.topics[topic]
+		if !ok {
+			continue
+		}
+		if runID, ok := strings.CutPrefix(topic, topicLogsPrefix); ok {
+			session.logs.Remove(hub.RunTopic(runID))
+		}
+		if stream != nil {
+			stream.Close()
+		}
+		delete(session.topics, topic)
+	}
+	current := session.topicList()
+	h.mu.Unlock()
+
+	h.sendAck(conn, msg, current)
+}
+
+// handleListSubscriptions tells a connection what it follows
+func (h *WebSocketHandler) handleListSubscriptions(conn *types.WSConnection, msg types.WSMessage) {
+	h.mu.RLock()
+	session, ok := h.sessions[conn]
+	var current []string
+	if ok {
+		current = session.topicList()
+	}
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	h.sendAck(conn, msg, current)
+}
+
+// sendAck acknowledges a control message with the topics the connection
+// follows afterwards
+func (h *WebSocketHandler) sendAck(conn *types.WSConnection, msg types.WSMessage, topics []string) {
+	err := h.sendMessage(conn, types.WSMessage{
+		Type:      types.MessageTypeAck,
+		RequestID: msg.RequestID,
+		Payload: map[string]interface{}{
+			"action":    msg.Type,
+			"client_id": conn.ClientID,
+			"topics":    topics,
+		},
+	})
+	if err != nil {
+		log.Printf("Error acknowledging %s: %v", msg.Type, err)
+	}
+}
+
+// topicList returns the explicit topics of a session in order
+func (s *wsSession) topicList() []string {
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// close releases the log subscriptions of a session
+func (s *wsSession) close() {
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	s.logs.Close()
+	for _, stream := range s.topics {
+		if stream != nil {
+			stream.Close()
+		}
+	}
+}
+
+// topicConnections returns the connections following any of the given
+// topics about a run of the owner, each once. With includeClient the
+// connections of the owner's client are included too. Only the owner's
+// connections hear about the owner's runs.
+func (h *WebSocketHandler) topicConnections(owner string, includeClient bool, topics ...string) []*types.WSConnection {
+	seen := make(map[*types.WSConnection]bool)
+	var connections []*types.WSConnection
+
+	if includeClient {
+		for _, conn := range h.GetClientConnections(owner) {
+			seen[conn] = true
+			connections = append(connections, conn)
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for conn, session := range h.sessions {
+		if seen[conn] || conn.UserID != owner {
+			continue
+		}
+		for _, topic := range topics {
+			if _, ok := session.topics[topic]; ok {
+				seen[conn] = true
+				connections = append(connections, conn)
+				break
+			}
+		}
+	}
+	return connections
+}
+
+// sendToConnections sends a message to each connection without blocking
+func (h *WebSocketHandler) sendToConnections(connections []*types.WSConnection, message types.WSMessage) {
+	for _, conn := range connections {
+		go func(c *types.WSConnection, msg types.WSMessage) {
+			if err := h.sendMessage(c, msg); err != nil {
+				log.Printf("Error sending %s to client %s: %v", msg.Type, c.ClientID, err)
+			}
+		}(conn, message)
+	}
+}
+
+// PublishStatus sends a status update to the connections of the run's
+// client and to those following the run's status or all running models
+func (h *WebSocketHandler) PublishStatus(status types.ModelStatus) {
+	connections := h.topicConnections(status.ClientID, true, topicStatusPrefix+status.RunID, TopicRunningModels)
+	h.sendToConnections(connections, types.WSMessage{
+		Type:    types.MessageTypeModelStatus,
+		Payload: status,
+	})
+}
+
+// PublishQueueUpdate tells connections following the queue that a run of
+// their user entered, moved in or left it
+func (h *WebSocketHandler) PublishQueueUpdate(status types.ModelStatus) {
+	connections := h.topicConnections(status.ClientID, false, TopicQueue)
+	h.sendToConnections(connections, types.WSMessage{
+		Type:    types.MessageTypeQueueUpdate,
+		Payload: status,
+	})
+}
+
+// PublishMetrics sends newly stored metric points of a run as a live_metric
+// message to the connections that get its live logs
+func (h *WebSocketHandler) PublishMetrics(clientID, runID string, points []types.MetricPoint) {
+	connections := h.topicConnections(clientID, true, topicLogsPrefix+runID)
+	h.sendToConnections(connections, types.WSMessage{
+		Type:    types.MessageTypeLiveMetric,
+		Payload: points,
+	})
+}
@@ -0,0 +1,303 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"backend/internal/config"
+	"backend/internal/types"
+)
+
+// SlowConsumerPolicy decides what happens when a subscriber's queue is full
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest drops the oldest queued log to make room and counts
+	// it as skipped
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyDisconnect closes the subscription with ErrSlowConsumer
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyCoalesce replaces the queued logs by a count of skipped logs
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+)
+
+// defaultQueueSize is the number of logs queued per subscriber when the
+// config leaves it unset
+const defaultQueueSize = 1000
+
+// ErrSlowConsumer closes a subscription that fell behind under the
+// disconnect policy
+var ErrSlowConsumer = errors.New("subscriber fell behind")
+
+// HubStats reports the fan-out of logs to subscribers
+type HubStats struct {
+	Subscribers  int    `json:"subscribers"`
+	QueueSize    int    `json:"queue_size"`
+	Policy       string `json:"policy"`
+	Published    int64  `json:"published"`
+	Delivered    int64  `json:"delivered"`
+	Dropped      int64  `json:"dropped"`
+	Coalesced    int64  `json:"coalesced"`
+	Disconnected int64  `json:"disconnected"`
+}
+
+// ClientTopic is the topic of the logs of every run of a client
+func ClientTopic(clientID string) string {
+	return "client:" + clientID
+}
+
+// RunTopic is the topic of the logs of a single run
+func RunTopic(runID string) string {
+	return "run:" + runID
+}
+
+// Hub fans logs out to subscribers. Every log is published once and each
+// subscriber of its client or run gets its own copy through a bounded
+// queue, so a slow subscriber never holds up the publisher or other
+// subscribers.
+type Hub struct {
+	queueSize int
+	policy    SlowConsumerPolicy
+
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{} // by topic
+
+	published    atomic.Int64
+	delivered    atomic.Int64
+	dropped      atomic.Int64
+	coalesced    atomic.Int64
+	disconnected atomic.Int64
+}
+
+// NewHub creates a hub from the log streaming config
+func NewHub(cfg config.LogStreamingConfig) (*Hub, error) {
+	queueSize := cfg.WSQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	policy := SlowConsumerPolicy(cfg.SlowConsumerPolicy)
+	switch policy {
+	case "":
+		policy = PolicyDropOldest
+	case PolicyDropOldest, PolicyDisconnect, PolicyCoalesce:
+	default:
+		return nil, fmt.Errorf("unknown slow consumer policy %q", cfg.SlowConsumerPolicy)
+	}
+
+	return &Hub{
+		queueSize: queueSize,
+		policy:    policy,
+		subs:      make(map[string]map[*Subscription]struct{}),
+	}, nil
+}
+
+// Subscribe starts queueing the logs of the given topics for a new
+// subscriber
+func (h *Hub) Subscribe(topics ...string) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		topics: make(map[string]struct{}),
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	for _, topic := range topics {
+		s.Add(topic)
+	}
+	return s
+}
+
+// Publish queues a log once for every subscriber of its client or run. It
+// never blocks.
+func (h *Hub) Publish(record types.LogRecord) {
+	h.published.Add(1)
+
+	h.mu.RLock()
+	subs := make(map[*Subscription]struct{}, len(h.subs[ClientTopic(record.ClientID)]))
+	for s := range h.subs[ClientTopic(record.ClientID)] {
+		subs[s] = struct{}{}
+	}
+	if record.RunID != "" {
+		for s := range h.subs[RunTopic(record.RunID)] {
+			subs[s] = struct{}{}
+		}
+	}
+	h.mu.RUnlock()
+
+	for s := range subs {
+		s.offer(record)
+	}
+}
+
+// Stats returns the fan-out counters
+func (h *Hub) Stats() HubStats {
+	h.mu.RLock()
+	subscribers := make(map[*Subscription]struct{})
+	for _, subs := range h.subs {
+		for s := range subs {
+			subscribers[s] = struct{}{}
+		}
+	}
+	h.mu.RUnlock()
+
+	return HubStats{
+		Subscribers:  len(subscribers),
+		QueueSize:    h.queueSize,
+		Policy:       string(h.policy),
+		Published:    h.published.Load(),
+		Delivered:    h.delivered.Load(),
+		Dropped:      h.dropped.Load(),
+		Coalesced:    h.coalesced.Load(),
+		Disconnected: h.disconnected.Load(),
+	}
+}
+
+// remove drops a subscriber from a topic. The caller holds mu.
+func (h *Hub) remove(s *Subscription, topic string) {
+	delete(h.subs[topic], s)
+	if len(h.subs[topic]) == 0 {
+		delete(h.subs, topic)
+	}
+}
+
+// Subscription is a subscriber's queue of logs
+type Subscription struct {
+	hub    *Hub
+	topics map[string]struct{} // guarded by hub.mu
+
+	mu sync.Mutex
+	// queue[head:] are the queued logs. Dropping the oldest log advances
+	// head, and the space before it is reclaimed once it is half the queue.
+	queue   []types.LogRecord
+	head    int
+	skipped int
+	closed  bool
+	err     error
+
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// Add subscribes to the logs of another topic
+func (s *Subscription) Add(topic string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	if s.hub.subs[topic] == nil {
+		s.hub.subs[topic] = make(map[*Subscription]struct{})
+	}
+	s.hub.subs[topic][s] = struct{}{}
+	s.topics[topic] = struct{}{}
+}
+
+// Remove stops queueing the logs of a topic
+func (s *Subscription) Remove(topic string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s, topic)
+	delete(s.topics, topic)
+}
+
+// Ready is signalled when logs are waiting to be taken
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed when the subscription is closed
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the hub closed the subscription, or nil
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Take returns the queued logs in publish order and the number of logs
+// skipped before them by the drop_oldest and coalesce policies
+func (s *Subscription) Take() ([]types.LogRecord, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logs, skipped := s.queue[s.head:], s.skipped
+	s.queue, s.head, s.skipped = nil, 0, 0
+	s.hub.delivered.Add(int64(len(logs)))
+	return logs, skipped
+}
+
+// Close stops queueing logs for the subscriber
+func (s *Subscription) Close() {
+	s.close(nil)
+}
+
+func (s *Subscription) close(err error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.err = err
+	s.queue, s.head = nil, 0
+	s.mu.Unlock()
+
+	s.hub.mu.Lock()
+	for topic := range s.topics {
+		s.hub.remove(s, topic)
+	}
+	s.topics = nil
+	close(s.done)
+	s.hub.mu.Unlock()
+}
+
+// offer queues a log, applying the slow consumer policy when the queue is
+// full
+func (s *Subscription) offer(record types.LogRecord) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	if queued := len(s.queue) - s.head; queued >= s.hub.queueSize {
+		switch s.hub.policy {
+		case PolicyDisconnect:
+			s.mu.Unlock()
+			s.hub.disconnected.Add(1)
+			s.close(ErrSlowConsumer)
+			return
+		case PolicyCoalesce:
+			s.skipped += queued
+			s.hub.coalesced.Add(int64(queued))
+			s.queue, s.head = s.queue[:0], 0
+		default:
+			s.queue[s.head] = types.LogRecord{}
+			s.head++
+			s.skipped++
+			s.hub.dropped.Add(1)
+		}
+	}
+	if s.head > 0 && s.head >= len(s.queue)/2 {
+		n := copy(s.queue, s.queue[s.head:])
+		clear(s.queue[n:])
+		s.queue, s.head = s.queue[:n], 0
+	}
+	s.queue = append(s.queue, record)
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,192 @@
+package hub
+
+import (
+	"errors"
+	"testing"
+
+	"backend/internal/config"
+	"backend/internal/types"
+)
+
+func newTestHub(t *testing.T, queueSize int, policy SlowConsumerPolicy) *Hub {
+	t.Helper()
+	h, err := NewHub(config.LogStreamingConfig{WSQueueSize: queueSize, SlowConsumerPolicy: string(policy)})
+	if err != nil {
+		t.Fatalf("NewHub() = %v", err)
+	}
+	return h
+}
+
+func publish(h *Hub, clientID, runID string, from, to int64) {
+	for seq := from; seq <= to; seq++ {
+		h.Publish(types.LogRecord{ClientID: clientID, RunID: runID, Seq: seq})
+	}
+}
+
+func seqs(logs []types.LogRecord) []int64 {
+	out := make([]int64, len(logs))
+	for i, l := range logs {
+		out[i] = l.Seq
+	}
+	return out
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewHubPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    SlowConsumerPolicy
+		wantErr bool
+	}{
+		{policy: "", want: PolicyDropOldest},
+		{policy: "drop_oldest", want: PolicyDropOldest},
+		{policy: "disconnect", want: PolicyDisconnect},
+		{policy: "coalesce", want: PolicyCoalesce},
+		{policy: "block", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		h, err := NewHub(config.LogStreamingConfig{SlowConsumerPolicy: tt.policy})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewHub(%q) succeeded, want an error", tt.policy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("NewHub(%q) = %v", tt.policy, err)
+		}
+		if h.policy != tt.want || h.queueSize != defaultQueueSize {
+			t.Errorf("NewHub(%q) = policy %s, queue %d; want %s, %d", tt.policy, h.policy, h.queueSize, tt.want, defaultQueueSize)
+		}
+	}
+}
+
+func TestSlowConsumerPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      SlowConsumerPolicy
+		published   int64
+		wantSeqs    []int64
+		wantSkipped int
+		wantErr     error
+	}{
+		{
+			name:      "queue not full",
+			policy:    PolicyDropOldest,
+			published: 3,
+			wantSeqs:  []int64{1, 2, 3},
+		},
+		{
+			name:        "drop_oldest keeps the newest and counts drops",
+			policy:      PolicyDropOldest,
+			published:   10,
+			wantSeqs:    []int64{7, 8, 9, 10},
+			wantSkipped: 6,
+		},
+		{
+			name:        "drop_oldest over many compactions",
+			policy:      PolicyDropOldest,
+			published:   1003,
+			wantSeqs:    []int64{1000, 1001, 1002, 1003},
+			wantSkipped: 999,
+		},
+		{
+			name:        "coalesce replaces the queue by a count",
+			policy:      PolicyCoalesce,
+			published:   10,
+			wantSeqs:    []int64{9, 10},
+			wantSkipped: 8,
+		},
+		{
+			name:      "disconnect closes the subscription",
+			policy:    PolicyDisconnect,
+			published: 5,
+			wantErr:   ErrSlowConsumer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(t, 4, tt.policy)
+			sub := h.Subscribe(ClientTopic("c1"))
+			publish(h, "c1", "", 1, tt.published)
+
+			logs, skipped := sub.Take()
+			if !equalSeqs(seqs(logs), tt.wantSeqs) {
+				t.Errorf("Take() logs = %v, want %v", seqs(logs), tt.wantSeqs)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("Take() skipped = %d, want %d", skipped, tt.wantSkipped)
+			}
+			if err := sub.Err(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Err() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTakeResetsQueue(t *testing.T) {
+	h := newTestHub(t, 4, PolicyDropOldest)
+	sub := h.Subscribe(ClientTopic("c1"))
+
+	publish(h, "c1", "", 1, 6)
+	sub.Take()
+	publish(h, "c1", "", 7, 8)
+
+	logs, skipped := sub.Take()
+	if !equalSeqs(seqs(logs), []int64{7, 8}) || skipped != 0 {
+		t.Errorf("Take() = %v, %d; want [7 8], 0", seqs(logs), skipped)
+	}
+	if stats := h.Stats(); stats.Dropped != 2 || stats.Delivered != 6 || stats.Published != 8 {
+		t.Errorf("Stats() = %+v, want 2 dropped, 6 delivered, 8 published", stats)
+	}
+}
+
+func TestPublishTopics(t *testing.T) {
+	h := newTestHub(t, 10, PolicyDropOldest)
+	client := h.Subscribe(ClientTopic("c1"))
+	run := h.Subscribe(RunTopic("r1"))
+	both := h.Subscribe(ClientTopic("c1"), RunTopic("r1"))
+	other := h.Subscribe(ClientTopic("c2"))
+
+	publish(h, "c1", "r1", 1, 1)
+	publish(h, "c1", "r2", 2, 2)
+
+	tests := []struct {
+		name string
+		sub  *Subscription
+		want []int64
+	}{
+		{name: "client", sub: client, want: []int64{1, 2}},
+		{name: "run", sub: run, want: []int64{1}},
+		{name: "client and run get one copy", sub: both, want: []int64{1, 2}},
+		{name: "other client", sub: other, want: []int64{}},
+	}
+	for _, tt := range tests {
+		logs, _ := tt.sub.Take()
+		if !equalSeqs(seqs(logs), tt.want) {
+			t.Errorf("%s: Take() = %v, want %v", tt.name, seqs(logs), tt.want)
+		}
+	}
+
+	run.Remove(RunTopic("r1"))
+	client.Close()
+	publish(h, "c1", "r1", 3, 3)
+	for _, sub := range []*Subscription{client, run} {
+		if logs, _ := sub.Take(); len(logs) != 0 {
+			t.Errorf("Take() after unsubscribing = %v, want none", seqs(logs))
+		}
+	}
+}
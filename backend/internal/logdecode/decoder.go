@@ -0,0 +1,197 @@
+package logdecode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// UUIDLength is the size of the binary client UUID that prefixes every frame
+const UUIDLength = 16
+
+// maxDecodedSize caps the decompressed size of a single log frame
+const maxDecodedSize = 16 << 20
+
+var (
+	// ErrFrameTooShort is returned when a frame cannot hold a UUID and a payload
+	ErrFrameTooShort = errors.New("log frame too short")
+	// ErrClientMismatch is returned when the embedded UUID differs from the record's client ID
+	ErrClientMismatch = errors.New("log frame client id mismatch")
+)
+
+// Keys produced by the Python log sinks that map onto DecodedLog fields.
+// Anything else ends up in DecodedLog.Extra.
+var knownKeys = map[string]bool{
+	"msg":        true,
+	"message":    true,
+	"time":       true,
+	"levelname":  true,
+	"level":      true,
+	"name":       true,
+	"logger":     true,
+	"module":     true,
+	"funcName":   true,
+	"pathname":   true,
+	"line":       true,
+	"lineno":     true,
+	"thread":     true,
+	"threadName": true,
+	"process":    true,
+}
+
+// Decoder turns raw [16-byte UUID][zstd(msgpack)] frames into structured logs
+type Decoder struct {
+	zr *zstd.Decoder
+}
+
+// NewDecoder creates a new log frame decoder. A single Decoder is safe for
+// concurrent use.
+func NewDecoder() (*Decoder, error) {
+	zr, err := zstd.NewReader(nil,
+		zstd.WithDecoderConcurrency(0),
+		zstd.WithDecoderMaxMemory(maxDecodedSize),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating zstd decoder: %w", err)
+	}
+	return &Decoder{zr: zr}, nil
+}
+
+// Decode decompresses and unpacks a frame. If clientID is not empty the
+// UUID embedded in the frame must match it.
+func (d *Decoder) Decode(clientID string, frame []byte) (*types.DecodedLog, error) {
+	if len(frame) <= UUIDLength {
+		return nil, ErrFrameTooShort
+	}
+
+	embedded, err := uuid.FromBytes(frame[:UUIDLength])
+	if err != nil {
+		return nil, fmt.Errorf("parsing embedded client id: %w", err)
+	}
+
+	if clientID != "" {
+		expected, err := uuid.Parse(clientID)
+		if err != nil || expected != embedded {
+			return nil, fmt.Errorf("%w: frame has %s, record has %s", ErrClientMismatch, embedded, clientID)
+		}
+	}
+
+	packed, err := d.zr.DecodeAll(frame[UUIDLength:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing log frame: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := msgpack.Unmarshal(packed, &fields); err != nil {
+		return nil, fmt.Errorf("unpacking log frame: %w", err)
+	}
+
+	return fromFields(fields), nil
+}
+
+// DecodeRecord decodes the message of a record in place
+func (d *Decoder) DecodeRecord(record *types.LogRecord) error {
+	decoded, err := d.Decode(record.ClientID, record.Message)
+	if err != nil {
+		return err
+	}
+	record.Decoded = decoded
+	return nil
+}
+
+// Close releases the resources held by the decoder
+func (d *Decoder) Close() {
+	d.zr.Close()
+}
+
+// fromFields maps the unpacked msgpack fields onto a DecodedLog
+func fromFields(fields map[string]interface{}) *types.DecodedLog {
+	decoded := &types.DecodedLog{
+		Msg:      firstString(fields, "msg", "message"),
+		Level:    strings.ToUpper(firstString(fields, "levelname", "level")),
+		Logger:   firstString(fields, "logger", "name"),
+		Module:   firstString(fields, "module"),
+		FuncName: firstString(fields, "funcName"),
+		Pathname: firstString(fields, "pathname"),
+		Thread:   firstString(fields, "threadName", "thread"),
+		Line:     firstInt(fields, "line", "lineno"),
+		Process:  firstInt(fields, "process"),
+	}
+
+	if ts := firstString(fields, "time"); ts != "" {
+		decoded.Time = parseTime(ts)
+	}
+
+	for key, value := range fields {
+		if knownKeys[key] {
+			continue
+		}
+		if decoded.Extra == nil {
+			decoded.Extra = make(map[string]interface{})
+		}
+		decoded.Extra[key] = value
+	}
+
+	return decoded
+}
+
+// parseTime parses the ISO-8601 timestamps emitted by Python's isoformat()
+func parseTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstString(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case string:
+			return v
+		case []byte:
+			return string(v)
+		case nil:
+			continue
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+func firstInt(fields map[string]interface{}, keys ...string) int {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case int8:
+			return int(v)
+		case int16:
+			return int(v)
+		case int32:
+			return int(v)
+		case int64:
+			return int(v)
+		case uint8:
+			return int(v)
+		case uint16:
+			return int(v)
+		case uint32:
+			return int(v)
+		case uint64:
+			return int(v)
+		case int:
+			return v
+		case float64:
+			return int(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+package logdecode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// frame builds a [UUID][zstd(msgpack)] frame like the Python log sinks
+func frame(t *testing.T, clientID uuid.UUID, fields map[string]interface{}) []byte {
+	t.Helper()
+	packed, err := msgpack.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zw.Close()
+	return append(clientID[:], zw.EncodeAll(packed, nil)...)
+}
+
+func TestDecode(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	client := uuid.New()
+	valid := frame(t, client, map[string]interface{}{
+		"msg":        "epoch done",
+		"levelname":  "info",
+		"name":       "trainer",
+		"funcName":   "fit",
+		"lineno":     42,
+		"threadName": "MainThread",
+		"time":       "2024-05-01T12:30:00.123456",
+		"epoch":      3,
+	})
+
+	tests := []struct {
+		name     string
+		clientID string
+		frame    []byte
+		wantErr  error
+		wantAny  bool
+	}{
+		{name: "matching client", clientID: client.String(), frame: valid},
+		{name: "no client to check", clientID: "", frame: valid},
+		{name: "other client", clientID: uuid.NewString(), frame: valid, wantErr: ErrClientMismatch},
+		{name: "client id not a uuid", clientID: "guest-1", frame: valid, wantErr: ErrClientMismatch},
+		{name: "only a uuid", clientID: client.String(), frame: client[:], wantErr: ErrFrameTooShort},
+		{name: "empty frame", clientID: "", frame: nil, wantErr: ErrFrameTooShort},
+		{name: "payload not zstd", clientID: client.String(), frame: append(client[:], "plain text"...), wantAny: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := d.Decode(tt.clientID, tt.frame)
+			switch {
+			case tt.wantAny:
+				if err == nil {
+					t.Fatal("Decode() succeeded, want an error")
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decode() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Decode() = %v", err)
+			}
+
+			want := types.DecodedLog{
+				Msg:      "epoch done",
+				Level:    "INFO",
+				Logger:   "trainer",
+				FuncName: "fit",
+				Line:     42,
+				Thread:   "MainThread",
+				Time:     time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC),
+			}
+			if decoded.Msg != want.Msg || decoded.Level != want.Level || decoded.Logger != want.Logger ||
+				decoded.FuncName != want.FuncName || decoded.Line != want.Line || decoded.Thread != want.Thread ||
+				!decoded.Time.Equal(want.Time) {
+				t.Errorf("Decode() = %+v, want %+v", *decoded, want)
+			}
+			if len(decoded.Extra) != 1 || decoded.Extra["epoch"] == nil {
+				t.Errorf("Extra = %v, want only epoch", decoded.Extra)
+			}
+		})
+	}
+}
+
+func TestDecodeRecord(t *testing.T) {
+	d, err := NewDecoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	client := uuid.New()
+	record := types.LogRecord{ClientID: client.String(), Message: frame(t, client, map[string]interface{}{"message": "hello"})}
+	if err := d.DecodeRecord(&record); err != nil {
+		t.Fatalf("DecodeRecord() = %v", err)
+	}
+	if record.Decoded == nil || record.Decoded.Msg != "hello" {
+		t.Errorf("Decoded = %+v, want message hello", record.Decoded)
+	}
+
+	mismatched := types.LogRecord{ClientID: uuid.NewString(), Message: record.Message}
+	if err := d.DecodeRecord(&mismatched); !errors.Is(err, ErrClientMismatch) || mismatched.Decoded != nil {
+		t.Errorf("DecodeRecord() = %v with %+v, want %v and nothing decoded", err, mismatched.Decoded, ErrClientMismatch)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "2024-05-01T12:30:00Z", want: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{value: "2024-05-01T12:30:00.5+00:00", want: time.Date(2024, 5, 1, 12, 30, 0, 500000000, time.UTC)},
+		{value: "2024-05-01T12:30:00.000001", want: time.Date(2024, 5, 1, 12, 30, 0, 1000, time.UTC)},
+		{value: "yesterday", want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseTime(tt.value); !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backend/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// Message is an email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails. Implementations for a mail provider can be plugged in
+// next to the local ones here.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the mailer selected by the mail config: "log" writes emails
+// to the server log and "file" writes one file per email to a directory
+func New(cfg config.MailConfig) (Mailer, error) {
+	from := cfg.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch cfg.Driver {
+	case "", "log":
+		return &LogMailer{from: from}, nil
+	case "file":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating mail directory: %w", err)
+		}
+		return &FileMailer{from: from, dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// LogMailer writes emails to the server log, for local development
+type LogMailer struct {
+	from string
+}
+
+// Send logs an email
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes each email to a file in a directory, for local
+// development and tests
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+// Send writes an email as an .eml file
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405Z"), uuid.New().String())
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("writing mail: %w", err)
+	}
+	return nil
+}
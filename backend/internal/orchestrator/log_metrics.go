@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"backend/internal/event"
+	"backend/internal/types"
+)
+
+// Extra fields of the metric records BaseProcess.log_metrics writes: one
+// metric.<name> field per metric and the step they were measured at
+const (
+	metricFieldPrefix = "metric."
+	metricStepField   = "metric_step"
+)
+
+// parseMetrics returns the step and metrics of a metric record, if it is one
+func parseMetrics(record types.LogRecord) (int64, map[string]float64, bool) {
+	if record.Decoded == nil {
+		return 0, nil, false
+	}
+
+	var metrics map[string]float64
+	for key, value := range record.Decoded.Extra {
+		name, ok := strings.CutPrefix(key, metricFieldPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		v, ok := metricValue(value)
+		if !ok {
+			continue
+		}
+		if metrics == nil {
+			metrics = make(map[string]float64)
+		}
+		metrics[name] = v
+	}
+	if len(metrics) == 0 {
+		return 0, nil, false
+	}
+
+	step, _ := metricValue(record.Decoded.Extra[metricStepField])
+	return int64(step), metrics, true
+}
+
+// metricValue converts a numeric field unpacked from msgpack to a float.
+// NaN and infinities cannot be stored and are dropped.
+func metricValue(value interface{}) (float64, bool) {
+	var v float64
+	switch n := value.(type) {
+	case float64:
+		v = n
+	case float32:
+		v = float64(n)
+	case int:
+		v = float64(n)
+	case int8:
+		v = float64(n)
+	case int16:
+		v = float64(n)
+	case int32:
+		v = float64(n)
+	case int64:
+		v = float64(n)
+	case uint8:
+		v = float64(n)
+	case uint16:
+		v = float64(n)
+	case uint32:
+		v = float64(n)
+	case uint64:
+		v = float64(n)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// ProcessLogToMetrics publishes the metrics of a metric record. Replayed
+// records get the event ID of their first publication, and their points
+// are only stored once.
+func (o *MLOrchestrator) ProcessLogToMetrics(ctx context.Context, record types.LogRecord) error {
+	step, metrics, ok := parseMetrics(record)
+	if !ok || record.RunID == "" {
+		return nil
+	}
+
+	timestamp := time.Now()
+	if !record.Decoded.Time.IsZero() {
+		timestamp = record.Decoded.Time
+	}
+
+	return o.producer.PublishMetrics(ctx, event.MetricsEvent{
+		BaseEvent: event.BaseEvent{
+			ID:        statusEventID(record.RunID, "metrics", record),
+			Type:      event.EventTypeModelMetrics,
+			Timestamp: timestamp,
+			ClientID:  record.ClientID,
+			RunID:     record.RunID,
+		},
+		Step:    step,
+		Metrics: metrics,
+	})
+}
@@ -0,0 +1,94 @@
+package orchestrator
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"backend/internal/types"
+)
+
+func TestParseMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       map[string]interface{}
+		noDecoded   bool
+		wantStep    int64
+		wantMetrics map[string]float64
+		wantOK      bool
+	}{
+		{
+			name: "metrics at a step",
+			extra: map[string]interface{}{
+				"metric.loss":     0.25,
+				"metric.accuracy": float32(0.5),
+				"metric_step":     int64(12),
+			},
+			wantStep:    12,
+			wantMetrics: map[string]float64{"loss": 0.25, "accuracy": 0.5},
+			wantOK:      true,
+		},
+		{
+			name:        "integer metric and unsigned step",
+			extra:       map[string]interface{}{"metric.samples": int8(64), "metric_step": uint16(3)},
+			wantStep:    3,
+			wantMetrics: map[string]float64{"samples": 64},
+			wantOK:      true,
+		},
+		{
+			name:        "without a step",
+			extra:       map[string]interface{}{"metric.mape": 4.5},
+			wantMetrics: map[string]float64{"mape": 4.5},
+			wantOK:      true,
+		},
+		{
+			name:        "step that is not a number",
+			extra:       map[string]interface{}{"metric.loss": 1.0, "metric_step": "7"},
+			wantMetrics: map[string]float64{"loss": 1},
+			wantOK:      true,
+		},
+		{
+			name: "unusable values dropped",
+			extra: map[string]interface{}{
+				"metric.loss":     math.NaN(),
+				"metric.accuracy": math.Inf(1),
+				"metric.label":    "best",
+				"metric.mape":     2.0,
+			},
+			wantMetrics: map[string]float64{"mape": 2},
+			wantOK:      true,
+		},
+		{
+			name:  "only unusable values",
+			extra: map[string]interface{}{"metric.loss": math.NaN(), "metric.": 1.0},
+		},
+		{
+			name:  "other fields",
+			extra: map[string]interface{}{"loss": 0.25, "metric_step": 1},
+		},
+		{
+			name:      "undecoded log",
+			noDecoded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := types.LogRecord{RunID: "r1"}
+			if !tt.noDecoded {
+				record.Decoded = &types.DecodedLog{Msg: "metrics", Extra: tt.extra}
+			}
+
+			step, metrics, ok := parseMetrics(record)
+			if ok != tt.wantOK {
+				t.Fatalf("parseMetrics() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if step != tt.wantStep {
+				t.Errorf("parseMetrics() step = %d, want %d", step, tt.wantStep)
+			}
+			if !reflect.DeepEqual(metrics, tt.wantMetrics) {
+				t.Errorf("parseMetrics() metrics = %v, want %v", metrics, tt.wantMetrics)
+			}
+		})
+	}
+}
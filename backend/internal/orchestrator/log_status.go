@@ -0,0 +1,314 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/internal/database"
+	"backend/internal/event"
+	"backend/internal/types"
+
+	"github.com/google/uuid"
+)
+
+// statusLogQueueSize is the number of status lines waiting to be published
+const statusLogQueueSize = 256
+
+// statusEventNamespace derives the IDs of events published for status lines,
+// so a replayed line gets the ID of its first publication
+var statusEventNamespace = uuid.MustParse("4b1d3c8e-6f0a-4d62-9a57-2f4c8e1b7a90")
+
+// statusLine is the payload BaseProcess.log_status and log_progress write
+// as a JSON log message. Progress lines carry the progress fields; a
+// percent given as "progress" comes from older processes. Completed
+// training lines may name the artifact the model was saved to.
+type statusLine struct {
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	ProcessType string `json:"process_type"`
+	ClientID    string `json:"client_id"`
+	RunID       string `json:"run_id"`
+	Artifact    string `json:"artifact"`
+
+	Phase       string   `json:"phase"`
+	Epoch       int      `json:"epoch"`
+	TotalEpochs int      `json:"total_epochs"`
+	Step        int      `json:"step"`
+	TotalSteps  int      `json:"total_steps"`
+	Percent     *float64 `json:"percent"`
+	Progress    *float64 `json:"progress"`
+}
+
+// logPosition is the place of a log in its run's stream
+type logPosition struct {
+	timestamp int64
+	seq       int64
+}
+
+// after reports whether p comes after q
+func (p logPosition) after(q logPosition) bool {
+	if p.timestamp != q.timestamp {
+		return p.timestamp > q.timestamp
+	}
+	return p.seq > q.seq
+}
+
+// runLogStatus is what has been published for a run's status lines, and
+// the first progress seen since progress last went backwards, from which
+// the rate is measured
+type runLogStatus struct {
+	last  logPosition
+	ended bool
+
+	progressStart time.Time
+	startPercent  float64
+	lastPercent   float64
+}
+
+// parseStatusLine returns the status payload of a log, if it has one
+func parseStatusLine(record types.LogRecord) (*statusLine, bool) {
+	if record.Decoded == nil {
+		return nil, false
+	}
+	msg := strings.TrimSpace(record.Decoded.Msg)
+	if !strings.HasPrefix(msg, "{") || !strings.Contains(msg, `"status"`) {
+		return nil, false
+	}
+
+	var line statusLine
+	if err := json.Unmarshal([]byte(msg), &line); err != nil || line.Status == "" {
+		return nil, false
+	}
+	return &line, true
+}
+
+// HandleLog notes that a run is alive for the watchdog and queues the
+// status lines and metric records among streamed logs for publishing. It
+// only blocks while the queue is full, which keeps status lines in order and
+// never loses a run's final status, unless the log's stream closes.
+func (o *MLOrchestrator) HandleLog(ctx context.Context, record types.LogRecord) {
+	o.noteActivity(record.RunID)
+
+	_, isStatus := parseStatusLine(record)
+	_, _, isMetrics := parseMetrics(record)
+	if !isStatus && !isMetrics {
+		return
+	}
+
+	select {
+	case o.statusLogs <- record:
+	case <-ctx.Done():
+	case <-o.stopChan:
+	}
+}
+
+// statusLoop publishes queued status lines and metrics until the
+// orchestrator stops
+func (o *MLOrchestrator) statusLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.stopChan:
+			return
+		case record := <-o.statusLogs:
+			if err := o.ProcessLogToStatus(ctx, record); err != nil {
+				log.Printf("Error publishing status of run %s: %v", record.RunID, err)
+			}
+			if err := o.ProcessLogToMetrics(ctx, record); err != nil {
+				log.Printf("Error publishing metrics of run %s: %v", record.RunID, err)
+			}
+		}
+	}
+}
+
+// ProcessLogToStatus publishes the lifecycle event of a status line written
+// by the ML service: started, progress, completed or failed. Replayed lines
+// are skipped and get the event ID of their first publication, so they do
+// not produce duplicate transitions.
+func (o *MLOrchestrator) ProcessLogToStatus(ctx context.Context, record types.LogRecord) error {
+	line, ok := parseStatusLine(record)
+	if !ok {
+		return nil
+	}
+
+	runID, clientID := record.RunID, record.ClientID
+	if runID == "" {
+		runID = line.RunID
+	}
+	if clientID == "" {
+		clientID = line.ClientID
+	}
+	if runID == "" {
+		return nil
+	}
+
+	var eventType event.EventType
+	var status, exitReason string
+	switch strings.ToLower(line.Status) {
+	case "started", "running":
+		eventType, status = event.EventTypeModelStarted, types.StatusRunning
+	case "progress":
+		eventType, status = event.EventTypeModelProgress, types.StatusRunning
+	case "completed", "success":
+		eventType, status = event.EventTypeModelCompleted, types.StatusCompleted
+	case "error", "failed":
+		eventType, status, exitReason = event.EventTypeModelFailed, types.StatusError, "process_error"
+	default:
+		return nil
+	}
+
+	if !o.claimStatusLine(runID, record, types.IsTerminalStatus(status)) {
+		return nil
+	}
+
+	timestamp := time.Now()
+	if !record.Decoded.Time.IsZero() {
+		timestamp = record.Decoded.Time
+	}
+
+	var progress *types.Progress
+	if eventType == event.EventTypeModelProgress {
+		progress = o.trackProgress(runID, line, timestamp)
+	}
+
+	if eventType == event.EventTypeModelStarted {
+		announced, err := o.runStarted(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if announced {
+			// The dispatcher already published the start with the process ID
+			return nil
+		}
+	}
+
+	e := event.ModelStatusEvent{
+		BaseEvent: event.BaseEvent{
+			ID:        statusEventID(runID, line.Status, record),
+			Type:      eventType,
+			Timestamp: timestamp,
+			ClientID:  clientID,
+			RunID:     runID,
+		},
+		Status:         status,
+		Message:        line.Message,
+		ProcessType:    line.ProcessType,
+		ProgressDetail: progress,
+		ExitReason:     exitReason,
+		Artifact:       line.Artifact,
+	}
+	if progress != nil {
+		e.Progress = int(progress.Percent)
+	}
+	return o.producer.PublishStatusEvent(ctx, e)
+}
+
+// trackProgress returns the structured progress of a progress line. The
+// percent is taken from the line or worked out from its epochs and steps,
+// and the ETA from the rate since the run's first progress line.
+func (o *MLOrchestrator) trackProgress(runID string, line *statusLine, at time.Time) *types.Progress {
+	progress := &types.Progress{
+		Phase:       line.Phase,
+		Epoch:       line.Epoch,
+		TotalEpochs: line.TotalEpochs,
+		Step:        line.Step,
+		TotalSteps:  line.TotalSteps,
+		Percent:     progressPercent(line),
+		UpdatedAt:   at,
+	}
+
+	o.statusMu.Lock()
+	defer o.statusMu.Unlock()
+
+	state, ok := o.runStatus[runID]
+	if !ok {
+		return progress
+	}
+	if state.progressStart.IsZero() || progress.Percent < state.lastPercent {
+		// First progress, or a restart such as a new phase
+		state.progressStart, state.startPercent = at, progress.Percent
+	}
+	state.lastPercent = progress.Percent
+
+	elapsed := at.Sub(state.progressStart).Seconds()
+	if elapsed > 0 && progress.Percent > state.startPercent {
+		progress.Rate = (progress.Percent - state.startPercent) / elapsed
+		eta := (100 - progress.Percent) / progress.Rate
+		progress.ETASeconds = &eta
+	}
+	return progress
+}
+
+// progressPercent returns the percent done of a progress line, between 0
+// and 100. Epochs count from 1 and steps within the current epoch.
+func progressPercent(line *statusLine) float64 {
+	var percent float64
+	switch {
+	case line.Percent != nil:
+		percent = *line.Percent
+	case line.Progress != nil:
+		percent = *line.Progress
+	case line.TotalEpochs > 0 && line.TotalSteps > 0:
+		done := float64(max(line.Epoch-1, 0)) + float64(line.Step)/float64(line.TotalSteps)
+		percent = done / float64(line.TotalEpochs) * 100
+	case line.TotalSteps > 0:
+		percent = float64(line.Step) / float64(line.TotalSteps) * 100
+	case line.TotalEpochs > 0:
+		percent = float64(line.Epoch) / float64(line.TotalEpochs) * 100
+	}
+	return min(max(percent, 0), 100)
+}
+
+// claimStatusLine reports whether a status line of a run is new: it comes
+// after the last one handled and the run has not ended
+func (o *MLOrchestrator) claimStatusLine(runID string, record types.LogRecord, terminal bool) bool {
+	o.statusMu.Lock()
+	defer o.statusMu.Unlock()
+
+	pos := logPosition{timestamp: record.Timestamp, seq: record.Seq}
+	state, ok := o.runStatus[runID]
+	if ok && (state.ended || !pos.after(state.last)) {
+		return false
+	}
+	if !ok {
+		state = &runLogStatus{}
+		o.runStatus[runID] = state
+	}
+	state.last = pos
+	state.ended = terminal
+	return true
+}
+
+// forgetRunStatus drops the status line state of a finished run. Lines
+// replayed later are recognised by their event ID.
+func (o *MLOrchestrator) forgetRunStatus(runID string) {
+	o.statusMu.Lock()
+	defer o.statusMu.Unlock()
+
+	delete(o.runStatus, runID)
+}
+
+// runStarted reports whether a run has already been started or ended
+func (o *MLOrchestrator) runStarted(ctx context.Context, runID string) (bool, error) {
+	run, err := o.db.GetRun(ctx, runID)
+	if errors.Is(err, database.ErrRunNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("looking up run: %w", err)
+	}
+	return run.StartedAt != nil || run.EndedAt != nil, nil
+}
+
+// statusEventID returns the event ID of a status line, the same for every
+// delivery of the line
+func statusEventID(runID, status string, record types.LogRecord) string {
+	name := fmt.Sprintf("%s/%s/%d/%d", runID, status, record.Timestamp, record.Seq)
+	return uuid.NewSHA1(statusEventNamespace, []byte(name)).String()
+}
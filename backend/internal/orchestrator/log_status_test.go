@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressPercent(t *testing.T) {
+	pct := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name string
+		line statusLine
+		want float64
+	}{
+		{"explicit percent", statusLine{Percent: pct(42.5), Epoch: 1, TotalEpochs: 10}, 42.5},
+		{"legacy progress", statusLine{Progress: pct(30)}, 30},
+		{"percent preferred over legacy progress", statusLine{Percent: pct(20), Progress: pct(30)}, 20},
+		{"epochs and steps", statusLine{Epoch: 2, TotalEpochs: 4, Step: 50, TotalSteps: 100}, 37.5},
+		{"first step of first epoch", statusLine{Epoch: 1, TotalEpochs: 4, Step: 0, TotalSteps: 100}, 0},
+		{"epoch zero counts as first", statusLine{Epoch: 0, TotalEpochs: 4, Step: 50, TotalSteps: 100}, 12.5},
+		{"steps only", statusLine{Step: 25, TotalSteps: 200}, 12.5},
+		{"epochs only", statusLine{Epoch: 3, TotalEpochs: 4}, 75},
+		{"nothing to go on", statusLine{Epoch: 3, Step: 10}, 0},
+		{"clamped above", statusLine{Percent: pct(140)}, 100},
+		{"clamped below", statusLine{Percent: pct(-5)}, 0},
+		{"steps past total clamped", statusLine{Step: 300, TotalSteps: 200}, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := progressPercent(&tt.line); got != tt.want {
+				t.Errorf("progressPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackProgress(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type report struct {
+		percent float64
+		after   time.Duration
+	}
+
+	// Each test reports its progress in order for one run and checks the
+	// rate and ETA of the last report
+	tests := []struct {
+		name     string
+		tracked  bool
+		reports  []report
+		wantRate float64
+		wantETA  *float64
+	}{
+		{
+			name:    "first report has no rate",
+			tracked: true,
+			reports: []report{{10, 0}},
+		},
+		{
+			name:     "rate since first report",
+			tracked:  true,
+			reports:  []report{{10, 0}, {20, 5 * time.Second}, {30, 10 * time.Second}},
+			wantRate: 2,
+			wantETA:  eta(35),
+		},
+		{
+			name:    "no progress made",
+			tracked: true,
+			reports: []report{{10, 0}, {10, 10 * time.Second}},
+		},
+		{
+			name:    "progress going back restarts the rate",
+			tracked: true,
+			reports: []report{{10, 0}, {50, 10 * time.Second}, {20, 20 * time.Second}},
+		},
+		{
+			name:     "rate measured from the restart",
+			tracked:  true,
+			reports:  []report{{10, 0}, {50, 10 * time.Second}, {20, 20 * time.Second}, {40, 30 * time.Second}},
+			wantRate: 2,
+			wantETA:  eta(30),
+		},
+		{
+			name:    "run without status lines",
+			reports: []report{{10, 0}, {30, 10 * time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &MLOrchestrator{runStatus: make(map[string]*runLogStatus)}
+			if tt.tracked {
+				o.runStatus["r1"] = &runLogStatus{}
+			}
+
+			for i, r := range tt.reports {
+				percent := r.percent
+				at := start.Add(r.after)
+				got := o.trackProgress("r1", &statusLine{Percent: &percent}, at)
+
+				if got.Percent != r.percent || !got.UpdatedAt.Equal(at) {
+					t.Fatalf("report %d: percent %v at %v, want %v at %v", i, got.Percent, got.UpdatedAt, r.percent, at)
+				}
+				if i < len(tt.reports)-1 {
+					continue
+				}
+
+				if got.Rate != tt.wantRate {
+					t.Errorf("rate = %v, want %v", got.Rate, tt.wantRate)
+				}
+				switch {
+				case tt.wantETA == nil && got.ETASeconds != nil:
+					t.Errorf("ETA = %v, want none", *got.ETASeconds)
+				case tt.wantETA != nil && got.ETASeconds == nil:
+					t.Errorf("no ETA, want %v", *tt.wantETA)
+				case tt.wantETA != nil && *got.ETASeconds != *tt.wantETA:
+					t.Errorf("ETA = %v, want %v", *got.ETASeconds, *tt.wantETA)
+				}
+			}
+		})
+	}
+}
+
+func eta(seconds float64) *float64 { return &seconds }
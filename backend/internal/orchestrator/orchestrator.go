@@ -2,32 +2,117 @@ package orchestrator
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
+	"sync"
+	"time"
 
+	"backend/internal/config"
+	"backend/internal/database"
 	"backend/internal/event"
 	"backend/internal/grpc"
+	"backend/internal/resilience"
 	"backend/internal/types"
+	pb "backend/proto"
 )
 
-// MLOrchestrator manages ML processes and status updates
+// cancelGracePeriod is how long a cancelled process may take to exit before
+// it is killed
+const cancelGracePeriod = 10 * time.Second
+
+// stopTimeout bounds a whole stop request, retries included, so a stuck
+// worker cannot hold up the command consumer or the watchdog
+const stopTimeout = cancelGracePeriod + 15*time.Second
+
+// serviceStatusTimeout bounds publishing an ML service availability event
+const serviceStatusTimeout = 10 * time.Second
+
+// MLOrchestrator manages ML processes and status updates. Train and predict
+// requests wait in a persistent job queue until they fit under the
+// concurrency limits.
 type MLOrchestrator struct {
-	grpcClient *grpc.Client
-	producer   *event.Producer
-	consumer   *event.Consumer
+	db             *database.Client
+	grpcClient     *grpc.Client
+	producer       *event.Producer
+	consumer       *event.Consumer
+	statusConsumer *event.Consumer
+
+	maxConcurrent    int
+	maxPerUser       int
+	dispatchInterval time.Duration
+
+	// mu serialises dispatch passes and guards positions, the last queue
+	// position published for each queued run
+	mu        sync.Mutex
+	positions map[string]int
+	wake      chan struct{}
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+
+	// Status lines of the ML service waiting to be published, and what was
+	// published per run
+	statusLogs chan types.LogRecord
+	statusMu   sync.Mutex
+	runStatus  map[string]*runLogStatus
+
+	// Stuck run watchdog
+	watchdogInterval time.Duration
+	lostAfter        time.Duration
+	hangAfter        time.Duration
+	maxRuntime       time.Duration
+	watchMu          sync.Mutex
+	watched          map[string]*runWatch
 }
 
 // NewMLOrchestrator creates a new ML Orchestrator
-func NewMLOrchestrator(grpcClient *grpc.Client, producer *event.Producer, consumer *event.Consumer) *MLOrchestrator {
+func NewMLOrchestrator(db *database.Client, grpcClient *grpc.Client, producer *event.Producer,
+	consumer *event.Consumer, statusConsumer *event.Consumer, cfg config.OrchestratorConfig) *MLOrchestrator {
+	dispatchInterval := defaultDispatchInterval
+	if cfg.DispatchInterval > 0 {
+		dispatchInterval = time.Duration(cfg.DispatchInterval) * time.Millisecond
+	}
+	watchdogInterval := defaultWatchdogInterval
+	if cfg.WatchdogInterval > 0 {
+		watchdogInterval = time.Duration(cfg.WatchdogInterval) * time.Millisecond
+	}
+	lostAfter := defaultLostAfter
+	if cfg.LostAfter > 0 {
+		lostAfter = time.Duration(cfg.LostAfter) * time.Millisecond
+	}
+
 	orchestrator := &MLOrchestrator{
-		grpcClient: grpcClient,
-		producer:   producer,
-		consumer:   consumer,
+		db:               db,
+		grpcClient:       grpcClient,
+		producer:         producer,
+		consumer:         consumer,
+		statusConsumer:   statusConsumer,
+		maxConcurrent:    cfg.MaxConcurrent,
+		maxPerUser:       cfg.MaxPerUser,
+		dispatchInterval: dispatchInterval,
+		positions:        make(map[string]int),
+		wake:             make(chan struct{}, 1),
+		stopChan:         make(chan struct{}),
+		statusLogs:       make(chan types.LogRecord, statusLogQueueSize),
+		runStatus:        make(map[string]*runLogStatus),
+		watchdogInterval: watchdogInterval,
+		lostAfter:        lostAfter,
+		hangAfter:        time.Duration(cfg.HangAfter) * time.Millisecond,
+		maxRuntime:       time.Duration(cfg.MaxRuntime) * time.Millisecond,
+		watched:          make(map[string]*runWatch),
 	}
 
 	// Subscribe to command events
 	consumer.Subscribe(event.EventTypeTrainRequested, orchestrator.handleTrainRequest)
 	consumer.Subscribe(event.EventTypePredictRequested, orchestrator.handlePredictRequest)
+	consumer.Subscribe(event.EventTypeCancelRequested, orchestrator.handleCancelRequest)
+
+	// Finished runs free their slot in the queue
+	statusConsumer.Subscribe(event.EventTypeModelCompleted, orchestrator.handleRunFinished)
+	statusConsumer.Subscribe(event.EventTypeModelFailed, orchestrator.handleRunFinished)
+	statusConsumer.Subscribe(event.EventTypeModelCancelled, orchestrator.handleRunFinished)
+
+	// Report when the ML service becomes unavailable or recovers
+	grpcClient.Breaker().OnStateChange(orchestrator.handleBreakerStateChange)
 
 	return orchestrator
 }
@@ -35,14 +120,19 @@ func NewMLOrchestrator(grpcClient *grpc.Client, producer *event.Producer, consum
 // Start begins the orchestrator operation
 func (o *MLOrchestrator) Start(ctx context.Context) {
 	o.consumer.Start(ctx)
+	o.statusConsumer.Start(ctx)
+	go o.dispatchLoop(ctx)
+	go o.statusLoop(ctx)
+	go o.watchdogLoop(ctx)
 }
 
 // Stop halts the orchestrator operation
 func (o *MLOrchestrator) Stop() {
+	o.stopOnce.Do(func() { close(o.stopChan) })
 	o.consumer.Stop()
 }
 
-// handleTrainRequest processes a training request
+// handleTrainRequest queues a training request
 func (o *MLOrchestrator) handleTrainRequest(ctx context.Context, eventType event.EventType, data []byte) error {
 	// Deserialize event
 	e, err := event.Deserialize(data, eventType)
@@ -59,46 +149,17 @@ func (o *MLOrchestrator) handleTrainRequest(ctx context.Context, eventType event
 	modelReq := types.ModelRequest{
 		Type:          "train",
 		ClientID:      trainEvent.ClientID,
+		RunID:         trainEvent.RunID,
 		Data:          trainEvent.Data,
 		StartDate:     trainEvent.StartDate,
 		EndDate:       trainEvent.EndDate,
 		Configuration: trainEvent.Configuration,
 	}
 
-	reqBytes, err := json.Marshal(modelReq)
-	if err != nil {
-		return fmt.Errorf("marshaling model request: %w", err)
-	}
-
-	// Call the Python ML service via gRPC
-	resp, err := o.grpcClient.StartProcess(ctx, trainEvent.ClientID, reqBytes)
-	if err != nil {
-		// Publish failure event
-		o.producer.PublishModelStatus(
-			ctx,
-			event.EventTypeModelFailed,
-			trainEvent.ClientID,
-			"error",
-			fmt.Sprintf("Failed to start training: %v", err),
-			"train",
-			0,
-		)
-		return fmt.Errorf("starting training process: %w", err)
-	}
-
-	// Publish started event
-	return o.producer.PublishModelStatus(
-		ctx,
-		event.EventTypeModelStarted,
-		trainEvent.ClientID,
-		resp.Status,
-		"Training process started",
-		"train",
-		0,
-	)
+	return o.enqueue(ctx, modelReq, PriorityBatch)
 }
 
-// handlePredictRequest processes a prediction request
+// handlePredictRequest queues a prediction request
 func (o *MLOrchestrator) handlePredictRequest(ctx context.Context, eventType event.EventType, data []byte) error {
 	// Deserialize event
 	e, err := event.Deserialize(data, eventType)
@@ -115,48 +176,112 @@ func (o *MLOrchestrator) handlePredictRequest(ctx context.Context, eventType eve
 	modelReq := types.ModelRequest{
 		Type:          "predict",
 		ClientID:      predictEvent.ClientID,
+		RunID:         predictEvent.RunID,
 		Data:          predictEvent.Data,
 		Configuration: predictEvent.Configuration,
+
+		ModelVersionID: predictEvent.ModelVersionID,
+		Artifact:       predictEvent.Artifact,
 	}
 
-	reqBytes, err := json.Marshal(modelReq)
+	return o.enqueue(ctx, modelReq, PriorityInteractive)
+}
+
+// handleCancelRequest stops a running process, escalating to a kill if it
+// does not exit within the grace period
+func (o *MLOrchestrator) handleCancelRequest(ctx context.Context, eventType event.EventType, data []byte) error {
+	e, err := event.Deserialize(data, eventType)
 	if err != nil {
-		return fmt.Errorf("marshaling model request: %w", err)
+		return fmt.Errorf("deserializing cancel event: %w", err)
 	}
 
-	// Call the Python ML service via gRPC
-	resp, err := o.grpcClient.StartProcess(ctx, predictEvent.ClientID, reqBytes)
+	cancelEvent, ok := e.(*event.CancelRequestedEvent)
+	if !ok {
+		return fmt.Errorf("expected CancelRequestedEvent but got %T", e)
+	}
+
+	// A run still waiting in the queue has no process to stop
+	dequeued, err := o.db.DeleteJob(ctx, cancelEvent.RunID, database.JobQueued)
+	if err != nil {
+		return fmt.Errorf("removing queued job: %w", err)
+	}
+	if dequeued {
+		o.wakeDispatcher()
+		return o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+			BaseEvent:  event.BaseEvent{Type: event.EventTypeModelCancelled, ClientID: cancelEvent.ClientID, RunID: cancelEvent.RunID},
+			Status:     types.StatusCancelled,
+			Message:    "Cancelled while queued",
+			ExitReason: "cancelled_while_queued",
+		})
+	}
+
+	resp, err := o.stopProcess(ctx, cancelEvent.ClientID, cancelEvent.RunID)
 	if err != nil {
-		// Publish failure event
-		o.producer.PublishModelStatus(
-			ctx,
-			event.EventTypeModelFailed,
-			predictEvent.ClientID,
-			"error",
-			fmt.Sprintf("Failed to start prediction: %v", err),
-			"predict",
-			0,
-		)
-		return fmt.Errorf("starting prediction process: %w", err)
-	}
-
-	// Publish started event
-	return o.producer.PublishModelStatus(
-		ctx,
-		event.EventTypeModelStarted,
-		predictEvent.ClientID,
-		resp.Status,
-		"Prediction process started",
-		"predict",
-		0,
-	)
+		return fmt.Errorf("stopping process: %w", err)
+	}
+
+	message := "Process cancelled"
+	if cancelEvent.Reason != "" {
+		message = fmt.Sprintf("Process cancelled: %s", cancelEvent.Reason)
+	}
+
+	exitReason := "cancelled"
+	switch resp.Status {
+	case "killed":
+		exitReason = "killed"
+		message += " (killed after grace period)"
+	case "not_found":
+		// The process already exited; record the cancellation anyway so
+		// the run does not stay active
+		exitReason = "cancelled_not_running"
+	}
+
+	return o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+		BaseEvent:  event.BaseEvent{Type: event.EventTypeModelCancelled, ClientID: cancelEvent.ClientID, RunID: cancelEvent.RunID},
+		Status:     types.StatusCancelled,
+		Message:    message,
+		ExitReason: exitReason,
+	})
+}
+
+// stopProcess stops a run within stopTimeout, however many attempts the
+// worker needs
+func (o *MLOrchestrator) stopProcess(ctx context.Context, clientID, runID string) (*pb.StopProcessResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, stopTimeout)
+	defer cancel()
+	return o.grpcClient.StopProcess(ctx, clientID, runID, cancelGracePeriod)
+}
+
+// handleBreakerStateChange publishes the availability of the ML service when
+// the circuit breaker opens or closes. It runs under the breaker's lock, so
+// publishing happens in the background.
+func (o *MLOrchestrator) handleBreakerStateChange(state resilience.BreakerState) {
+	switch state {
+	case resilience.BreakerOpen:
+		go o.publishServiceStatus(event.EventTypeServiceUnavailable, state, "ML service unavailable, failing fast")
+	case resilience.BreakerClosed:
+		go o.publishServiceStatus(event.EventTypeServiceAvailable, state, "ML service available")
+		// Start jobs held back while the service was down
+		o.wakeDispatcher()
+	}
 }
 
-// ProcessLogToStatus processes log data to extract status updates
-func (o *MLOrchestrator) ProcessLogToStatus(ctx context.Context, log types.LogRecord) error {
-	// In a real implementation, you would parse the log message to see if it contains
-	// status update information, and if so, publish a status event
+// publishServiceStatus publishes a service availability event
+func (o *MLOrchestrator) publishServiceStatus(eventType event.EventType, state resilience.BreakerState, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), serviceStatusTimeout)
+	defer cancel()
 
-	// For now, let's keep this as a placeholder for future implementation
-	return nil
+	e := event.ServiceStatusEvent{
+		BaseEvent: event.BaseEvent{Type: eventType},
+		State:     string(state),
+		Message:   message,
+	}
+	if state == resilience.BreakerOpen {
+		retryAt := o.grpcClient.Breaker().RetryAt()
+		e.RetryAt = &retryAt
+	}
+
+	if err := o.producer.PublishServiceStatus(ctx, e); err != nil {
+		log.Printf("Error publishing ML service status: %v", err)
+	}
 }
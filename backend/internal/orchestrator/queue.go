@@ -0,0 +1,336 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/database"
+	"backend/internal/event"
+	"backend/internal/resilience"
+	"backend/internal/types"
+)
+
+// Priority classes. Jobs with a lower priority are dispatched first, so
+// interactive predictions run ahead of batch training.
+const (
+	PriorityInteractive = 0
+	PriorityBatch       = 10
+)
+
+// priorityClasses maps priority class names to priorities
+var priorityClasses = map[string]int{
+	"interactive": PriorityInteractive,
+	"batch":       PriorityBatch,
+}
+
+// defaultDispatchInterval is how often the queue is checked when nothing
+// wakes the dispatcher
+const defaultDispatchInterval = 5 * time.Second
+
+// ErrUnknownPriority is returned when reordering to an unknown priority class
+var ErrUnknownPriority = errors.New("unknown priority class")
+
+// QueuedJob is a job waiting in the queue
+type QueuedJob struct {
+	database.Job
+	PriorityClass string `json:"priority_class"`
+	Position      int    `json:"position"`
+}
+
+// QueueStatus is a snapshot of the job queue
+type QueueStatus struct {
+	Queued        []QueuedJob    `json:"queued"`
+	Running       []database.Job `json:"running"`
+	MaxConcurrent int            `json:"max_concurrent"`
+	MaxPerUser    int            `json:"max_per_user"`
+}
+
+// Queue returns a client's queued jobs in dispatch order and its running
+// jobs. Positions count the queued jobs of every client.
+func (o *MLOrchestrator) Queue(ctx context.Context, clientID string) (*QueueStatus, error) {
+	queued, err := o.db.ListJobs(ctx, database.JobQueued)
+	if err != nil {
+		return nil, err
+	}
+	running, err := o.db.ListJobs(ctx, database.JobDispatched)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &QueueStatus{
+		Queued:        []QueuedJob{},
+		Running:       []database.Job{},
+		MaxConcurrent: o.maxConcurrent,
+		MaxPerUser:    o.maxPerUser,
+	}
+	for _, job := range running {
+		if job.ClientID == clientID {
+			status.Running = append(status.Running, job)
+		}
+	}
+	for i, job := range queued {
+		if job.ClientID != clientID {
+			continue
+		}
+		status.Queued = append(status.Queued, QueuedJob{
+			Job:           job,
+			PriorityClass: priorityClass(job.Priority),
+			Position:      i + 1,
+		})
+	}
+	return status, nil
+}
+
+// ReorderJob moves a client's queued job to a lower priority class and/or
+// to a position among the client's jobs of its class. An empty class keeps
+// the current one; position 0 moves the job behind the client's other jobs.
+func (o *MLOrchestrator) ReorderJob(ctx context.Context, clientID, runID, class string, position int) error {
+	var priority *int
+	if class != "" {
+		p, ok := priorityClasses[class]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownPriority, class)
+		}
+		priority = &p
+	}
+
+	if err := o.db.ReorderJob(ctx, clientID, runID, priority, position); err != nil {
+		return err
+	}
+
+	// Publish the new positions
+	o.wakeDispatcher()
+	return nil
+}
+
+// enqueue adds a model request to the job queue and wakes the dispatcher
+func (o *MLOrchestrator) enqueue(ctx context.Context, req types.ModelRequest, priority int) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshaling model request: %w", err)
+	}
+
+	err = o.db.EnqueueJob(ctx, database.Job{
+		RunID:       req.RunID,
+		ClientID:    req.ClientID,
+		ProcessType: req.Type,
+		Priority:    priority,
+		Payload:     payload,
+		EnqueuedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	o.wakeDispatcher()
+	return nil
+}
+
+// handleRunFinished frees the queue slot of a finished run
+func (o *MLOrchestrator) handleRunFinished(ctx context.Context, eventType event.EventType, data []byte) error {
+	e, err := event.Deserialize(data, eventType)
+	if err != nil {
+		return fmt.Errorf("deserializing status event: %w", err)
+	}
+
+	statusEvent, ok := e.(*event.ModelStatusEvent)
+	if !ok {
+		return fmt.Errorf("expected ModelStatusEvent but got %T", e)
+	}
+	if statusEvent.RunID == "" {
+		return nil
+	}
+	o.forgetRunStatus(statusEvent.RunID)
+	o.forgetWatch(statusEvent.RunID)
+
+	released, err := o.db.DeleteJob(ctx, statusEvent.RunID, database.JobDispatched)
+	if err != nil {
+		return fmt.Errorf("releasing job: %w", err)
+	}
+	if released {
+		o.wakeDispatcher()
+	}
+	return nil
+}
+
+// wakeDispatcher triggers a dispatch pass without blocking
+func (o *MLOrchestrator) wakeDispatcher() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchLoop runs dispatch passes when woken and periodically, which
+// also picks up jobs left queued by a previous run of the server
+func (o *MLOrchestrator) dispatchLoop(ctx context.Context) {
+	ticker := time.NewTicker(o.dispatchInterval)
+	defer ticker.Stop()
+
+	o.dispatch(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.stopChan:
+			return
+		case <-o.wake:
+			o.dispatch(ctx)
+		case <-ticker.C:
+			o.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch starts queued jobs in priority order while they fit under the
+// global and per-user limits, then publishes the positions of jobs that
+// are still waiting
+func (o *MLOrchestrator) dispatch(ctx context.Context) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, err := o.db.ReleaseFinishedJobs(ctx); err != nil {
+		log.Printf("Error releasing finished jobs: %v", err)
+	}
+
+	queued, err := o.db.ListJobs(ctx, database.JobQueued)
+	if err != nil {
+		log.Printf("Error listing queued jobs: %v", err)
+		return
+	}
+	active, perUser, err := o.db.ActiveJobCounts(ctx)
+	if err != nil {
+		log.Printf("Error counting active jobs: %v", err)
+		return
+	}
+
+	// Jobs stay queued while the ML service is unavailable
+	available := o.grpcClient.Breaker().State() != resilience.BreakerOpen
+
+	var waiting []database.Job
+	for _, job := range queued {
+		if !available {
+			waiting = append(waiting, job)
+			continue
+		}
+		if o.maxConcurrent > 0 && active >= o.maxConcurrent {
+			waiting = append(waiting, job)
+			continue
+		}
+		if o.maxPerUser > 0 && perUser[job.ClientID] >= o.maxPerUser {
+			waiting = append(waiting, job)
+			continue
+		}
+
+		claimed, err := o.db.ClaimJob(ctx, job.RunID)
+		if err != nil {
+			log.Printf("Error claiming job %s: %v", job.RunID, err)
+			continue
+		}
+		if !claimed {
+			// Cancelled since it was listed
+			continue
+		}
+
+		if err := o.startJob(ctx, job); err != nil {
+			if errors.Is(err, resilience.ErrCircuitOpen) {
+				// The service went down; keep the job for when it is back
+				if err := o.db.RequeueJob(ctx, job.RunID); err != nil {
+					log.Printf("Error requeueing job %s: %v", job.RunID, err)
+				}
+				available = false
+				waiting = append(waiting, job)
+				continue
+			}
+			log.Printf("Error starting job %s: %v", job.RunID, err)
+			if _, err := o.db.DeleteJob(ctx, job.RunID); err != nil {
+				log.Printf("Error removing failed job %s: %v", job.RunID, err)
+			}
+			continue
+		}
+		active++
+		perUser[job.ClientID]++
+	}
+
+	// Report queue positions that changed since the last pass
+	positions := make(map[string]int, len(waiting))
+	for i, job := range waiting {
+		position := i + 1
+		positions[job.RunID] = position
+		if o.positions[job.RunID] == position {
+			continue
+		}
+
+		err := o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+			BaseEvent:     event.BaseEvent{Type: event.EventTypeModelQueued, ClientID: job.ClientID, RunID: job.RunID},
+			Status:        types.StatusQueued,
+			Message:       fmt.Sprintf("Waiting in queue at position %d", position),
+			ProcessType:   job.ProcessType,
+			QueuePosition: position,
+		})
+		if err != nil {
+			log.Printf("Error publishing queue position for %s: %v", job.RunID, err)
+			delete(positions, job.RunID)
+		}
+	}
+	o.positions = positions
+}
+
+// startJob starts the process of a dispatched job and publishes whether it
+// started. It returns an error only if the process did not start; the run
+// is not failed when the circuit breaker rejected the call.
+func (o *MLOrchestrator) startJob(ctx context.Context, job database.Job) error {
+	var modelReq types.ModelRequest
+	if err := json.Unmarshal(job.Payload, &modelReq); err != nil {
+		return fmt.Errorf("decoding model request: %w", err)
+	}
+
+	name, startedMessage := "training", "Training process started"
+	if job.ProcessType == "predict" {
+		name, startedMessage = "prediction", "Prediction process started"
+	}
+
+	// Call the Python ML service via gRPC
+	resp, err := o.grpcClient.StartProcess(ctx, job.ClientID, job.RunID, job.Payload)
+	if errors.Is(err, resilience.ErrCircuitOpen) {
+		return err
+	}
+	if err != nil {
+		// Publish failure event
+		o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+			BaseEvent:   event.BaseEvent{Type: event.EventTypeModelFailed, ClientID: job.ClientID, RunID: job.RunID},
+			Status:      types.StatusError,
+			Message:     fmt.Sprintf("Failed to start %s: %v", name, err),
+			ProcessType: job.ProcessType,
+			Config:      modelReq.Configuration,
+			ExitReason:  "start_failed",
+		})
+		return fmt.Errorf("starting %s process: %w", name, err)
+	}
+
+	// Publish started event
+	err = o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+		BaseEvent:   event.BaseEvent{Type: event.EventTypeModelStarted, ClientID: job.ClientID, RunID: job.RunID},
+		Status:      types.StatusRunning,
+		Message:     startedMessage,
+		ProcessType: job.ProcessType,
+		Config:      modelReq.Configuration,
+		ProcessID:   int(resp.ProcessId),
+	})
+	if err != nil {
+		log.Printf("Error publishing start of %s: %v", job.RunID, err)
+	}
+	return nil
+}
+
+// priorityClass returns the name of the class a priority belongs to
+func priorityClass(priority int) string {
+	if priority <= PriorityInteractive {
+		return "interactive"
+	}
+	return "batch"
+}
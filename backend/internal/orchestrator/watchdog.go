@@ -0,0 +1,196 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/internal/database"
+	"backend/internal/event"
+	"backend/internal/types"
+)
+
+// Defaults of the stuck run watchdog
+const (
+	defaultWatchdogInterval = 15 * time.Second
+	defaultLostAfter        = time.Minute
+)
+
+// Exit reasons of runs failed by the watchdog. The runs get status error,
+// and run history filters on the exit reason to find them.
+const (
+	// ExitReasonLost is set on runs whose process no worker reports
+	ExitReasonLost = "lost"
+	// ExitReasonTimedOut is set on runs that hung or ran too long
+	ExitReasonTimedOut = "timed_out"
+)
+
+// runWatch is what the watchdog knows about a running run
+type runWatch struct {
+	// Last log of the run, or when the watchdog first saw it
+	lastActivity time.Time
+	// Since when no worker has reported the run, zero while one does
+	missingSince time.Time
+}
+
+// noteActivity records that a watched run has logged. Runs are watched
+// from the first check that finds them running, so late logs of finished
+// runs are ignored.
+func (o *MLOrchestrator) noteActivity(runID string) {
+	o.watchMu.Lock()
+	defer o.watchMu.Unlock()
+
+	if w, ok := o.watched[runID]; ok {
+		w.lastActivity = time.Now()
+	}
+}
+
+// forgetWatch drops the watchdog state of a finished run
+func (o *MLOrchestrator) forgetWatch(runID string) {
+	o.watchMu.Lock()
+	defer o.watchMu.Unlock()
+
+	delete(o.watched, runID)
+}
+
+// watchdogLoop reconciles running runs with the workers at startup and then
+// checks them every watchdog interval
+func (o *MLOrchestrator) watchdogLoop(ctx context.Context) {
+	ticker := time.NewTicker(o.watchdogInterval)
+	defer ticker.Stop()
+
+	o.checkRuns(ctx, true)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.stopChan:
+			return
+		case <-ticker.C:
+			o.checkRuns(ctx, false)
+		}
+	}
+}
+
+// checkRuns fails the running runs that are lost or hung. At startup runs
+// missing from the workers are failed straight away when every worker has
+// reported its processes, as they ended while the backend was down.
+// Processes of runs that have already ended, such as runs failed as lost
+// while their worker was unreachable, are stopped.
+func (o *MLOrchestrator) checkRuns(ctx context.Context, startup bool) {
+	runs, err := o.db.ListRunningRuns(ctx)
+	if err != nil {
+		log.Printf("Watchdog error listing running runs: %v", err)
+		return
+	}
+	reported, complete := o.grpcClient.RunningRuns()
+
+	running := make(map[string]bool, len(runs))
+	for _, run := range runs {
+		running[run.RunID] = true
+		if reason, message := o.inspectRun(run, reported, startup && complete); reason != "" {
+			o.failRun(ctx, run, reason, message)
+		}
+	}
+
+	for runID, healthy := range reported {
+		if healthy && !running[runID] {
+			o.checkStrayRun(ctx, runID, startup)
+		}
+	}
+}
+
+// checkStrayRun stops the process of a run a worker reports but that is not
+// recorded as running. Runs that have not ended yet are left alone, as their
+// start may not be recorded yet.
+func (o *MLOrchestrator) checkStrayRun(ctx context.Context, runID string, startup bool) {
+	run, err := o.db.GetRun(ctx, runID)
+	if err != nil && !errors.Is(err, database.ErrRunNotFound) {
+		log.Printf("Watchdog error loading run %s: %v", runID, err)
+		return
+	}
+	if run == nil || run.EndedAt == nil {
+		if startup {
+			log.Printf("Watchdog: worker reports run %s, which is not recorded as running", runID)
+		}
+		return
+	}
+
+	log.Printf("Watchdog: stopping run %s, which already ended as %s", runID, run.Status)
+	if _, err := o.stopProcess(ctx, run.ClientID, runID); err != nil {
+		log.Printf("Watchdog error stopping run %s: %v", runID, err)
+	}
+}
+
+// inspectRun returns the exit reason and message to fail a run with, or an
+// empty reason while the run looks healthy. Runs of an unhealthy worker are
+// not lost or hung, as the worker may only be unreachable for a while; their
+// clocks restart when it is back.
+func (o *MLOrchestrator) inspectRun(run types.ModelRun, reported map[string]bool, reconcile bool) (string, string) {
+	now := time.Now()
+
+	o.watchMu.Lock()
+	defer o.watchMu.Unlock()
+
+	w, ok := o.watched[run.RunID]
+	if !ok {
+		w = &runWatch{lastActivity: now}
+		o.watched[run.RunID] = w
+	}
+
+	healthy, pinned := reported[run.RunID]
+	switch {
+	case healthy:
+		w.missingSince = time.Time{}
+	case pinned:
+		w.missingSince = time.Time{}
+		w.lastActivity = now
+	default:
+		if reconcile {
+			return ExitReasonLost, "Process not running on any worker after the backend restarted"
+		}
+		if w.missingSince.IsZero() {
+			w.missingSince = now
+		}
+		if missing := now.Sub(w.missingSince); missing >= o.lostAfter {
+			return ExitReasonLost, fmt.Sprintf("Process not reported by any worker for %s", missing.Round(time.Second))
+		}
+	}
+
+	if o.hangAfter > 0 {
+		if idle := now.Sub(w.lastActivity); idle >= o.hangAfter {
+			return ExitReasonTimedOut, fmt.Sprintf("No logs for %s", idle.Round(time.Second))
+		}
+	}
+	if o.maxRuntime > 0 && run.StartedAt != nil && now.Sub(*run.StartedAt) >= o.maxRuntime {
+		return ExitReasonTimedOut, fmt.Sprintf("Ran longer than %s", o.maxRuntime)
+	}
+	return "", ""
+}
+
+// failRun publishes the failure of a stuck run. Processes that timed out
+// may still be running and are stopped first.
+func (o *MLOrchestrator) failRun(ctx context.Context, run types.ModelRun, reason, message string) {
+	log.Printf("Watchdog: failing run %s (%s): %s", run.RunID, reason, message)
+
+	if reason == ExitReasonTimedOut {
+		if _, err := o.stopProcess(ctx, run.ClientID, run.RunID); err != nil {
+			log.Printf("Watchdog error stopping run %s: %v", run.RunID, err)
+		}
+	}
+
+	err := o.producer.PublishStatusEvent(ctx, event.ModelStatusEvent{
+		BaseEvent:   event.BaseEvent{Type: event.EventTypeModelFailed, ClientID: run.ClientID, RunID: run.RunID},
+		Status:      types.StatusError,
+		Message:     message,
+		ProcessType: run.ProcessType,
+		ExitReason:  reason,
+	})
+	if err != nil {
+		log.Printf("Watchdog error publishing failure of run %s: %v", run.RunID, err)
+		return
+	}
+	o.forgetWatch(run.RunID)
+}
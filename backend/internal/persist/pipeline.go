@@ -0,0 +1,372 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/database"
+	"backend/internal/types"
+)
+
+// Defaults used when the log streaming config leaves a value unset
+const (
+	defaultBatchSize      = 1000
+	defaultFlushInterval  = 500 * time.Millisecond
+	defaultEnqueueTimeout = time.Second
+	defaultReplayInterval = 5 * time.Second
+	defaultSpoolDir       = "spool/logs"
+	writeTimeout          = 10 * time.Second
+)
+
+// PipelineStats reports throughput and backpressure of the pipeline
+type PipelineStats struct {
+	QueueDepth     int       `json:"queue_depth"`
+	QueueCapacity  int       `json:"queue_capacity"`
+	Enqueued       int64     `json:"enqueued"`
+	Written        int64     `json:"written"`
+	Batches        int64     `json:"batches"`
+	FlushErrors    int64     `json:"flush_errors"`
+	Spooled        int64     `json:"spooled"`
+	Replayed       int64     `json:"replayed"`
+	Dropped        int64     `json:"dropped"`
+	BlockedEnqueue int64     `json:"blocked_enqueues"`
+	BlockedSeconds float64   `json:"blocked_seconds"`
+	SpoolFiles     int       `json:"spool_files"`
+	SpoolBytes     int64     `json:"spool_bytes"`
+	DBHealthy      bool      `json:"db_healthy"`
+	LastFlush      time.Time `json:"last_flush,omitempty"`
+}
+
+// Pipeline batches logs received from the ML service and writes them to
+// TimescaleDB. Batches that cannot be written are spooled to disk and
+// replayed once the database is reachable again.
+type Pipeline struct {
+	db    *database.Client
+	spool *Spool
+	queue chan types.LogRecord
+
+	batchSize      int
+	flushInterval  time.Duration
+	enqueueTimeout time.Duration
+	replayInterval time.Duration
+
+	enqueued       atomic.Int64
+	written        atomic.Int64
+	batches        atomic.Int64
+	flushErrors    atomic.Int64
+	spooled        atomic.Int64
+	replayed       atomic.Int64
+	dropped        atomic.Int64
+	blockedEnqueue atomic.Int64
+	blockedNanos   atomic.Int64
+	dbHealthy      atomic.Bool
+	lastFlush      atomic.Int64
+
+	mu       sync.Mutex
+	running  bool
+	stopChan chan struct{}
+	done     chan struct{}
+
+	// enqueueMu is held for reading by Enqueue calls in flight, so the run
+	// loop can close the queue before draining it and no log arrives after
+	enqueueMu sync.RWMutex
+	closed    bool
+}
+
+// NewPipeline creates a persistence pipeline from the log streaming config
+func NewPipeline(db *database.Client, cfg config.LogStreamingConfig) (*Pipeline, error) {
+	batchSize := cfg.BufferSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize < batchSize {
+		queueSize = batchSize * 10
+	}
+
+	spoolDir := cfg.SpoolDir
+	if spoolDir == "" {
+		spoolDir = defaultSpoolDir
+	}
+
+	spool, err := NewSpool(spoolDir, int64(cfg.SpoolMaxMB)<<20)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{
+		db:             db,
+		spool:          spool,
+		queue:          make(chan types.LogRecord, queueSize),
+		batchSize:      batchSize,
+		flushInterval:  millisOr(cfg.FlushInterval, defaultFlushInterval),
+		enqueueTimeout: millisOr(cfg.EnqueueTimeout, defaultEnqueueTimeout),
+		replayInterval: millisOr(cfg.ReplayInterval, defaultReplayInterval),
+		stopChan:       make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	p.dbHealthy.Store(true)
+
+	return p, nil
+}
+
+// Start begins writing queued logs and replaying the spool
+func (p *Pipeline) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running {
+		return
+	}
+	p.running = true
+
+	go p.run(ctx)
+	go p.replayLoop(ctx)
+}
+
+// Stop flushes queued logs and halts the pipeline
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.running = false
+	close(p.stopChan)
+	p.mu.Unlock()
+
+	<-p.done
+}
+
+// Enqueue queues a log for persistence. When the queue is full the caller is
+// blocked for up to the enqueue timeout, which pushes back on the log stream;
+// after that, or once ctx is done, the log is dropped. Logs enqueued after
+// the pipeline stopped are dropped too.
+func (p *Pipeline) Enqueue(ctx context.Context, record types.LogRecord) {
+	p.enqueueMu.RLock()
+	defer p.enqueueMu.RUnlock()
+
+	if p.closed {
+		p.dropped.Add(1)
+		return
+	}
+
+	select {
+	case p.queue <- record:
+		p.enqueued.Add(1)
+		return
+	default:
+	}
+
+	p.blockedEnqueue.Add(1)
+	start := time.Now()
+	timer := time.NewTimer(p.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.queue <- record:
+		p.enqueued.Add(1)
+	case <-timer.C:
+		p.dropped.Add(1)
+	case <-ctx.Done():
+		p.dropped.Add(1)
+	case <-p.stopChan:
+		p.dropped.Add(1)
+	}
+	p.blockedNanos.Add(int64(time.Since(start)))
+}
+
+// Stats returns a snapshot of the pipeline metrics
+func (p *Pipeline) Stats() PipelineStats {
+	files, size, err := p.spool.Usage()
+	if err != nil {
+		log.Printf("Error reading log spool usage: %v", err)
+	}
+
+	stats := PipelineStats{
+		QueueDepth:     len(p.queue),
+		QueueCapacity:  cap(p.queue),
+		Enqueued:       p.enqueued.Load(),
+		Written:        p.written.Load(),
+		Batches:        p.batches.Load(),
+		FlushErrors:    p.flushErrors.Load(),
+		Spooled:        p.spooled.Load(),
+		Replayed:       p.replayed.Load(),
+		Dropped:        p.dropped.Load(),
+		BlockedEnqueue: p.blockedEnqueue.Load(),
+		BlockedSeconds: time.Duration(p.blockedNanos.Load()).Seconds(),
+		SpoolFiles:     files,
+		SpoolBytes:     size,
+		DBHealthy:      p.dbHealthy.Load(),
+	}
+	if last := p.lastFlush.Load(); last > 0 {
+		stats.LastFlush = time.Unix(0, last)
+	}
+	return stats
+}
+
+// run collects queued logs into batches and flushes them
+func (p *Pipeline) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]types.LogRecord, 0, p.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		p.flush(batch)
+		batch = make([]types.LogRecord, 0, p.batchSize)
+	}
+
+	for {
+		select {
+		case record := <-p.queue:
+			batch = append(batch, record)
+			if len(batch) >= p.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			p.closeQueue()
+			p.drain(&batch, flush)
+			return
+		case <-p.stopChan:
+			p.closeQueue()
+			p.drain(&batch, flush)
+			return
+		}
+	}
+}
+
+// closeQueue stops accepting logs. It waits for Enqueue calls in flight,
+// which give up once the pipeline is stopping.
+func (p *Pipeline) closeQueue() {
+	p.enqueueMu.Lock()
+	defer p.enqueueMu.Unlock()
+
+	p.closed = true
+}
+
+// drain flushes everything still queued at shutdown
+func (p *Pipeline) drain(batch *[]types.LogRecord, flush func()) {
+	for {
+		select {
+		case record := <-p.queue:
+			*batch = append(*batch, record)
+			if len(*batch) >= p.batchSize {
+				flush()
+			}
+		default:
+			flush()
+			return
+		}
+	}
+}
+
+// flush writes a batch to the database, spooling it on failure
+func (p *Pipeline) flush(batch []types.LogRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	written, err := p.db.CopyLogs(ctx, batch)
+	if err != nil {
+		log.Printf("Error writing %d logs, spooling to disk: %v", len(batch), err)
+		p.flushErrors.Add(1)
+		p.dbHealthy.Store(false)
+
+		if err := p.spool.Write(batch); err != nil {
+			log.Printf("Error spooling %d logs, dropping: %v", len(batch), err)
+			p.dropped.Add(int64(len(batch)))
+			return
+		}
+		p.spooled.Add(int64(len(batch)))
+		return
+	}
+
+	p.written.Add(written)
+	p.batches.Add(1)
+	p.dbHealthy.Store(true)
+	p.lastFlush.Store(time.Now().UnixNano())
+}
+
+// replayLoop periodically replays spooled batches
+func (p *Pipeline) replayLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stopChan:
+			return
+		case <-ticker.C:
+			if err := p.replay(ctx); err != nil {
+				log.Printf("Log spool replay stopped: %v", err)
+			}
+		}
+	}
+}
+
+// replay writes spooled batches back to the database, oldest first
+func (p *Pipeline) replay(ctx context.Context) error {
+	files, err := p.spool.Files()
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+	err = p.db.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		p.dbHealthy.Store(false)
+		return fmt.Errorf("database unavailable: %w", err)
+	}
+	p.dbHealthy.Store(true)
+
+	for _, path := range files {
+		logs, err := p.spool.Read(path)
+		if err != nil {
+			// Move unreadable files aside so they don't block the spool
+			log.Printf("Error reading spool file %s: %v", path, err)
+			if err := os.Rename(path, path+".bad"); err != nil {
+				return fmt.Errorf("quarantining spool file: %w", err)
+			}
+			continue
+		}
+
+		writeCtx, cancel := context.WithTimeout(ctx, writeTimeout)
+		_, err = p.db.CopyLogs(writeCtx, logs)
+		cancel()
+		if err != nil {
+			p.dbHealthy.Store(false)
+			return fmt.Errorf("replaying %s: %w", path, err)
+		}
+
+		if err := p.spool.Remove(path); err != nil {
+			return fmt.Errorf("removing replayed spool file: %w", err)
+		}
+		p.replayed.Add(int64(len(logs)))
+		log.Printf("Replayed %d spooled logs", len(logs))
+	}
+
+	return nil
+}
+
+func millisOr(ms int, fallback time.Duration) time.Duration {
+	if ms <= 0 {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
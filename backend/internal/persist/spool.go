@@ -0,0 +1,147 @@
+package persist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"backend/internal/types"
+)
+
+// ErrSpoolFull is returned when writing a batch would exceed the spool limit
+var ErrSpoolFull = errors.New("log spool is full")
+
+const spoolExt = ".jsonl"
+
+// Spool is an on-disk dead-letter queue of log batches that could not be
+// written to the database. Each batch is stored as its own JSON lines file.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+// NewSpool creates a spool in dir, creating the directory if needed
+func NewSpool(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+	return &Spool{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// Write stores a batch in a new spool file
+func (s *Spool) Write(logs []types.LogRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf []byte
+	for _, log := range logs {
+		line, err := json.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("encoding spooled log: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	_, size, err := s.usage()
+	if err != nil {
+		return err
+	}
+	if s.maxBytes > 0 && size+int64(len(buf)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+
+	// Write to a temporary file first so replay never sees a partial batch
+	name := fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolExt)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return fmt.Errorf("writing spool file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("committing spool file: %w", err)
+	}
+	return nil
+}
+
+// Files returns the spooled batch files, oldest first
+func (s *Spool) Files() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, _, err := s.usage()
+	return files, err
+}
+
+// Read loads the logs stored in a spool file
+func (s *Spool) Read(path string) ([]types.LogRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening spool file: %w", err)
+	}
+	defer f.Close()
+
+	var logs []types.LogRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 32<<20)
+	for scanner.Scan() {
+		var log types.LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &log); err != nil {
+			return nil, fmt.Errorf("decoding spooled log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading spool file: %w", err)
+	}
+	return logs, nil
+}
+
+// Remove deletes a spool file once its logs have been replayed
+func (s *Spool) Remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.Remove(path)
+}
+
+// Usage returns the number of spooled batches and their total size in bytes
+func (s *Spool) Usage() (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, size, err := s.usage()
+	return len(files), size, err
+}
+
+// usage lists spool files and their total size. Callers must hold s.mu.
+func (s *Spool) usage() ([]string, int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing spool directory: %w", err)
+	}
+
+	var files []string
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != spoolExt {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(s.dir, entry.Name()))
+		size += info.Size()
+	}
+
+	// File names start with a zero-padded timestamp, so this is oldest first
+	sort.Strings(files)
+	return files, size, nil
+}
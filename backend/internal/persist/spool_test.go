@@ -0,0 +1,187 @@
+package persist
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/internal/types"
+)
+
+func spoolBatch(runID string, n int) []types.LogRecord {
+	logs := make([]types.LogRecord, n)
+	for i := range logs {
+		logs[i] = types.LogRecord{
+			Timestamp: int64(1000 + i),
+			Seq:       int64(i + 1),
+			ClientID:  "c1",
+			RunID:     runID,
+			Message:   []byte{0x93, byte(i), 0xff, '\n'},
+			Decoded: &types.DecodedLog{
+				Time:  time.Date(2024, 1, 1, 12, 0, i, 0, time.UTC),
+				Level: "INFO",
+				Msg:   "line\nwith a newline",
+			},
+		}
+	}
+	return logs
+}
+
+func TestSpoolReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][]types.LogRecord
+	}{
+		{"empty", nil},
+		{"one batch", [][]types.LogRecord{spoolBatch("r1", 3)}},
+		{"batches oldest first", [][]types.LogRecord{spoolBatch("r1", 2), spoolBatch("r2", 1), spoolBatch("r3", 4)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpool(filepath.Join(t.TempDir(), "spool", "logs"), 0)
+			if err != nil {
+				t.Fatalf("NewSpool() error = %v", err)
+			}
+			for _, batch := range tt.batches {
+				if err := s.Write(batch); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			count, size, err := s.Usage()
+			if err != nil {
+				t.Fatalf("Usage() error = %v", err)
+			}
+			if count != len(tt.batches) || (count > 0) != (size > 0) {
+				t.Errorf("Usage() = %d files, %d bytes, want %d files", count, size, len(tt.batches))
+			}
+
+			// Replay the way the pipeline does: read each file, then remove it
+			files, err := s.Files()
+			if err != nil {
+				t.Fatalf("Files() error = %v", err)
+			}
+			if len(files) != len(tt.batches) {
+				t.Fatalf("Files() = %d files, want %d", len(files), len(tt.batches))
+			}
+			for i, path := range files {
+				logs, err := s.Read(path)
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+				if !reflect.DeepEqual(logs, tt.batches[i]) {
+					t.Errorf("batch %d = %+v, want %+v", i, logs, tt.batches[i])
+				}
+				if err := s.Remove(path); err != nil {
+					t.Fatalf("Remove() error = %v", err)
+				}
+			}
+
+			if count, size, _ := s.Usage(); count != 0 || size != 0 {
+				t.Errorf("Usage() after replay = %d files, %d bytes, want empty", count, size)
+			}
+		})
+	}
+}
+
+func TestSpoolLimit(t *testing.T) {
+	batch := spoolBatch("r1", 2)
+
+	// Size of one batch on disk
+	probe, err := NewSpool(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewSpool() error = %v", err)
+	}
+	if err := probe.Write(batch); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	_, batchSize, _ := probe.Usage()
+
+	tests := []struct {
+		name      string
+		maxBytes  int64
+		writes    int
+		wantFiles int
+		wantFull  bool
+	}{
+		{"unlimited", 0, 3, 3, false},
+		{"room for all", 3 * batchSize, 3, 3, false},
+		{"full", 2 * batchSize, 3, 2, true},
+		{"smaller than a batch", batchSize - 1, 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSpool(t.TempDir(), tt.maxBytes)
+			if err != nil {
+				t.Fatalf("NewSpool() error = %v", err)
+			}
+
+			var full bool
+			for i := 0; i < tt.writes; i++ {
+				err := s.Write(batch)
+				if errors.Is(err, ErrSpoolFull) {
+					full = true
+				} else if err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+
+			if full != tt.wantFull {
+				t.Errorf("spool full = %v, want %v", full, tt.wantFull)
+			}
+			if count, _, _ := s.Usage(); count != tt.wantFiles {
+				t.Errorf("Usage() = %d files, want %d", count, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestSpoolSkipsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("NewSpool() error = %v", err)
+	}
+	if err := s.Write(spoolBatch("r1", 1)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// A batch still being written, a quarantined file and a directory
+	for _, name := range []string{"00000000000000000001.jsonl.tmp", "00000000000000000002.jsonl.bad"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "00000000000000000003.jsonl"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Files() = %v, want only the written batch", files)
+	}
+}
+
+func TestSpoolReadCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSpool(dir, 0)
+	if err != nil {
+		t.Fatalf("NewSpool() error = %v", err)
+	}
+
+	path := filepath.Join(dir, "00000000000000000001.jsonl")
+	if err := os.WriteFile(path, []byte("{\"client_id\":\"c1\"}\n{\"client_id\":"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(path); err == nil {
+		t.Error("Read() of a truncated batch succeeded")
+	}
+}
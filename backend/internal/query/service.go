@@ -2,6 +2,8 @@ package query
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
@@ -9,6 +11,7 @@ import (
 
 	"backend/internal/database"
 	"backend/internal/event"
+	"backend/internal/types"
 )
 
 // ModelStats contains derived statistics for model runs
@@ -23,37 +26,67 @@ type ModelStats struct {
 
 // ModelState represents the current state of a model
 type ModelState struct {
-	ClientID     string      `json:"client_id"`
-	Status       string      `json:"status"`
-	ProcessType  string      `json:"process_type"`
-	StartTime    time.Time   `json:"start_time"`
-	EndTime      *time.Time  `json:"end_time,omitempty"`
-	Runtime      float64     `json:"runtime"`
-	Message      string      `json:"message"`
-	Config       interface{} `json:"config,omitempty"`
-	Performance  interface{} `json:"performance,omitempty"`
-	Stats        ModelStats  `json:"stats,omitempty"`
-	LogCount     int         `json:"log_count"`
-	ErrorCount   int         `json:"error_count"`
-	WarningCount int         `json:"warning_count"`
+	RunID         string          `json:"run_id"`
+	ClientID      string          `json:"client_id"`
+	Status        string          `json:"status"`
+	ProcessType   string          `json:"process_type"`
+	StartTime     time.Time       `json:"start_time"`
+	EndTime       *time.Time      `json:"end_time,omitempty"`
+	Runtime       float64         `json:"runtime"`
+	Message       string          `json:"message"`
+	ProcessID     int             `json:"process_id,omitempty"`
+	ExitReason    string          `json:"exit_reason,omitempty"`
+	QueuePosition int             `json:"queue_position,omitempty"`
+	Progress      *types.Progress `json:"progress,omitempty"`
+	Config        interface{}     `json:"config,omitempty"`
+	Performance   interface{}     `json:"performance,omitempty"`
+	Stats         ModelStats      `json:"stats,omitempty"`
+	LogCount      int             `json:"log_count"`
+	ErrorCount    int             `json:"error_count"`
+	WarningCount  int             `json:"warning_count"`
 }
 
-// QueryFilter provides filtering options for queries
+// QueryFilter provides filtering, sorting and pagination options for
+// history queries. Runtimes are in seconds; Config filters on fields of the
+// run configuration. Cursor is the NextCursor of a previous page.
 type QueryFilter struct {
-	ClientID      string    `json:"client_id"`
-	ProcessType   string    `json:"process_type"`
-	Status        string    `json:"status"`
-	StartTimeFrom time.Time `json:"start_time_from"`
-	StartTimeTo   time.Time `json:"start_time_to"`
-	Limit         int       `json:"limit"`
-	Offset        int       `json:"offset"`
+	ClientID      string                    `json:"client_id"`
+	ProcessType   string                    `json:"process_type"`
+	Status        string                    `json:"status"`
+	ExitReason    string                    `json:"exit_reason,omitempty"`
+	StartTimeFrom time.Time                 `json:"start_time_from"`
+	StartTimeTo   time.Time                 `json:"start_time_to"`
+	MinRuntime    *float64                  `json:"min_runtime,omitempty"`
+	MaxRuntime    *float64                  `json:"max_runtime,omitempty"`
+	Config        []database.FieldPredicate `json:"config,omitempty"`
+	SortBy        string                    `json:"sort_by"`
+	SortOrder     string                    `json:"sort_order"`
+	Cursor        string                    `json:"cursor,omitempty"`
+	Limit         int                       `json:"limit"`
+	Offset        int                       `json:"offset"`
 }
 
-// QueryService maintains materialized views and provides query APIs
+// HistoryPage is a page of model history
+type HistoryPage struct {
+	Models     []*ModelState `json:"models"`
+	Count      int           `json:"count"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// Log levels reported as warnings and errors in summaries
+var (
+	warningLevels = []string{"WARNING"}
+	errorLevels   = []string{"ERROR", "CRITICAL"}
+)
+
+// QueryService maintains materialized views and provides query APIs.
+// Running models and runs are keyed by run ID, history by client ID.
 type QueryService struct {
 	db            *database.Client
 	consumer      *event.Consumer
 	runningModels map[string]*ModelState
+	runs          map[string]*ModelState
 	modelHistory  map[string][]*ModelState
 	mu            sync.RWMutex
 	running       bool
@@ -66,6 +99,7 @@ func NewQueryService(db *database.Client, consumer *event.Consumer) *QueryServic
 		db:            db,
 		consumer:      consumer,
 		runningModels: make(map[string]*ModelState),
+		runs:          make(map[string]*ModelState),
 		modelHistory:  make(map[string][]*ModelState),
 		stopChan:      make(chan struct{}),
 	}
@@ -82,10 +116,12 @@ func (s *QueryService) Start(ctx context.Context) error {
 	s.mu.Unlock()
 
 	// Subscribe to model status events
+	s.consumer.Subscribe(event.EventTypeModelQueued, s.handleModelStatusUpdate)
 	s.consumer.Subscribe(event.EventTypeModelStarted, s.handleModelStatusUpdate)
 	s.consumer.Subscribe(event.EventTypeModelCompleted, s.handleModelStatusUpdate)
 	s.consumer.Subscribe(event.EventTypeModelFailed, s.handleModelStatusUpdate)
 	s.consumer.Subscribe(event.EventTypeModelProgress, s.handleModelStatusUpdate)
+	s.consumer.Subscribe(event.EventTypeModelCancelled, s.handleModelStatusUpdate)
 
 	// Start the Kafka consumer
 	s.consumer.Start(ctx)
@@ -113,10 +149,9 @@ func (s *QueryService) Stop() {
 	s.running = false
 }
 
-// loadInitialState loads the current state from the database
+// loadInitialState rebuilds running models and history from the run table
 func (s *QueryService) loadInitialState(ctx context.Context) {
-	// Load model statuses from database
-	statuses, err := s.db.GetAllModelStatuses(ctx)
+	runs, err := s.db.ListRuns(ctx)
 	if err != nil {
 		log.Printf("Error loading initial model states: %v", err)
 		return
@@ -125,35 +160,56 @@ func (s *QueryService) loadInitialState(ctx context.Context) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, status := range statuses {
-		modelState := &ModelState{
-			ClientID:    status.ClientID,
-			Status:      status.Status,
-			ProcessType: status.ProcessType,
-			StartTime:   status.Timestamp,
-			Message:     status.Message,
-		}
+	// Runs are oldest first, matching the order of history
+	for _, run := range runs {
+		modelState := stateFromRun(run)
 
-		// If status is running, add to running models
-		if status.Status == "running" || status.Status == "pending" {
-			s.runningModels[status.ClientID] = modelState
+		if !types.IsTerminalStatus(run.Status) && run.Status != types.StatusQueued {
+			s.runningModels[run.RunID] = modelState
 		}
 
-		// Add to history for this client
-		s.modelHistory[status.ClientID] = append(s.modelHistory[status.ClientID], modelState)
+		s.runs[run.RunID] = modelState
+		s.modelHistory[run.ClientID] = append(s.modelHistory[run.ClientID], modelState)
 	}
 
-	// For each client, calculate logs count
-	for clientID, state := range s.runningModels {
-		logCount, err := s.db.CountClientLogs(ctx, clientID, state.StartTime, time.Now())
+	// For each running model, calculate logs count
+	for runID, state := range s.runningModels {
+		counts, err := s.db.GetRunLogCountsByLevel(ctx, runID)
 		if err != nil {
-			log.Printf("Error counting logs for client %s: %v", clientID, err)
+			log.Printf("Error counting logs for run %s: %v", runID, err)
 			continue
 		}
-		state.LogCount = logCount
+		state.LogCount = s.sumLogCounts(counts)
 	}
 }
 
+// stateFromRun converts a persisted run to its model state
+func stateFromRun(run types.ModelRun) *ModelState {
+	state := &ModelState{
+		RunID:       run.RunID,
+		ClientID:    run.ClientID,
+		Status:      run.Status,
+		ProcessType: run.ProcessType,
+		StartTime:   run.CreatedAt,
+		EndTime:     run.EndedAt,
+		Message:     run.Message,
+		ProcessID:   run.ProcessID,
+		ExitReason:  run.ExitReason,
+		Config:      run.Config,
+		Progress:    run.Progress,
+	}
+	if run.StartedAt != nil {
+		state.StartTime = *run.StartedAt
+	}
+	if run.EndedAt != nil {
+		state.Runtime = run.EndedAt.Sub(state.StartTime).Seconds()
+	}
+	if run.Metrics != nil {
+		state.Performance = run.Metrics
+	}
+	return state
+}
+
 // periodicRefresh updates statistics periodically
 func (s *QueryService) periodicRefresh(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -173,6 +229,10 @@ func (s *QueryService) periodicRefresh(ctx context.Context) {
 
 // refreshModelStats updates statistics for all models
 func (s *QueryService) refreshModelStats(ctx context.Context) {
+	// Query the database before taking the write lock
+	warnings := s.loadCommonWarnings(ctx)
+	s.refreshLogCounts(ctx)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -192,7 +252,7 @@ func (s *QueryService) refreshModelStats(ctx context.Context) {
 			var runtime float64
 			if state.EndTime != nil {
 				runtime = state.EndTime.Sub(state.StartTime).Seconds()
-			} else if state.Status == "completed" || state.Status == "error" {
+			} else if types.IsTerminalStatus(state.Status) {
 				// If status is final but no end time, use current as approximation
 				runtime = time.Now().Sub(state.StartTime).Seconds()
 			}
@@ -212,20 +272,68 @@ func (s *QueryService) refreshModelStats(ctx context.Context) {
 
 		// Update statistics
 		latestState.Stats = ModelStats{
-			AverageRuntime:  totalRuntime / float64(totalRuns),
-			TotalRuns:       totalRuns,
-			SuccessRate:     float64(successCount) / float64(totalRuns) * 100,
-			LastRunTime:     latestState.StartTime.Format(time.RFC3339),
-			AverageLogCount: float64(totalLogs) / float64(totalRuns),
+			AverageRuntime:    totalRuntime / float64(totalRuns),
+			TotalRuns:         totalRuns,
+			SuccessRate:       float64(successCount) / float64(totalRuns) * 100,
+			LastRunTime:       latestState.StartTime.Format(time.RFC3339),
+			AverageLogCount:   float64(totalLogs) / float64(totalRuns),
+			MostCommonWarning: warnings[clientID],
 		}
 
-		// Update running model if this client has one
-		if running, ok := s.runningModels[clientID]; ok {
-			running.Stats = latestState.Stats
+		// Update the client's running models
+		for _, running := range s.runningModels {
+			if running.ClientID == clientID {
+				running.Stats = latestState.Stats
+			}
 		}
 	}
 }
 
+// loadCommonWarnings returns the most frequent warning message per client
+func (s *QueryService) loadCommonWarnings(ctx context.Context) map[string]string {
+	s.mu.RLock()
+	firstRun := make(map[string]time.Time, len(s.modelHistory))
+	for clientID, history := range s.modelHistory {
+		if len(history) > 0 {
+			firstRun[clientID] = history[0].StartTime
+		}
+	}
+	s.mu.RUnlock()
+
+	warnings, err := s.db.GetTopLogMessageByClient(ctx, firstRun, warningLevels)
+	if err != nil {
+		log.Printf("Error loading common warnings: %v", err)
+		return nil
+	}
+	return warnings
+}
+
+// refreshLogCounts updates log, warning and error counts of running models
+func (s *QueryService) refreshLogCounts(ctx context.Context) {
+	s.mu.RLock()
+	runIDs := make([]string, 0, len(s.runningModels))
+	for runID := range s.runningModels {
+		runIDs = append(runIDs, runID)
+	}
+	s.mu.RUnlock()
+
+	for _, runID := range runIDs {
+		counts, err := s.db.GetRunLogCountsByLevel(ctx, runID)
+		if err != nil {
+			log.Printf("Error counting logs for run %s: %v", runID, err)
+			continue
+		}
+
+		s.mu.Lock()
+		if state, ok := s.runningModels[runID]; ok {
+			state.LogCount = s.sumLogCounts(counts)
+			state.WarningCount = sumLevels(counts, warningLevels)
+			state.ErrorCount = sumLevels(counts, errorLevels)
+		}
+		s.mu.Unlock()
+	}
+}
+
 // handleModelStatusUpdate processes model status update events
 func (s *QueryService) handleModelStatusUpdate(ctx context.Context, eventType event.EventType, data []byte) error {
 	// Deserialize event
@@ -239,32 +347,68 @@ func (s *QueryService) handleModelStatusUpdate(ctx context.Context, eventType ev
 		return fmt.Errorf("expected ModelStatusEvent but got %T", e)
 	}
 
+	// Events from producers that predate runs use the client ID as the run
+	runID := statusEvent.RunID
+	if runID == "" {
+		runID = statusEvent.ClientID
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Handle based on the event type
 	switch eventType {
+	case event.EventTypeModelQueued:
+		// Queued runs wait in the orchestrator; only their place changes
+		modelState, ok := s.runs[runID]
+		if !ok {
+			modelState = &ModelState{
+				RunID:       runID,
+				ClientID:    statusEvent.ClientID,
+				ProcessType: statusEvent.ProcessType,
+				StartTime:   statusEvent.Timestamp,
+				Config:      statusEvent.Config,
+			}
+			s.runs[runID] = modelState
+			s.modelHistory[statusEvent.ClientID] = append(s.modelHistory[statusEvent.ClientID], modelState)
+		}
+		if modelState.EndTime == nil {
+			modelState.Status = types.StatusQueued
+			modelState.Message = statusEvent.Message
+			modelState.QueuePosition = statusEvent.QueuePosition
+		}
+
 	case event.EventTypeModelStarted:
-		modelState := &ModelState{
-			ClientID:    statusEvent.ClientID,
-			Status:      "running",
-			ProcessType: statusEvent.ProcessType,
-			StartTime:   statusEvent.Timestamp,
-			Message:     statusEvent.Message,
+		// A run recorded as pending is updated in place
+		modelState, ok := s.runs[runID]
+		if !ok {
+			modelState = &ModelState{RunID: runID, ClientID: statusEvent.ClientID}
+			s.runs[runID] = modelState
+			s.modelHistory[statusEvent.ClientID] = append(s.modelHistory[statusEvent.ClientID], modelState)
+		}
+		modelState.Status = "running"
+		modelState.ProcessType = statusEvent.ProcessType
+		modelState.StartTime = statusEvent.Timestamp
+		modelState.Message = statusEvent.Message
+		modelState.ProcessID = statusEvent.ProcessID
+		modelState.QueuePosition = 0
+		if statusEvent.Config != nil {
+			modelState.Config = statusEvent.Config
 		}
-		s.runningModels[statusEvent.ClientID] = modelState
-		s.modelHistory[statusEvent.ClientID] = append(s.modelHistory[statusEvent.ClientID], modelState)
+		s.runningModels[runID] = modelState
+
+	case event.EventTypeModelCompleted, event.EventTypeModelFailed, event.EventTypeModelCancelled:
+		status := terminalStatus(eventType)
 
-	case event.EventTypeModelCompleted, event.EventTypeModelFailed:
 		// Try to find the running model
-		if existing, ok := s.runningModels[statusEvent.ClientID]; ok {
+		if existing, ok := s.runningModels[runID]; ok {
 			// Update status
-			if eventType == event.EventTypeModelCompleted {
-				existing.Status = "completed"
-			} else {
-				existing.Status = "error"
-			}
+			existing.Status = status
 			existing.Message = statusEvent.Message
+			existing.ExitReason = statusEvent.ExitReason
+			if statusEvent.Metrics != nil {
+				existing.Performance = statusEvent.Metrics
+			}
 
 			// Set end time
 			now := time.Now()
@@ -272,44 +416,71 @@ func (s *QueryService) handleModelStatusUpdate(ctx context.Context, eventType ev
 			existing.Runtime = now.Sub(existing.StartTime).Seconds()
 
 			// Remove from running models
-			delete(s.runningModels, statusEvent.ClientID)
-		} else {
-			// If not found in running, create a new state for history
-			status := ""
-			if eventType == event.EventTypeModelCompleted {
-				status = "completed"
-			} else {
-				status = "error"
-			}
+			delete(s.runningModels, runID)
+		} else if _, known := s.runs[runID]; !known {
+			// If not found at all, create a new state for history. Runs
+			// that already ended keep their final state.
 			modelState := &ModelState{
+				RunID:       runID,
 				ClientID:    statusEvent.ClientID,
 				Status:      status,
 				ProcessType: statusEvent.ProcessType,
 				StartTime:   statusEvent.Timestamp,
 				Message:     statusEvent.Message,
 				EndTime:     &statusEvent.Timestamp,
+				ProcessID:   statusEvent.ProcessID,
+				ExitReason:  statusEvent.ExitReason,
+				Config:      statusEvent.Config,
 			}
+			if statusEvent.Metrics != nil {
+				modelState.Performance = statusEvent.Metrics
+			}
+			s.runs[runID] = modelState
 			s.modelHistory[statusEvent.ClientID] = append(s.modelHistory[statusEvent.ClientID], modelState)
 		}
 
 	case event.EventTypeModelProgress:
 		// Update progress on running model
-		if existing, ok := s.runningModels[statusEvent.ClientID]; ok {
-			existing.Message = statusEvent.Message
+		if existing, ok := s.runningModels[runID]; ok {
+			if statusEvent.Message != "" {
+				existing.Message = statusEvent.Message
+			}
+			if statusEvent.ProgressDetail != nil {
+				existing.Progress = statusEvent.ProgressDetail
+			}
 		}
 	}
 
 	return nil
 }
 
-// GetModelState returns the current state of a specific model
+// terminalStatus returns the final status a terminal event puts a run in
+func terminalStatus(eventType event.EventType) string {
+	switch eventType {
+	case event.EventTypeModelCompleted:
+		return types.StatusCompleted
+	case event.EventTypeModelCancelled:
+		return types.StatusCancelled
+	default:
+		return types.StatusError
+	}
+}
+
+// GetModelState returns the current state of a client's model: its most
+// recently started running model, or its latest run otherwise
 func (s *QueryService) GetModelState(clientID string) (*ModelState, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// First check running models
-	if state, ok := s.runningModels[clientID]; ok {
-		return state, true
+	var latest *ModelState
+	for _, state := range s.runningModels {
+		if state.ClientID == clientID && (latest == nil || state.StartTime.After(latest.StartTime)) {
+			latest = state
+		}
+	}
+	if latest != nil {
+		return latest, true
 	}
 
 	// Then check history for the latest state
@@ -320,6 +491,43 @@ func (s *QueryService) GetModelState(clientID string) (*ModelState, bool) {
 	return nil, false
 }
 
+// GetRun returns the state of a single run
+func (s *QueryService) GetRun(runID string) (*ModelState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.runs[runID]
+	return state, ok
+}
+
+// RunClient returns the client a run belongs to
+func (s *QueryService) RunClient(ctx context.Context, runID string) (string, error) {
+	if state, ok := s.GetRun(runID); ok {
+		return state.ClientID, nil
+	}
+
+	run, err := s.db.GetRun(ctx, runID)
+	if err != nil {
+		return "", err
+	}
+	return run.ClientID, nil
+}
+
+// GetRunEvents returns the recorded lifecycle transitions of a run
+func (s *QueryService) GetRunEvents(ctx context.Context, runID string) ([]types.RunEvent, error) {
+	return s.db.GetRunEvents(ctx, runID)
+}
+
+// GetRunMetrics returns the downsampled metrics of a run
+func (s *QueryService) GetRunMetrics(ctx context.Context, q database.MetricQuery) (*database.MetricSeries, error) {
+	return s.db.QueryRunMetrics(ctx, q)
+}
+
+// CompareRunMetrics returns a metric of several runs aligned by step
+func (s *QueryService) CompareRunMetrics(ctx context.Context, runIDs []string, name string, points int) (*database.MetricComparison, error) {
+	return s.db.CompareRunMetrics(ctx, runIDs, name, points)
+}
+
 // GetRunningModels returns all currently running models
 func (s *QueryService) GetRunningModels() []*ModelState {
 	s.mu.RLock()
@@ -332,67 +540,61 @@ func (s *QueryService) GetRunningModels() []*ModelState {
 	return result
 }
 
-// QueryModelHistory returns filtered model history
-func (s *QueryService) QueryModelHistory(filter QueryFilter) []*ModelState {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	var results []*ModelState
-
-	// If client ID is specified, only search that client
-	if filter.ClientID != "" {
-		history, ok := s.modelHistory[filter.ClientID]
-		if !ok {
-			return nil
-		}
-
-		for _, state := range history {
-			if s.matchesFilter(state, filter) {
-				results = append(results, state)
-			}
-		}
-	} else {
-		// Search all clients
-		for _, history := range s.modelHistory {
-			for _, state := range history {
-				if s.matchesFilter(state, filter) {
-					results = append(results, state)
-				}
-			}
+// QueryModelHistory returns a sorted page of model history from the run
+// table. Running models carry their live log counts and statistics.
+func (s *QueryService) QueryModelHistory(ctx context.Context, filter QueryFilter) (*HistoryPage, error) {
+	q := database.RunQuery{
+		ClientID:    filter.ClientID,
+		ProcessType: filter.ProcessType,
+		Status:      filter.Status,
+		ExitReason:  filter.ExitReason,
+		StartFrom:   filter.StartTimeFrom,
+		StartTo:     filter.StartTimeTo,
+		MinRuntime:  filter.MinRuntime,
+		MaxRuntime:  filter.MaxRuntime,
+		Config:      filter.Config,
+		SortBy:      filter.SortBy,
+		Ascending:   filter.SortOrder == "asc",
+		Limit:       filter.Limit,
+		Offset:      filter.Offset,
+	}
+	if filter.Cursor != "" {
+		var after database.RunCursor
+		if err := decodeCursor(filter.Cursor, &after); err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", database.ErrInvalidRunQuery)
 		}
+		q.After = &after
 	}
 
-	// Sort and paginate results
-	// (simplified - in production you'd want proper sorting and pagination)
-	if filter.Limit > 0 && len(results) > filter.Limit {
-		end := filter.Offset + filter.Limit
-		if end > len(results) {
-			end = len(results)
-		}
-		if filter.Offset < end {
-			return results[filter.Offset:end]
-		}
-		return nil
+	page, err := s.db.QueryRuns(ctx, q)
+	if err != nil {
+		return nil, err
 	}
 
-	return results
-}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-// matchesFilter checks if a model state matches the given filter
-func (s *QueryService) matchesFilter(state *ModelState, filter QueryFilter) bool {
-	if filter.ProcessType != "" && state.ProcessType != filter.ProcessType {
-		return false
-	}
-	if filter.Status != "" && state.Status != filter.Status {
-		return false
+	result := &HistoryPage{
+		Models: make([]*ModelState, 0, len(page.Runs)),
+		Count:  len(page.Runs),
+		Total:  page.Total,
 	}
-	if !filter.StartTimeFrom.IsZero() && state.StartTime.Before(filter.StartTimeFrom) {
-		return false
+	for _, run := range page.Runs {
+		state := stateFromRun(run.ModelRun)
+		state.Runtime = run.Runtime
+		if live, ok := s.runs[run.RunID]; ok {
+			state.LogCount = live.LogCount
+			state.WarningCount = live.WarningCount
+			state.ErrorCount = live.ErrorCount
+			state.Stats = live.Stats
+		}
+		result.Models = append(result.Models, state)
 	}
-	if !filter.StartTimeTo.IsZero() && state.StartTime.After(filter.StartTimeTo) {
-		return false
+	if page.NextCursor != nil {
+		result.NextCursor = encodeCursor(page.NextCursor)
 	}
-	return true
+
+	return result, nil
 }
 
 // GetLogSummary returns summarized log information for a specific client
@@ -409,15 +611,73 @@ func (s *QueryService) GetLogSummary(ctx context.Context, clientID string, from,
 		return nil, fmt.Errorf("querying log rates: %w", err)
 	}
 
+	// Get the most frequent warning and error messages
+	topMessages, err := s.db.GetTopLogMessages(ctx, clientID, from, to,
+		append(append([]string{}, warningLevels...), errorLevels...), 10)
+	if err != nil {
+		return nil, fmt.Errorf("querying top log messages: %w", err)
+	}
+
 	return map[string]interface{}{
-		"log_counts": logCounts,
-		"log_rates":  logRates,
-		"from":       from,
-		"to":         to,
-		"total_logs": s.sumLogCounts(logCounts),
+		"log_counts":    logCounts,
+		"log_rates":     logRates,
+		"top_messages":  topMessages,
+		"from":          from,
+		"to":            to,
+		"total_logs":    s.sumLogCounts(logCounts),
+		"warning_count": sumLevels(logCounts, warningLevels),
+		"error_count":   sumLevels(logCounts, errorLevels),
 	}, nil
 }
 
+// LogSearchResponse is a page of log search results with an opaque cursor
+type LogSearchResponse struct {
+	Results    []database.LogSearchResult `json:"results"`
+	Count      int                        `json:"count"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
+}
+
+// SearchLogs searches logs across runs. cursor is the NextCursor of a
+// previous response, or empty for the first page.
+func (s *QueryService) SearchLogs(ctx context.Context, search database.LogSearch, cursor string) (*LogSearchResponse, error) {
+	if cursor != "" {
+		var after database.SearchCursor
+		if err := decodeCursor(cursor, &after); err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", database.ErrInvalidSearch)
+		}
+		search.After = &after
+	}
+
+	page, err := s.db.SearchLogs(ctx, search)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &LogSearchResponse{
+		Results: page.Results,
+		Count:   len(page.Results),
+	}
+	if page.NextCursor != nil {
+		response.NextCursor = encodeCursor(page.NextCursor)
+	}
+	return response, nil
+}
+
+// encodeCursor encodes a database cursor as an opaque string
+func encodeCursor(cursor interface{}) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor decodes a cursor made by encodeCursor into cursor
+func decodeCursor(value string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cursor)
+}
+
 // sumLogCounts sums the log counts across all levels
 func (s *QueryService) sumLogCounts(logCounts map[string]int) int {
 	total := 0
@@ -426,3 +686,12 @@ func (s *QueryService) sumLogCounts(logCounts map[string]int) int {
 	}
 	return total
 }
+
+// sumLevels sums the log counts of the given levels
+func sumLevels(logCounts map[string]int, levels []string) int {
+	total := 0
+	for _, level := range levels {
+		total += logCounts[level]
+	}
+	return total
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/database"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor database.RunCursor
+	}{
+		{"start time", database.RunCursor{SortBy: "start_time", Value: "2024-01-01T12:00:00.123456Z", RunID: "run-1"}},
+		{"runtime", database.RunCursor{SortBy: "runtime", Value: "3600.5", RunID: "run-2"}},
+		{"null sort value", database.RunCursor{SortBy: "status", RunID: "run-3"}},
+		{"unicode and separators", database.RunCursor{SortBy: "client_id", Value: "ü/+=?&", RunID: "run-4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(&tt.cursor)
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("encodeCursor() = %q, not safe in a URL", encoded)
+			}
+
+			var got database.RunCursor
+			if err := decodeCursor(encoded, &got); err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if got != tt.cursor {
+				t.Errorf("decodeCursor() = %+v, want %+v", got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", "e30="},
+		{"not JSON", "bm90IGpzb24"},
+		{"wrong shape", "WzEsMiwzXQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got database.RunCursor
+			if err := decodeCursor(tt.value, &got); err == nil {
+				t.Errorf("decodeCursor(%q) = %+v, want an error", tt.value, got)
+			}
+
+			// The history query rejects it before reaching the database
+			s := &QueryService{}
+			_, err := s.QueryModelHistory(context.Background(), QueryFilter{Cursor: tt.value})
+			if !errors.Is(err, database.ErrInvalidRunQuery) {
+				t.Errorf("QueryModelHistory() error = %v, want ErrInvalidRunQuery", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned while the breaker rejects calls
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Breaker states
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// Breaker is a circuit breaker. It opens after a number of consecutive
+// failures and rejects calls until the cooldown has passed, then lets a
+// single trial call through: its success closes the breaker and its failure
+// opens it again.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trialOut  bool
+	listeners []func(state BreakerState)
+}
+
+// NewBreaker creates a closed breaker that opens after threshold
+// consecutive failures
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+}
+
+// OnStateChange registers a listener for state changes. Listeners run
+// synchronously and must not call back into the breaker.
+func (b *Breaker) OnStateChange(listener func(state BreakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.listeners = append(b.listeners, listener)
+}
+
+// State returns the current state
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// RetryAt returns when an open breaker lets the next trial call through
+func (b *Breaker) RetryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.openedAt.Add(b.cooldown)
+}
+
+// Allow reports whether a call may go ahead, returning ErrCircuitOpen if
+// not. Every allowed call must be followed by Success or Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+		b.trialOut = true
+		return nil
+	case BreakerHalfOpen:
+		if b.trialOut {
+			return ErrCircuitOpen
+		}
+		b.trialOut = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success records a successful call
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trialOut = false
+	if b.state != BreakerClosed {
+		b.setState(BreakerClosed)
+	}
+}
+
+// Failure records a failed call
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialOut = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState changes the state and notifies listeners. The caller holds mu.
+func (b *Breaker) setState(state BreakerState) {
+	b.state = state
+	for _, listener := range b.listeners {
+		listener(state)
+	}
+}
@@ -0,0 +1,132 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+		calls     []string // "ok" or "fail", each after an allowed Allow
+		wait      time.Duration
+		wantState BreakerState
+		wantAllow error
+	}{
+		{
+			name:      "stays closed below the threshold",
+			threshold: 3,
+			cooldown:  time.Hour,
+			calls:     []string{"fail", "fail"},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "success resets the failure count",
+			threshold: 2,
+			cooldown:  time.Hour,
+			calls:     []string{"fail", "ok", "fail"},
+			wantState: BreakerClosed,
+		},
+		{
+			name:      "opens at the threshold",
+			threshold: 2,
+			cooldown:  time.Hour,
+			calls:     []string{"fail", "fail"},
+			wantState: BreakerOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+		{
+			name:      "half opens after the cooldown",
+			threshold: 1,
+			cooldown:  10 * time.Millisecond,
+			calls:     []string{"fail"},
+			wait:      20 * time.Millisecond,
+			wantState: BreakerHalfOpen,
+		},
+		{
+			name:      "zero threshold opens on the first failure",
+			threshold: 0,
+			cooldown:  time.Hour,
+			calls:     []string{"fail"},
+			wantState: BreakerOpen,
+			wantAllow: ErrCircuitOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(tt.threshold, tt.cooldown)
+			for _, call := range tt.calls {
+				if err := b.Allow(); err != nil {
+					t.Fatalf("Allow() = %v before the breaker opened", err)
+				}
+				if call == "ok" {
+					b.Success()
+				} else {
+					b.Failure()
+				}
+			}
+			time.Sleep(tt.wait)
+
+			if got := b.State(); got != tt.wantState {
+				t.Errorf("State() = %s, want %s", got, tt.wantState)
+			}
+			if err := b.Allow(); !errors.Is(err, tt.wantAllow) {
+				t.Errorf("Allow() = %v, want %v", err, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestBreakerTrial(t *testing.T) {
+	tests := []struct {
+		name      string
+		trialOK   bool
+		wantState BreakerState
+	}{
+		{name: "successful trial closes", trialOK: true, wantState: BreakerClosed},
+		{name: "failed trial opens again", trialOK: false, wantState: BreakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []BreakerState
+			b := NewBreaker(1, 10*time.Millisecond)
+			b.OnStateChange(func(state BreakerState) { changes = append(changes, state) })
+
+			if err := b.Allow(); err != nil {
+				t.Fatal(err)
+			}
+			b.Failure()
+			time.Sleep(20 * time.Millisecond)
+
+			if err := b.Allow(); err != nil {
+				t.Fatalf("trial Allow() = %v", err)
+			}
+			if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("second call during the trial: Allow() = %v, want %v", err, ErrCircuitOpen)
+			}
+			if tt.trialOK {
+				b.Success()
+			} else {
+				b.Failure()
+			}
+
+			if got := b.State(); got != tt.wantState {
+				t.Errorf("State() = %s, want %s", got, tt.wantState)
+			}
+			want := []BreakerState{BreakerOpen, BreakerHalfOpen, tt.wantState}
+			if len(changes) != len(want) {
+				t.Fatalf("state changes = %v, want %v", changes, want)
+			}
+			for i := range want {
+				if changes[i] != want[i] {
+					t.Fatalf("state changes = %v, want %v", changes, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures retries with exponential backoff
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the delay before the given retry, starting at 1. The
+// delay doubles with every retry up to MaxBackoff, with up to 20% jitter
+// so that callers do not retry in lockstep.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay > 0 {
+		delay -= time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	}
+	return delay
+}
+
+// Retry calls fn until it succeeds, returns an error retryable rejects, the
+// retries are used up or ctx is done. It returns the last error.
+func Retry(ctx context.Context, policy RetryPolicy, retryable func(error) bool, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(ctx); err == nil || !retryable(err) || attempt >= policy.MaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(attempt + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{retry: 1, max: 100 * time.Millisecond},
+		{retry: 2, max: 200 * time.Millisecond},
+		{retry: 3, max: 400 * time.Millisecond},
+		{retry: 4, max: 800 * time.Millisecond},
+		{retry: 5, max: time.Second},
+		{retry: 50, max: time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := policy.Backoff(tt.retry)
+			// Jitter takes off up to 20%
+			if got > tt.max || got < tt.max*4/5 {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.retry, got, tt.max*4/5, tt.max)
+			}
+		}
+	}
+
+	if got := (RetryPolicy{}).Backoff(3); got != 0 {
+		t.Errorf("Backoff without delays = %v, want 0", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errPermanent := errors.New("permanent")
+	policy := RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	retryable := func(err error) bool { return errors.Is(err, errTemporary) }
+
+	tests := []struct {
+		name      string
+		results   []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "first attempt succeeds", results: []error{nil}, wantCalls: 1},
+		{name: "succeeds after retries", results: []error{errTemporary, errTemporary, nil}, wantCalls: 3},
+		{name: "stops on a permanent error", results: []error{errTemporary, errPermanent}, wantErr: errPermanent, wantCalls: 2},
+		{
+			name:      "gives up after the retries",
+			results:   []error{errTemporary, errTemporary, errTemporary, errTemporary, nil},
+			wantErr:   errTemporary,
+			wantCalls: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Retry(context.Background(), policy, retryable, func(ctx context.Context) error {
+				calls++
+				return tt.results[calls-1]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Retry() = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxRetries: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	errTemporary := errors.New("temporary")
+
+	calls := 0
+	err := Retry(ctx, policy, func(error) bool { return true }, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errTemporary
+	})
+	if !errors.Is(err, errTemporary) || calls != 1 {
+		t.Errorf("Retry() = %v after %d calls, want %v after 1", err, calls, errTemporary)
+	}
+}
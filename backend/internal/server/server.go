@@ -9,14 +9,20 @@ import (
 
 	"backend/internal/auth"
 	"backend/internal/buffer"
+	"backend/internal/cleanup"
 	"backend/internal/config"
 	"backend/internal/database"
 	"backend/internal/event"
 	"backend/internal/grpc"
 	"backend/internal/handler"
+	"backend/internal/hub"
+	"backend/internal/logdecode"
+	"backend/internal/mail"
 	"backend/internal/orchestrator"
+	"backend/internal/persist"
 	"backend/internal/query"
 	"backend/internal/store"
+	"backend/internal/types"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,18 +36,22 @@ type Server struct {
 	jwtService      *auth.JWTService
 	grpcClient      *grpc.Client
 	logBuffer       *buffer.LogBuffer
+	logPipeline     *persist.Pipeline
+	logHub          *hub.Hub
 	producer        *event.Producer
 	commandConsumer *event.Consumer
 	statusConsumer  *event.Consumer
 	orchestrator    *orchestrator.MLOrchestrator
 	statusHandler   *handler.StatusHandler
 	queryService    *query.QueryService
+	mailer          mail.Mailer
+	guestCleanup    *cleanup.GuestCleanup
 }
 
 func New(cfg *config.Config, tsdb *database.Client, userDB *database.UserDB,
-	jwtService *auth.JWTService, userStore *store.UserStore) (*Server, error) {
+	jwtService *auth.JWTService, userStore *store.UserStore, logDecoder *logdecode.Decoder) (*Server, error) {
 	// Initialize database
-	db, err := database.New(cfg.Database)
+	db, err := database.New(cfg.Database, logDecoder)
 	if err != nil {
 		return nil, fmt.Errorf("initializing database: %w", err)
 	}
@@ -50,11 +60,27 @@ func New(cfg *config.Config, tsdb *database.Client, userDB *database.UserDB,
 	logBuffer := buffer.NewLogBuffer(100) // Buffer 100 logs per client
 
 	// Initialize gRPC client
-	grpcClient, err := grpc.NewClient(cfg.GRPC.ServerAddress, logBuffer)
+	grpcClient, err := grpc.NewClient(cfg.GRPC, logBuffer, logDecoder)
 	if err != nil {
 		return nil, fmt.Errorf("initializing gRPC client: %w", err)
 	}
 
+	// Initialize log persistence pipeline
+	logPipeline, err := persist.NewPipeline(db, cfg.LogStreaming)
+	if err != nil {
+		return nil, fmt.Errorf("initializing log pipeline: %w", err)
+	}
+	grpcClient.OnLog(logPipeline.Enqueue)
+
+	// Live logs are published once and fanned out to WebSocket connections
+	logHub, err := hub.NewHub(cfg.LogStreaming)
+	if err != nil {
+		return nil, fmt.Errorf("initializing log hub: %w", err)
+	}
+	grpcClient.OnLog(func(_ context.Context, record types.LogRecord) {
+		logHub.Publish(record)
+	})
+
 	// Initialize Kafka producers/consumers
 	producer := event.NewProducer(
 		cfg.Kafka.Brokers,
@@ -79,21 +105,26 @@ func New(cfg *config.Config, tsdb *database.Client, userDB *database.UserDB,
 	router := gin.Default()
 
 	// Setup WebSocket handler
-	wsHandler := handler.NewWebSocketHandler(db, grpcClient, logBuffer)
+	wsHandler := handler.NewWebSocketHandler(db, grpcClient, logHub, jwtService, cfg.Server.AllowedOrigins)
+	grpcClient.OnLogGap(wsHandler.HandleLogGap)
 
 	// Setup Status handler
 	statusHandler := handler.NewStatusHandler(db, wsHandler, statusConsumer)
 
 	// Setup ML Orchestrator
-	mlOrchestrator := orchestrator.NewMLOrchestrator(grpcClient, producer, commandConsumer)
-
-	if err != nil {
-		return nil, fmt.Errorf("initializing log streaming service: %w", err)
-	}
+	mlOrchestrator := orchestrator.NewMLOrchestrator(db, grpcClient, producer, commandConsumer, statusConsumer, cfg.Orchestrator)
+	// Status lines written by ML processes become lifecycle events
+	grpcClient.OnLog(mlOrchestrator.HandleLog)
 
 	// Setup Query Service
 	queryService := query.NewQueryService(db, statusConsumer)
 
+	// Initialize mailer for password reset emails
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("initializing mailer: %w", err)
+	}
+
 	server := &Server{
 		cfg:             cfg,
 		router:          router,
@@ -103,12 +134,16 @@ func New(cfg *config.Config, tsdb *database.Client, userDB *database.UserDB,
 		jwtService:      jwtService,
 		grpcClient:      grpcClient,
 		logBuffer:       logBuffer,
+		logPipeline:     logPipeline,
+		logHub:          logHub,
 		producer:        producer,
 		commandConsumer: commandConsumer,
 		statusConsumer:  statusConsumer,
 		orchestrator:    mlOrchestrator,
 		statusHandler:   statusHandler,
 		queryService:    queryService,
+		mailer:          mailer,
+		guestCleanup:    cleanup.NewGuestCleanup(userStore, db, cfg.Guests),
 	}
 
 	server.setupRoutes(wsHandler)
@@ -119,39 +154,93 @@ func (s *Server) setupRoutes(wsHandler *handler.WebSocketHandler) {
 	// Create handlers
 	restHandler := handler.NewRESTHandler(s.db, s.grpcClient, s.producer)
 	queryHandler := handler.NewQueryHandler(s.queryService)
+	queueHandler := handler.NewQueueHandler(s.orchestrator)
+	metricsHandler := handler.NewMetricsHandler(s.logPipeline, s.logHub)
+	workerHandler := handler.NewWorkerHandler(s.grpcClient)
+	modelHandler := handler.NewModelHandler(s.db)
+	authHandler := handler.NewAuthHandler(s.userStore, s.jwtService, s.db, s.mailer, s.cfg.Mail.ResetURL)
 
 	// CORS middleware
-	s.router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
+	s.router.Use(handler.CORSMiddleware(s.cfg.Server.AllowedOrigins))
 
-	// WebSocket route
+	// WebSocket routes. Browsers get a ticket to connect with since they
+	// cannot send the token on the upgrade.
 	s.router.GET("/ws", wsHandler.HandleConnection)
+	s.router.POST("/api/ws/ticket", authHandler.AuthMiddleware(), wsHandler.IssueTicket)
 
 	// REST routes
+	requireAuth := authHandler.AuthMiddleware()
 	api := s.router.Group("/api")
 	{
-		// Command routes
-		api.POST("/model/train", restHandler.HandleTrain)
-		api.POST("/model/predict", restHandler.HandlePredict)
-		api.GET("/model/status/:clientId", restHandler.HandleStatus)
+		// Auth routes
+		authRoutes := api.Group("/auth")
+		{
+			authRoutes.POST("/login", authHandler.Login)
+			authRoutes.POST("/guest", authHandler.CreateGuestUser)
+			authRoutes.GET("/me", requireAuth, authHandler.Me)
+			authRoutes.POST("/logout", requireAuth, authHandler.Logout)
+			authRoutes.POST("/register", authHandler.Register)
+			authRoutes.POST("/upgrade", requireAuth, authHandler.UpgradeGuest)
+			authRoutes.POST("/password/forgot", authHandler.ForgotPassword)
+			authRoutes.POST("/password/reset", authHandler.ResetPassword)
+			authRoutes.PUT("/password", requireAuth, authHandler.ChangePassword)
+			authRoutes.PUT("/profile", requireAuth, authHandler.UpdateProfile)
+			authRoutes.DELETE("/account", requireAuth, authHandler.DeleteAccount)
+		}
 
-		// Query routes
-		query := api.Group("/query")
+		// Command routes, run as the authenticated user
+		model := api.Group("/model", requireAuth)
+		{
+			model.POST("/train", restHandler.HandleTrain)
+			model.POST("/predict", restHandler.HandlePredict)
+			model.GET("/status/:clientId", restHandler.HandleStatus)
+			model.POST("/:clientId/cancel", restHandler.HandleCancel)
+		}
+
+		// Query routes, limited to the authenticated user's runs
+		query := api.Group("/query", requireAuth)
 		{
 			query.GET("/model/:clientId", queryHandler.GetModelState)
 			query.GET("/models/running", queryHandler.GetRunningModels)
 			query.GET("/models/history", queryHandler.QueryModelHistory)
+			query.GET("/logs/search", queryHandler.SearchLogs)
 			query.GET("/logs/:clientId/summary", queryHandler.GetLogSummary)
+			query.GET("/metrics/compare", queryHandler.CompareRunMetrics)
+		}
+
+		// Run routes
+		runs := api.Group("/runs", requireAuth)
+		{
+			runs.GET("/:runId", queryHandler.GetRun)
+			runs.GET("/:runId/events", queryHandler.GetRunEvents)
+			runs.GET("/:runId/metrics", queryHandler.GetRunMetrics)
+			runs.GET("/:runId/stream", workerHandler.GetRunLogStream)
+		}
+
+		// Model registry routes, limited to the authenticated user's models
+		models := api.Group("/models", requireAuth)
+		{
+			models.GET("", modelHandler.ListModels)
+			models.GET("/:versionId", modelHandler.GetModel)
+			models.POST("/:versionId/transition", modelHandler.TransitionModel)
+		}
+
+		// Job queue routes
+		queue := api.Group("/queue", requireAuth)
+		{
+			queue.GET("", queueHandler.GetQueue)
+			queue.PUT("/:runId", queueHandler.ReorderJob)
+		}
+
+		// ML worker pool, showing only the authenticated user's runs
+		api.GET("/workers", requireAuth, workerHandler.GetWorkers)
+		api.GET("/workers/streams", requireAuth, workerHandler.GetLogStreams)
+
+		// Metrics routes, covering every user's logs
+		metrics := api.Group("/metrics", requireAuth, authHandler.AdminMiddleware(s.cfg.Server.Admins))
+		{
+			metrics.GET("/log-pipeline", metricsHandler.GetLogPipelineStats)
+			metrics.GET("/log-hub", metricsHandler.GetLogHubStats)
 		}
 	}
 }
@@ -165,6 +254,12 @@ func (s *Server) Run(ctx context.Context) error {
 	// 	return fmt.Errorf("starting log streaming service: %w", err)
 	// }
 
+	// Start persisting streamed logs
+	s.logPipeline.Start(ctx)
+
+	// Populate decoded columns for logs stored before they existed
+	go s.backfillLogFields(ctx)
+
 	// Start the Query Service
 	if err := s.queryService.Start(ctx); err != nil {
 		return fmt.Errorf("starting query service: %w", err)
@@ -176,6 +271,9 @@ func (s *Server) Run(ctx context.Context) error {
 	// Start the status handler
 	s.statusHandler.Start(ctx)
 
+	// Delete stale guest accounts and their data
+	s.guestCleanup.Start(ctx)
+
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: s.router,
@@ -195,6 +293,17 @@ func (s *Server) Run(ctx context.Context) error {
 	return nil
 }
 
+// backfillLogFields fills level, logger and msg for previously stored logs
+func (s *Server) backfillLogFields(ctx context.Context) {
+	updated, err := s.db.BackfillLogFields(ctx, 1000)
+	if err != nil {
+		log.Printf("Log field backfill error: %v", err)
+	}
+	if updated > 0 {
+		log.Printf("Backfilled decoded fields for %d logs", updated)
+	}
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
 	// Stop the Log Streaming Service
 	// if err := s.logStreamService.Stop(); err != nil {
@@ -210,6 +319,9 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	// Stop the status handler
 	s.statusHandler.Stop()
 
+	// Flush queued logs before the database is closed
+	s.logPipeline.Stop()
+
 	// Close the Kafka consumers
 	s.commandConsumer.Stop()
 	s.statusConsumer.Stop()
@@ -219,13 +331,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		log.Printf("Kafka producer shutdown error: %v", err)
 	}
 
-	if err := s.db.Close(); err != nil {
-		log.Printf("Database shutdown error: %v", err)
-		return err
-	}
+	// Close log streams before the database, as they still decode logs
 	if err := s.grpcClient.Close(); err != nil {
 		log.Printf("gRPC client shutdown error: %v", err)
 		return err
 	}
+	if err := s.db.Close(); err != nil {
+		log.Printf("Database shutdown error: %v", err)
+		return err
+	}
 	return nil
 }
@@ -4,9 +4,26 @@ import (
 	"backend/internal/database"
 	"backend/internal/database/models"
 	"context"
+	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when another user has the email address
+var ErrEmailTaken = errors.New("email already registered")
+
+// ErrUserNotFound is returned when updating or deleting a missing user
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrNotGuest is returned when upgrading a user that is not a guest
+var ErrNotGuest = errors.New("user is not a guest")
+
+// ErrInvalidResetToken is returned for password reset tokens that are
+// unknown, expired or already used
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
 type UserStore struct {
 	db *database.UserDB
 }
@@ -29,9 +46,153 @@ func (s *UserStore) Create(ctx context.Context, user *models.User) error {
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
 
+func (s *UserStore) Update(ctx context.Context, user *models.User) error {
+	query := `
+        UPDATE users
+        SET email = $2, password_hash = $3, name = $4, user_type = $5, updated_at = $6
+        WHERE id = $1
+    `
+	user.UpdatedAt = time.Now()
+	result, err := s.db.DB().ExecContext(ctx, query,
+		user.ID,
+		user.Email,
+		user.Password,
+		user.Name,
+		user.Type,
+		user.UpdatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+// UpgradeGuest turns a guest into a regular user with the email, password
+// and name set on user. The ID stays the same, so the guest's runs and logs
+// stay theirs.
+func (s *UserStore) UpgradeGuest(ctx context.Context, user *models.User) error {
+	query := `
+        UPDATE users
+        SET email = $2, password_hash = $3, name = $4, user_type = $5, updated_at = $6
+        WHERE id = $1 AND user_type = $7
+    `
+	user.Type = models.UserTypeRegular
+	user.UpdatedAt = time.Now()
+	result, err := s.db.DB().ExecContext(ctx, query,
+		user.ID,
+		user.Email,
+		user.Password,
+		user.Name,
+		user.Type,
+		user.UpdatedAt,
+		models.UserTypeGuest,
+	)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if err := requireRow(result); err != nil {
+		return ErrNotGuest
+	}
+	return nil
+}
+
+// ListStaleGuests returns up to limit guests created before the given time,
+// oldest first
+func (s *UserStore) ListStaleGuests(ctx context.Context, createdBefore time.Time, limit int) ([]string, error) {
+	query := `
+        SELECT id
+        FROM users
+        WHERE user_type = $1 AND created_at < $2
+        ORDER BY created_at
+        LIMIT $3
+    `
+	rows, err := s.db.DB().QueryContext(ctx, query, models.UserTypeGuest, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete removes a user. Their password reset tokens go with them.
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+	result, err := s.db.DB().ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(result)
+}
+
+// CreatePasswordReset stores the hash of a password reset token
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	query := `
+        INSERT INTO password_resets (token_hash, user_id, expires_at, created_at)
+        VALUES ($1, $2, $3, $4)
+    `
+	_, err := s.db.DB().ExecContext(ctx, query, tokenHash, userID, expiresAt, time.Now())
+	return err
+}
+
+// ConsumePasswordReset marks a password reset token as used and returns its
+// user. A token can be used once, before it expires.
+func (s *UserStore) ConsumePasswordReset(ctx context.Context, tokenHash string) (string, error) {
+	query := `
+        UPDATE password_resets
+        SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `
+	var userID string
+	err := s.db.DB().QueryRowContext(ctx, query, tokenHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidResetToken
+	}
+	return userID, err
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id string) (*models.User, error) {
+	query := `
+        SELECT id, email, password_hash, name, user_type, created_at, updated_at
+        FROM users
+        WHERE id = $1
+    `
+	user := &models.User{}
+	err := s.db.DB().QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.Name,
+		&user.Type,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
         SELECT id, email, password_hash, name, user_type, created_at, updated_at
@@ -49,7 +210,23 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User,
 		&user.UpdatedAt,
 	)
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
+
+func requireRow(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -14,6 +14,23 @@ const (
 	MessageTypeLiveLog     WSMessageType = "live_log"
 	MessageTypeModelStatus WSMessageType = "model_status"
 	MessageTypeHistoryReq  WSMessageType = "history_request"
+	MessageTypeError       WSMessageType = "error"
+
+	// Subscription control messages and their acknowledgement
+	MessageTypeSubscribe         WSMessageType = "subscribe"
+	MessageTypeUnsubscribe       WSMessageType = "unsubscribe"
+	MessageTypeListSubscriptions WSMessageType = "list_subscriptions"
+	MessageTypeAck               WSMessageType = "ack"
+	MessageTypeQueueUpdate       WSMessageType = "queue_update"
+
+	MessageTypeServiceStatus WSMessageType = "service_status"
+	MessageTypeLogGap        WSMessageType = "log_gap"
+	MessageTypeLogsSkipped   WSMessageType = "logs_skipped"
+
+	// Throttled progress updates of running models
+	MessageTypeModelProgress WSMessageType = "model_progress"
+	// Metric points of running models, sent alongside their live logs
+	MessageTypeLiveMetric WSMessageType = "live_metric"
 )
 
 // WSMessage represents a WebSocket message
@@ -23,12 +40,44 @@ type WSMessage struct {
 	RequestID string        `json:"request_id,omitempty"`
 }
 
-// LogRecord represents a log entry
+// LogRecord represents a log entry. Timestamp is in Unix nanoseconds and Seq
+// orders records of a run that share a timestamp.
 type LogRecord struct {
-	Timestamp int64  `json:"timestamp"`
-	ClientID  string `json:"client_id"`
-	Message   []byte `json:"message"`
-	ProcessID string `json:"process_id,omitempty"`
+	Timestamp int64       `json:"timestamp"`
+	Seq       int64       `json:"seq"`
+	ClientID  string      `json:"client_id"`
+	RunID     string      `json:"run_id,omitempty"`
+	Message   []byte      `json:"message"`
+	ProcessID string      `json:"process_id,omitempty"`
+	Decoded   *DecodedLog `json:"decoded,omitempty"`
+}
+
+// LogCursor is a position in a client's log, used for stable pagination
+type LogCursor struct {
+	Timestamp int64 `json:"timestamp"`
+	Seq       int64 `json:"seq"`
+}
+
+// LogPage is a page of logs and the cursor of the following page
+type LogPage struct {
+	Logs       []LogRecord `json:"logs"`
+	NextCursor *LogCursor  `json:"next_cursor,omitempty"`
+}
+
+// DecodedLog is the structured form of a log frame produced by the Python
+// log sink once it has been decompressed and unpacked
+type DecodedLog struct {
+	Time     time.Time              `json:"time"`
+	Level    string                 `json:"level"`
+	Logger   string                 `json:"logger,omitempty"`
+	Msg      string                 `json:"msg"`
+	Module   string                 `json:"module,omitempty"`
+	FuncName string                 `json:"func_name,omitempty"`
+	Pathname string                 `json:"pathname,omitempty"`
+	Line     int                    `json:"line,omitempty"`
+	Thread   string                 `json:"thread,omitempty"`
+	Process  int                    `json:"process,omitempty"`
+	Extra    map[string]interface{} `json:"extra,omitempty"`
 }
 
 // WSConnection represents a WebSocket connection
@@ -36,6 +85,11 @@ type WSConnection struct {
 	Conn     *websocket.Conn
 	ClientID string
 	Mu       sync.Mutex
+
+	// The authenticated user and the token the connection was opened with
+	UserID    string
+	TokenID   string
+	ExpiresAt time.Time
 }
 
 func (c *WSConnection) WriteBinaryMessage(v []byte) error {
@@ -62,20 +116,150 @@ func (c *WSConnection) WriteJSON(v interface{}) error {
 // ModelStatus represents the current status of a model
 type ModelStatus struct {
 	ClientID    string    `json:"client_id"`
+	RunID       string    `json:"run_id"`
 	Status      string    `json:"status"`
 	Message     string    `json:"message,omitempty"`
 	Timestamp   time.Time `json:"timestamp"`
 	ProcessType string    `json:"process_type"`
+
+	// QueuePosition is the 1-based place of a queued run in its queue
+	QueuePosition int `json:"queue_position,omitempty"`
+
+	// Progress of a running run, when it reports any
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Progress is how far a run has got. Steps count within the current
+// epoch. The rate is in percent per second, from which the ETA is
+// estimated.
+type Progress struct {
+	Phase       string    `json:"phase,omitempty"`
+	Epoch       int       `json:"epoch,omitempty"`
+	TotalEpochs int       `json:"total_epochs,omitempty"`
+	Step        int       `json:"step,omitempty"`
+	TotalSteps  int       `json:"total_steps,omitempty"`
+	Percent     float64   `json:"percent"`
+	Rate        float64   `json:"rate,omitempty"`
+	ETASeconds  *float64  `json:"eta_seconds,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MetricPoint is a value of a training metric, such as loss or accuracy,
+// reported by a run at a step
+type MetricPoint struct {
+	RunID    string    `json:"run_id"`
+	ClientID string    `json:"client_id"`
+	Name     string    `json:"name"`
+	Step     int64     `json:"step"`
+	Time     time.Time `json:"time"`
+	Value    float64   `json:"value"`
+}
+
+// Run statuses
+const (
+	StatusPending   = "pending"
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusError     = "error"
+	StatusCancelled = "cancelled"
+)
+
+// IsTerminalStatus reports whether a run in this status has finished
+func IsTerminalStatus(status string) bool {
+	return status == StatusCompleted || status == StatusError || status == StatusCancelled
+}
+
+// ModelRun is the persisted state of a single train or predict run
+type ModelRun struct {
+	RunID       string                 `json:"run_id"`
+	ClientID    string                 `json:"client_id"`
+	ProcessType string                 `json:"process_type"`
+	Status      string                 `json:"status"`
+	Message     string                 `json:"message,omitempty"`
+	Config      interface{}            `json:"config,omitempty"`
+	ProcessID   int                    `json:"process_id,omitempty"`
+	ExitReason  string                 `json:"exit_reason,omitempty"`
+	Metrics     map[string]interface{} `json:"metrics,omitempty"`
+	Progress    *Progress              `json:"progress,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	StartedAt   *time.Time             `json:"started_at,omitempty"`
+	EndedAt     *time.Time             `json:"ended_at,omitempty"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// RunEvent is a recorded lifecycle transition of a run
+type RunEvent struct {
+	EventID   string    `json:"event_id"`
+	RunID     string    `json:"run_id"`
+	EventType string    `json:"event_type"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	Progress  int       `json:"progress,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // ModelRequest represents a request to train or run inference
 type ModelRequest struct {
 	Type          string      `json:"type"`
 	ClientID      string      `json:"client_id"`
+	RunID         string      `json:"run_id,omitempty"`
 	Data          []float64   `json:"data,omitempty"`
 	StartDate     string      `json:"start_date,omitempty"`
 	EndDate       string      `json:"end_date,omitempty"`
 	Configuration interface{} `json:"config,omitempty"`
+
+	// Model names the registered model a prediction uses, as a version ID
+	// or an alias such as forecaster@production. It is resolved to the
+	// version and its artifact before the request is queued.
+	Model          string `json:"model,omitempty"`
+	ModelVersionID string `json:"model_version_id,omitempty"`
+	Artifact       string `json:"artifact,omitempty"`
+}
+
+// Stages of registered model versions. A model has at most one version in
+// staging and one in production.
+const (
+	StageNone       = "none"
+	StageStaging    = "staging"
+	StageProduction = "production"
+	StageArchived   = "archived"
+)
+
+// IsModelStage reports whether stage is a stage model versions can be in
+func IsModelStage(stage string) bool {
+	switch stage {
+	case StageNone, StageStaging, StageProduction, StageArchived:
+		return true
+	}
+	return false
+}
+
+// ModelVersion is a trained model registered from a successful training run
+type ModelVersion struct {
+	ID        string                 `json:"id"`
+	ClientID  string                 `json:"client_id"`
+	Name      string                 `json:"name"`
+	Version   int                    `json:"version"`
+	RunID     string                 `json:"run_id"`
+	Stage     string                 `json:"stage"`
+	Config    interface{}            `json:"config,omitempty"`
+	Metrics   map[string]interface{} `json:"metrics,omitempty"`
+	Artifact  string                 `json:"artifact,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// ModelVersionEvent is a recorded registration or stage transition of a
+// model version
+type ModelVersionEvent struct {
+	ID        int64     `json:"id"`
+	VersionID string    `json:"version_id"`
+	FromStage string    `json:"from_stage,omitempty"`
+	ToStage   string    `json:"to_stage"`
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // ModelConfig represents model configuration options
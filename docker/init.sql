@@ -3,11 +3,18 @@ CREATE TABLE
 IF NOT EXISTS logs
 (
     timestamp TIMESTAMPTZ NOT NULL,
+    timestamp_ns BIGINT NOT NULL,
+    seq BIGINT NOT NULL DEFAULT 0,
     client_id TEXT NOT NULL,
+    run_id TEXT NOT NULL DEFAULT '',
     message BYTEA NOT NULL,
     process_id INTEGER,
+    level TEXT,
+    logger TEXT,
+    msg TEXT,
+    fields JSONB,
     PRIMARY KEY
-(timestamp, client_id)
+(timestamp, client_id, run_id, seq)
 );
 
 -- Create the TimescaleDB hypertable
@@ -19,5 +26,97 @@ CREATE INDEX
 IF NOT EXISTS idx_logs_client_id ON logs
 (client_id);
 
+-- Index for per-level summaries
+CREATE INDEX
+IF NOT EXISTS idx_logs_client_level ON logs
+(client_id, level, timestamp DESC);
+
+-- Index for ordered history replays
+CREATE INDEX
+IF NOT EXISTS idx_logs_client_order ON logs
+(client_id, timestamp_ns, seq);
+
+-- Index for per-run history replays
+CREATE INDEX
+IF NOT EXISTS idx_logs_run_order ON logs
+(run_id, timestamp_ns, seq);
+
+-- Indexes for log search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX
+IF NOT EXISTS idx_logs_msg_fts ON logs USING GIN
+(to_tsvector
+('english', COALESCE
+(msg, '')));
+CREATE INDEX
+IF NOT EXISTS idx_logs_msg_trgm ON logs USING GIN
+(msg gin_trgm_ops);
+CREATE INDEX
+IF NOT EXISTS idx_logs_fields ON logs USING GIN
+(fields jsonb_path_ops);
+
+-- Run history: current state of every run and its lifecycle transitions
+CREATE TABLE
+IF NOT EXISTS model_runs
+(
+    run_id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    process_type TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    message TEXT,
+    config JSONB,
+    process_id INTEGER,
+    exit_reason TEXT,
+    metrics JSONB,
+    created_at TIMESTAMPTZ NOT NULL,
+    started_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX
+IF NOT EXISTS idx_model_runs_client ON model_runs
+(client_id, created_at DESC);
+CREATE INDEX
+IF NOT EXISTS idx_model_runs_created ON model_runs
+(created_at DESC);
+
+CREATE TABLE
+IF NOT EXISTS model_run_events
+(
+    id BIGSERIAL PRIMARY KEY,
+    event_id TEXT NOT NULL UNIQUE,
+    run_id TEXT NOT NULL REFERENCES model_runs
+(run_id) ON DELETE CASCADE,
+    event_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    message TEXT,
+    progress INTEGER,
+    timestamp TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX
+IF NOT EXISTS idx_model_run_events_run ON model_run_events
+(run_id, timestamp);
+
+-- Orchestrator job queue
+CREATE TABLE
+IF NOT EXISTS job_queue
+(
+    run_id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    process_type TEXT NOT NULL,
+    priority INTEGER NOT NULL,
+    position BIGSERIAL,
+    payload BYTEA NOT NULL,
+    state TEXT NOT NULL DEFAULT 'queued',
+    enqueued_at TIMESTAMPTZ NOT NULL,
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX
+IF NOT EXISTS idx_job_queue_order ON job_queue
+(state, priority, position);
+
 -- Grant permissions
-GRANT ALL PRIVILEGES ON TABLE logs TO postgres;
\ No newline at end of file
+GRANT ALL PRIVILEGES ON TABLE logs, model_runs, model_run_events, job_queue TO postgres;
\ No newline at end of file
@@ -1,14 +1,20 @@
 from abc import ABC, abstractmethod
 import json
 from datetime import datetime
-from typing import Dict, Any
+from typing import Dict, Any, Optional
 from loguru import logger
 from udp_json_socket_handler import LoguruTCPSink
 
 
+class ProcessCancelled(BaseException):
+    """Raised in a process when it is asked to stop. It derives from
+    BaseException so generic exception handlers don't swallow it."""
+
+
 class BaseProcess(ABC):
-    def __init__(self, client_id: str, config: Dict[str, Any]):
+    def __init__(self, client_id: str, config: Dict[str, Any], run_id: str = ""):
         self.client_id = client_id
+        self.run_id = run_id or config.get("run_id", "")
         self.config = config
         self.log_sink = None
         self.logger = None
@@ -26,24 +32,77 @@ class BaseProcess(ABC):
                 {"sink": self.log_sink, "level": "DEBUG"},
             ],
             extra={
-                "client_id": self.client_id
-            },  # Use the actual client_id from the instance
+                "client_id": self.client_id,
+                "run_id": self.run_id,
+            },  # Use the actual client_id and run_id from the instance
         )
 
         # Create a bound logger with the client_id
         self.logger = logger
 
-    def log_status(self, status: str, message: str = "", process_type: str = ""):
+    def log_status(
+        self,
+        status: str,
+        message: str = "",
+        process_type: str = "",
+        artifact: str = "",
+    ):
         status_msg = {
             "status": status,
             "message": message,
             "timestamp": datetime.now().isoformat(),
             "process_type": process_type,
             "client_id": self.client_id,
+            "run_id": self.run_id,
         }
+        # Completed training names where the model was saved, so the
+        # registered model version can be predicted with later
+        if artifact:
+            status_msg["artifact"] = artifact
         # With Loguru, we can log the dict directly or as JSON
         self.logger.info(json.dumps(status_msg))
 
+    def log_progress(
+        self,
+        step: int = 0,
+        total_steps: int = 0,
+        epoch: int = 0,
+        total_epochs: int = 0,
+        phase: str = "",
+        percent: Optional[float] = None,
+        message: str = "",
+        process_type: str = "",
+    ):
+        """Report how far the process has got. Steps count within the
+        current epoch and epochs from 1. Without a percent the backend works
+        it out from the steps and epochs, and estimates the time left."""
+        progress_msg = {
+            "status": "progress",
+            "message": message,
+            "timestamp": datetime.now().isoformat(),
+            "process_type": process_type,
+            "client_id": self.client_id,
+            "run_id": self.run_id,
+            "phase": phase,
+            "step": step,
+            "total_steps": total_steps,
+            "epoch": epoch,
+            "total_epochs": total_epochs,
+        }
+        if percent is not None:
+            progress_msg["percent"] = percent
+        self.logger.info(json.dumps(progress_msg))
+
+    def log_metrics(self, metrics: Dict[str, float], step: int = 0):
+        """Report training metrics such as loss or accuracy measured at a
+        step. The backend stores them as time series for charts."""
+        fields = {f"metric.{name}": float(value) for name, value in metrics.items()}
+        self.logger.bind(metric_step=step, **fields).info(
+            "Metrics at step {}: {}",
+            step,
+            ", ".join(f"{name}={value:.4g}" for name, value in metrics.items()),
+        )
+
     @abstractmethod
     def execute(self) -> None:
         pass
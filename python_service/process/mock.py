@@ -18,7 +18,26 @@ class MockTrainProcess(BaseProcess):
             time.sleep(1)
 
             self.logger.info("Training mock model...")
-            time.sleep(2)
+            epochs, steps = 2, 4
+            for epoch in range(1, epochs + 1):
+                for step in range(1, steps + 1):
+                    time.sleep(0.25)
+                    self.log_progress(
+                        step=step,
+                        total_steps=steps,
+                        epoch=epoch,
+                        total_epochs=epochs,
+                        phase="training",
+                        process_type="train",
+                    )
+                    done = (epoch - 1) * steps + step
+                    self.log_metrics(
+                        {
+                            "loss": 1.0 / done + np.random.uniform(0, 0.05),
+                            "accuracy": 1 - 0.5 / done,
+                        },
+                        step=done,
+                    )
 
             # Save mock model info
             # mock_model = {"trained": True, "timestamp": pd.Timestamp.now().isoformat()}
@@ -11,8 +11,10 @@ class PredictProcess(BaseProcess):
         try:
             self.log_status("started", "Starting prediction", "predict")
 
-            # Load model
-            model_path = f"models/{self.client_id}_model.joblib"
+            # Load the registered model version given, or the client's model
+            model_path = self.config.get("artifact") or (
+                f"models/{self.client_id}_model.joblib"
+            )
             model = joblib.load(model_path)
 
             # Prepare data
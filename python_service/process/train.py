@@ -26,14 +26,18 @@ class TrainProcess(BaseProcess):
             # Train model
             model = self._train_model(X, y)
 
-            # Save model
-            model_path = f"models/{self.client_id}_model.joblib"
+            # Save model. Each run keeps its own file for the registered
+            # version; the client's last model is also kept for predictions
+            # that use no registered version.
+            model_path = f"models/{self.client_id}_{self.run_id}_model.joblib"
             joblib.dump(model, model_path)
+            joblib.dump(model, f"models/{self.client_id}_model.joblib")
 
             self.log_status(
                 "completed",
                 f"Model trained successfully. Saved to {model_path}",
                 "train",
+                artifact=model_path,
             )
 
         except Exception as e:
@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\rprocess.proto\x12\x07process\"9\n\x13StartProcessRequest\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x0f\n\x07payload\x18\x02 \x01(\t\"H\n\x0fProcessResponse\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x12\n\nprocess_id\x18\x02 \x01(\x05\x12\x0e\n\x06status\x18\x03 \x01(\t\"\x1f\n\nLogRequest\x12\x11\n\tclient_id\x18\x01 \x01(\t\"W\n\nLogMessage\x12\x11\n\ttimestamp\x18\x01 \x01(\x03\x12\x11\n\tclient_id\x18\x02 \x01(\t\x12\x0f\n\x07message\x18\x03 \x01(\x0c\x12\x12\n\nprocess_id\x18\x04 \x01(\t2\x96\x01\n\x0eProcessService\x12H\n\x0cStartProcess\x12\x1c.process.StartProcessRequest\x1a\x18.process.ProcessResponse\"\x00\x12:\n\nStreamLogs\x12\x13.process.LogRequest\x1a\x13.process.LogMessage\"\x00\x30\x01\x42\x0bZ\t./processb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\rprocess.proto\x12\x07process\"I\n\x13StartProcessRequest\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x0f\n\x07payload\x18\x02 \x01(\t\x12\x0e\n\x06run_id\x18\x03 \x01(\t\"X\n\x0fProcessResponse\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x12\n\nprocess_id\x18\x02 \x01(\x05\x12\x0e\n\x06status\x18\x03 \x01(\t\x12\x0e\n\x06run_id\x18\x04 \x01(\t\"P\n\x12StopProcessRequest\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x0e\n\x06run_id\x18\x02 \x01(\t\x12\x17\n\x0fgrace_period_ms\x18\x03 \x01(\x05\"5\n\x13StopProcessResponse\x12\x0e\n\x06run_id\x18\x01 \x01(\t\x12\x0e\n\x06status\x18\x02 \x01(\t\"\x16\n\x14ListProcessesRequest\"D\n\x0bProcessInfo\x12\x0e\n\x06run_id\x18\x01 \x01(\t\x12\x11\n\tclient_id\x18\x02 \x01(\t\x12\x12\n\nprocess_id\x18\x03 \x01(\x05\"@\n\x15ListProcessesResponse\x12\'\n\tprocesses\x18\x01 \x03(\x0b\x32\x14.process.ProcessInfo\"\xa9\x01\n\nLogRequest\x12\x11\n\tclient_id\x18\x01 \x01(\t\x12\x0f\n\x07run_ids\x18\x02 \x03(\t\x12\x38\n\x0bresume_from\x18\x03 \x03(\x0b\x32#.process.LogRequest.ResumeFromEntry\x1a=\n\x0fResumeFromEntry\x12\x10\n\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n\x05value\x18\x02 \x01(\x03R\x05value:\x02\x38\x01\"t\n\nLogMessage\x12\x11\n\ttimestamp\x18\x01 \x01(\x03\x12\x11\n\tclient_id\x18\x02 \x01(\t\x12\x0f\n\x07message\x18\x03 \x01(\x0c\x12\x12\n\nprocess_id\x18\x04 \x01(\t\x12\x0b\n\x03seq\x18\x05 \x01(\x03\x12\x0e\n\x06run_id\x18\x06 \x01(\t2\xb4\x02\n\x0eProcessService\x12H\n\x0cStartProcess\x12\x1c.process.StartProcessRequest\x1a\x18.process.ProcessResponse\"\x00\x12:\n\nStreamLogs\x12\x13.process.LogRequest\x1a\x13.process.LogMessage\"\x00\x30\x01\x12J\n\x0bStopProcess\x12\x1b.process.StopProcessRequest\x1a\x1c.process.StopProcessResponse\"\x00\x12P\n\rListProcesses\x12\x1d.process.ListProcessesRequest\x1a\x1e.process.ListProcessesResponse\"\x00\x42\x0bZ\t./processb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -33,13 +33,23 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['DESCRIPTOR']._loaded_options = None
   _globals['DESCRIPTOR']._serialized_options = b'Z\t./process'
   _globals['_STARTPROCESSREQUEST']._serialized_start=26
-  _globals['_STARTPROCESSREQUEST']._serialized_end=83
-  _globals['_PROCESSRESPONSE']._serialized_start=85
-  _globals['_PROCESSRESPONSE']._serialized_end=157
-  _globals['_LOGREQUEST']._serialized_start=159
-  _globals['_LOGREQUEST']._serialized_end=190
-  _globals['_LOGMESSAGE']._serialized_start=192
-  _globals['_LOGMESSAGE']._serialized_end=279
-  _globals['_PROCESSSERVICE']._serialized_start=282
-  _globals['_PROCESSSERVICE']._serialized_end=432
+  _globals['_STARTPROCESSREQUEST']._serialized_end=99
+  _globals['_PROCESSRESPONSE']._serialized_start=101
+  _globals['_PROCESSRESPONSE']._serialized_end=189
+  _globals['_STOPPROCESSREQUEST']._serialized_start=191
+  _globals['_STOPPROCESSREQUEST']._serialized_end=271
+  _globals['_STOPPROCESSRESPONSE']._serialized_start=273
+  _globals['_STOPPROCESSRESPONSE']._serialized_end=326
+  _globals['_LISTPROCESSESREQUEST']._serialized_start=328
+  _globals['_LISTPROCESSESREQUEST']._serialized_end=350
+  _globals['_PROCESSINFO']._serialized_start=352
+  _globals['_PROCESSINFO']._serialized_end=420
+  _globals['_LISTPROCESSESRESPONSE']._serialized_start=422
+  _globals['_LISTPROCESSESRESPONSE']._serialized_end=486
+  _globals['_LOGREQUEST']._serialized_start=489
+  _globals['_LOGREQUEST']._serialized_end=658
+  _globals['_LOGMESSAGE']._serialized_start=660
+  _globals['_LOGMESSAGE']._serialized_end=776
+  _globals['_PROCESSSERVICE']._serialized_start=779
+  _globals['_PROCESSSERVICE']._serialized_end=1087
 # @@protoc_insertion_point(module_scope)
@@ -49,6 +49,18 @@ class ProcessServiceStub(object):
             response_deserializer=process__pb2.LogMessage.FromString,
             _registered_method=True,
         )
+        self.StopProcess = channel.unary_unary(
+            "/process.ProcessService/StopProcess",
+            request_serializer=process__pb2.StopProcessRequest.SerializeToString,
+            response_deserializer=process__pb2.StopProcessResponse.FromString,
+            _registered_method=True,
+        )
+        self.ListProcesses = channel.unary_unary(
+            "/process.ProcessService/ListProcesses",
+            request_serializer=process__pb2.ListProcessesRequest.SerializeToString,
+            response_deserializer=process__pb2.ListProcessesResponse.FromString,
+            _registered_method=True,
+        )
 
 
 class ProcessServiceServicer(object):
@@ -66,6 +78,18 @@ class ProcessServiceServicer(object):
         context.set_details("Method not implemented!")
         raise NotImplementedError("Method not implemented!")
 
+    def StopProcess(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details("Method not implemented!")
+        raise NotImplementedError("Method not implemented!")
+
+    def ListProcesses(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details("Method not implemented!")
+        raise NotImplementedError("Method not implemented!")
+
 
 def add_ProcessServiceServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -79,6 +103,16 @@ def add_ProcessServiceServicer_to_server(servicer, server):
             request_deserializer=process__pb2.LogRequest.FromString,
             response_serializer=process__pb2.LogMessage.SerializeToString,
         ),
+        "StopProcess": grpc.unary_unary_rpc_method_handler(
+            servicer.StopProcess,
+            request_deserializer=process__pb2.StopProcessRequest.FromString,
+            response_serializer=process__pb2.StopProcessResponse.SerializeToString,
+        ),
+        "ListProcesses": grpc.unary_unary_rpc_method_handler(
+            servicer.ListProcesses,
+            request_deserializer=process__pb2.ListProcessesRequest.FromString,
+            response_serializer=process__pb2.ListProcessesResponse.SerializeToString,
+        ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
         "process.ProcessService", rpc_method_handlers
@@ -150,3 +184,63 @@ class ProcessService(object):
             metadata,
             _registered_method=True,
         )
+
+    @staticmethod
+    def StopProcess(
+        request,
+        target,
+        options=(),
+        channel_credentials=None,
+        call_credentials=None,
+        insecure=False,
+        compression=None,
+        wait_for_ready=None,
+        timeout=None,
+        metadata=None,
+    ):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            "/process.ProcessService/StopProcess",
+            process__pb2.StopProcessRequest.SerializeToString,
+            process__pb2.StopProcessResponse.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True,
+        )
+
+    @staticmethod
+    def ListProcesses(
+        request,
+        target,
+        options=(),
+        channel_credentials=None,
+        call_credentials=None,
+        insecure=False,
+        compression=None,
+        wait_for_ready=None,
+        timeout=None,
+        metadata=None,
+    ):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            "/process.ProcessService/ListProcesses",
+            process__pb2.ListProcessesRequest.SerializeToString,
+            process__pb2.ListProcessesResponse.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True,
+        )
@@ -3,8 +3,10 @@ from typing import AsyncIterator
 import grpc
 import logging
 import asyncio
+import uuid
 import proto.process_pb2 as pb2
 import proto.process_pb2_grpc as pb2_grpc
+from grpc_health.v1 import health, health_pb2, health_pb2_grpc
 
 from service.process_manager import ProcessManager
 from service.udp_server import TCPLogServer
@@ -34,14 +36,24 @@ class ProcessService(pb2_grpc.ProcessServiceServicer):
                 ):
                     raise ValueError("train_start_date and train_end_date are required")
 
+            # Older backends don't send a run ID, so mint one
+            run_id = request.run_id or config.get("run_id") or str(uuid.uuid4())
+
             # Offload the blocking call to the executor
             loop = asyncio.get_running_loop()
             process = await loop.run_in_executor(
-                None, self.process_manager.start_process, config["client_id"], config
+                None,
+                self.process_manager.start_process,
+                config["client_id"],
+                run_id,
+                config,
             )
 
             return pb2.ProcessResponse(
-                client_id=config["client_id"], process_id=process.pid, status="started"
+                client_id=config["client_id"],
+                run_id=run_id,
+                process_id=process.pid,
+                status="started",
             )
         except Exception as e:
             logger.error(f"Process start failed: {str(e)}")
@@ -49,32 +61,59 @@ class ProcessService(pb2_grpc.ProcessServiceServicer):
             context.set_details(str(e))
             return pb2.ProcessResponse()
 
+    async def StopProcess(self, request, context):
+        try:
+            logger.info(f"Stopping run {request.run_id}")
+            grace_period = (request.grace_period_ms or 5000) / 1000
+
+            # Offload the blocking wait to the executor
+            loop = asyncio.get_running_loop()
+            status = await loop.run_in_executor(
+                None, self.process_manager.stop_process, request.run_id, grace_period
+            )
+
+            return pb2.StopProcessResponse(run_id=request.run_id, status=status)
+        except Exception as e:
+            logger.error(f"Process stop failed: {str(e)}")
+            context.set_code(grpc.StatusCode.INTERNAL)
+            context.set_details(str(e))
+            return pb2.StopProcessResponse()
+
+    async def ListProcesses(self, request, context):
+        processes = [
+            pb2.ProcessInfo(run_id=run_id, client_id=client_id, process_id=pid)
+            for run_id, client_id, pid in self.process_manager.list_processes()
+        ]
+        return pb2.ListProcessesResponse(processes=processes)
+
     async def StreamLogs(self, request, context) -> AsyncIterator[pb2.LogMessage]:
-        # loop = asyncio.get_running_loop()
+        # Each stream gets its own copy of the logs matching its filter, so
+        # several backends or subscriptions don't take logs from each other,
+        # and a stream that reconnects gets the logs it missed replayed
+        subscription = self.udp_server.subscribe(
+            request.client_id, request.run_ids, dict(request.resume_from)
+        )
+        logger.info(
+            f"Log stream opened for client={request.client_id or '*'} "
+            f"runs={list(request.run_ids) or '*'} "
+            f"resuming={len(request.resume_from)} runs"
+        )
         try:
             while not context.cancelled():
                 try:
-                    # Use wait_for to timeout the blocking call, allowing cancellation checks
-                    try:
-                        # log = await asyncio.wait_for(
-                        #     loop.run_in_executor(None, self.udp_server.get_log, 0.1),
-                        #     timeout=0.2,
-                        # )
-                        log = self.udp_server.get_log()
-                        # print(log)
-                    except asyncio.TimeoutError:
-                        log = None
-
-                    if log:
-                        yield pb2.LogMessage(**log)
-                    else:
-                        await asyncio.sleep(0.1)
-                except Exception as e:
-                    logger.error(f"StreamLogs error: {e}")
-                    context.abort(grpc.StatusCode.INTERNAL, str(e))
+                    log = await asyncio.wait_for(subscription.queue.get(), timeout=1.0)
+                except asyncio.TimeoutError:
+                    continue
+                yield pb2.LogMessage(**log)
         except asyncio.CancelledError:
-            logger.error("StreamLogs cancelled.", stack_info=True)
+            logger.info("StreamLogs cancelled.")
             raise
+        finally:
+            self.udp_server.unsubscribe(subscription)
+            if subscription.dropped:
+                logger.warning(
+                    f"Log stream dropped {subscription.dropped} logs while behind"
+                )
 
 
 class GRPCServer:
@@ -83,6 +122,7 @@ class GRPCServer:
         self.process_manager = process_manager
         self.udp_server = udp_server
         self.server = None  # We'll create it in start()
+        self.health = health.aio.HealthServicer()
 
     async def start(self):
         # Now that we're in the running event loop, create the server
@@ -90,10 +130,16 @@ class GRPCServer:
         pb2_grpc.add_ProcessServiceServicer_to_server(
             ProcessService(self.process_manager, self.udp_server), self.server
         )
+        # Standard health protocol, used by the backend to balance workers
+        health_pb2_grpc.add_HealthServicer_to_server(self.health, self.server)
         self.server.add_insecure_port(self.address)
         await self.server.start()
+        for service in ("", "process.ProcessService"):
+            await self.health.set(service, health_pb2.HealthCheckResponse.SERVING)
         logger.info(f"gRPC server started on {self.address}")
         # Now the server is attached to the correct event loop
 
     async def stop(self):
+        # Tell the backend to stop routing runs here before shutting down
+        await self.health.enter_graceful_shutdown()
         await self.server.stop(0)
@@ -1,14 +1,27 @@
 import multiprocessing
-from typing import Dict, Any
+import signal
+from typing import Dict, Any, List, Tuple
+from process.base import ProcessCancelled
 from process.mock import MockPredictProcess
 
 
-def run_process(client_id: str, config: Dict[str, Any]):
+def _raise_cancelled(signum, frame):
+    raise ProcessCancelled()
+
+
+def run_process(client_id: str, run_id: str, config: Dict[str, Any]):
+    # SIGTERM asks the process to stop; it gets a grace period before SIGKILL
+    signal.signal(signal.SIGTERM, _raise_cancelled)
+    process = None
     try:
         # process_type = config.get("type", "train")
-        process = MockPredictProcess(client_id, config)
+        process = MockPredictProcess(client_id, config, run_id)
         process.execute()
 
+    except ProcessCancelled:
+        if process:
+            process.log_status("cancelled", "Process cancelled", config.get("type", ""))
+            process.cleanup()
     except Exception as e:
         print(f"Process failed: {e}")
     # finally:
@@ -18,26 +31,56 @@ def run_process(client_id: str, config: Dict[str, Any]):
 
 class ProcessManager:
     def __init__(self):
+        # Processes are keyed by run so a client can have several at once
         self.processes: Dict[str, multiprocessing.Process] = {}
+        self.clients: Dict[str, str] = {}
 
     def start_process(
-        self, client_id: str, config: Dict[str, Any]
+        self, client_id: str, run_id: str, config: Dict[str, Any]
     ) -> multiprocessing.Process:
-        process = multiprocessing.Process(target=run_process, args=(client_id, config))
+        # A retried start of a run that is already running returns it
+        # instead of starting a second process
+        existing = self.processes.get(run_id)
+        if existing and existing.is_alive():
+            return existing
+
+        process = multiprocessing.Process(
+            target=run_process, args=(client_id, run_id, config)
+        )
         process.daemon = True
         process.start()
 
-        self.processes[client_id] = process
+        self.processes[run_id] = process
+        self.clients[run_id] = client_id
         return process
 
-    def stop_process(self, client_id: str) -> bool:
-        process = self.processes.get(client_id)
-        if process and process.is_alive():
-            process.terminate()
-            process.join(timeout=0.5)
-            del self.processes[client_id]
-            return True
-        return False
+    def list_processes(self) -> List[Tuple[str, str, int]]:
+        """Return (run_id, client_id, pid) of the processes still running,
+        forgetting those that exited."""
+        running = []
+        for run_id, process in list(self.processes.items()):
+            if process.is_alive():
+                running.append((run_id, self.clients.get(run_id, ""), process.pid))
+            else:
+                self.processes.pop(run_id, None)
+                self.clients.pop(run_id, None)
+        return running
+
+    def stop_process(self, run_id: str, grace_period: float = 0.5) -> str:
+        """Stop a run with SIGTERM, escalating to SIGKILL after the grace
+        period. Returns terminated, killed or not_found."""
+        process = self.processes.pop(run_id, None)
+        self.clients.pop(run_id, None)
+        if not process or not process.is_alive():
+            return "not_found"
+
+        process.terminate()
+        process.join(timeout=grace_period)
+        if process.is_alive():
+            process.kill()
+            process.join()
+            return "killed"
+        return "terminated"
 
     def cleanup(self):
         for process in self.processes.values():
@@ -4,14 +4,46 @@ import socket
 import struct
 import threading
 import queue
+from collections import OrderedDict, deque
 from datetime import datetime
 from time import sleep
 import time
-from typing import Any, Dict, List, Optional
+from typing import Any, Deque, Dict, Iterable, List, Mapping, Optional
 import asyncio
 import uuid
 
+import msgpack
+import zstandard as zstd
+
 UUID_LENGTH = 16  # Standard UUID string length
+SUBSCRIBER_QUEUE_SIZE = 10000  # Logs buffered per stream before dropping
+HISTORY_SIZE = 1000  # Recent logs kept per run for streams that reconnect
+HISTORY_RUNS = 256  # Runs whose recent logs are kept
+
+
+class LogSubscription:
+    """Logs matching a stream's filter, buffered for that stream only. An
+    empty filter receives every log."""
+
+    def __init__(self, client_id: str = "", run_ids: Iterable[str] = ()):
+        self.client_id = client_id
+        self.run_ids = set(run_ids)
+        self.queue: asyncio.Queue = asyncio.Queue(maxsize=SUBSCRIBER_QUEUE_SIZE)
+        self.dropped = 0
+
+    def matches(self, log_data: Dict[str, Any]) -> bool:
+        if self.client_id and log_data["client_id"] != self.client_id:
+            return False
+        if self.run_ids and log_data["run_id"] not in self.run_ids:
+            return False
+        return True
+
+    def offer(self, log_data: Dict[str, Any]):
+        """Queue a log, dropping the oldest one if the stream fell behind."""
+        if self.queue.full():
+            self.queue.get_nowait()
+            self.dropped += 1
+        self.queue.put_nowait(log_data)
 
 
 class TCPLogServer:
@@ -21,10 +53,14 @@ class TCPLogServer:
         self.host = host
         self.port = port
         self.max_connections = max_connections
-        self.log_queue = asyncio.Queue()  # Use asyncio's Queue for async operations
+        self.subscriptions: List[LogSubscription] = []  # One per log stream
         self.running = False
         self.server_socket = None
         self.clients = []
+        self.sequences: Dict[str, int] = {}  # Last sequence number per run
+        # Recent logs per run, least recently logged run first
+        self.history: "OrderedDict[str, Deque[Dict[str, Any]]]" = OrderedDict()
+        self.decompressor = zstd.ZstdDecompressor()
 
     async def start(self) -> bool:
         """Start the server with graceful error handling."""
@@ -88,15 +124,25 @@ class TCPLogServer:
                 print("Client ID:", client_id)
                 print("Compressed Data:", compressed_data)
 
+                run_id = self._frame_run_id(compressed_data)
+
+                # Number messages per run so lines logged in the same
+                # instant keep their order
+                seq_key = run_id or client_id
+                seq = self.sequences.get(seq_key, 0) + 1
+                self.sequences[seq_key] = seq
+
                 # Queue the complete message
                 log_data = {
-                    "timestamp": int(datetime.now().timestamp()),
+                    "timestamp": time.time_ns(),
                     "client_id": client_id,
                     "message": message_body,  # includes both client_id and compressed_data
                     "process_id": client_id,
+                    "seq": seq,
+                    "run_id": run_id,
                 }
 
-                await self.log_queue.put(log_data)
+                self._publish(log_data)
                 print(f"Received message from {client_addr}")
 
         except asyncio.CancelledError:
@@ -108,6 +154,15 @@ class TCPLogServer:
             writer.close()
             await writer.wait_closed()
 
+    def _frame_run_id(self, compressed_data: bytes) -> str:
+        """Extract the run_id the process logger attached to a frame."""
+        try:
+            record = msgpack.unpackb(self.decompressor.decompress(compressed_data))
+            return str(record.get("run_id") or "")
+        except Exception as e:
+            print(f"Could not read run_id from log frame: {e}")
+            return ""
+
     async def _read_exact_bytes(self, reader, num_bytes: int) -> Optional[bytes]:
         """Helper function to read an exact number of bytes."""
         data = b""
@@ -136,24 +191,50 @@ class TCPLogServer:
         print("TCP Log Server shutdown complete")
         return True
 
-    def get_log(self, timeout: float = 0.001) -> Optional[dict]:
-        """Get the next log message from the queue."""
-        try:
-            return self.log_queue.get_nowait()
-        except asyncio.QueueEmpty:
-            return None
-
-    async def drain_logs(self, timeout: float = 1.0) -> List[Dict[str, Any]]:
-        """Drain and return all logs from the queue."""
-        logs = []
-        end_time = time.time() + timeout
-
-        while time.time() < end_time:
-            log = await self.get_log(timeout=0.1)
-            if log:
-                logs.append(log)
-
-        return logs
+    def subscribe(
+        self,
+        client_id: str = "",
+        run_ids: Iterable[str] = (),
+        resume_from: Optional[Mapping[str, int]] = None,
+    ) -> LogSubscription:
+        """Start buffering logs for a stream. Recent logs of the runs in
+        resume_from that come after the given sequence are queued first."""
+        subscription = LogSubscription(client_id, run_ids)
+        for seq_key, last_seq in (resume_from or {}).items():
+            # A sequence ahead of ours means this service restarted and
+            # numbered the run from 1 again, so replay all we have
+            if last_seq > self.sequences.get(seq_key, 0):
+                last_seq = 0
+            for log_data in self.history.get(seq_key, ()):
+                if log_data["seq"] > last_seq and subscription.matches(log_data):
+                    subscription.offer(log_data)
+        self.subscriptions.append(subscription)
+        return subscription
+
+    def unsubscribe(self, subscription: LogSubscription):
+        """Stop buffering logs for a stream that ended."""
+        with contextlib.suppress(ValueError):
+            self.subscriptions.remove(subscription)
+
+    def _publish(self, log_data: Dict[str, Any]):
+        """Give every matching stream its own copy of a log."""
+        self._remember(log_data)
+        for subscription in self.subscriptions:
+            if subscription.matches(log_data):
+                subscription.offer(log_data)
+
+    def _remember(self, log_data: Dict[str, Any]):
+        """Keep a log for replay to streams that reconnect."""
+        seq_key = log_data["run_id"] or log_data["client_id"]
+        history = self.history.get(seq_key)
+        if history is None:
+            history = deque(maxlen=HISTORY_SIZE)
+            self.history[seq_key] = history
+            while len(self.history) > HISTORY_RUNS:
+                self.history.popitem(last=False)
+        else:
+            self.history.move_to_end(seq_key)
+        history.append(log_data)
 
     async def __aenter__(self):
         """Support for async context manager."""